@@ -0,0 +1,124 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+)
+
+func (server *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+		case http.MethodGet:
+			server.getAPIKeys(w, r)
+		case http.MethodPost:
+			server.createAPIKey(w, r)
+		default:
+			writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (server *Server) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID := 0
+	if value := r.URL.Query().Get("user_id"); value != "" {
+		userID, err = strconv.Atoi(value)
+		if err != nil {
+			writeJSONError(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	keys, err := server.APIKeyService.GetAPIKeys(r.Context(), currentUser, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUnauthorized) {
+			writeJSONError(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (server *Server) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		UserID int      `json:"user_id"`
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, plain, err := server.APIKeyService.CreateAPIKey(r.Context(), currentUser, req.UserID, req.Name, req.Scopes)
+	if err != nil {
+		switch {
+			case errors.Is(err, service.ErrUnauthorized):
+				writeJSONError(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, sql.ErrNoRows):
+				writeJSONError(w, "User not found", http.StatusNotFound)
+			default:
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		models.APIKey
+		Key string `json:"key"`
+	}{key, plain})
+}
+
+func (server *Server) handleAPIKeyByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keyID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api-keys/"))
+	if err != nil {
+		writeJSONError(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := server.APIKeyService.RevokeAPIKey(r.Context(), currentUser, keyID); err != nil {
+		switch {
+			case errors.Is(err, sql.ErrNoRows):
+				writeJSONError(w, "API key not found", http.StatusNotFound)
+			case errors.Is(err, service.ErrUnauthorized):
+				writeJSONError(w, err.Error(), http.StatusForbidden)
+			default:
+				writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,12 +1,22 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+)
+
+const (
+	defaultTimeWindow = 30 * 24 * time.Hour
+	maxTimeWindow     = 366 * 24 * time.Hour
 )
 
 func (server *Server) handleAppointments(w http.ResponseWriter, r *http.Request) {
@@ -21,13 +31,25 @@ func (server *Server) handleAppointments(w http.ResponseWriter, r *http.Request)
 }
 
 func (server *Server) handleAppointmentByID(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Path[len("/appointments/"):]
-	appointmentID, err := strconv.Atoi(idStr)
+	segments := strings.Split(strings.Trim(r.URL.Path[len("/appointments/"):], "/"), "/")
+	appointmentID, err := strconv.Atoi(segments[0])
 	if err != nil {
 		writeJSONError(w, "Invalid appointment ID", http.StatusBadRequest)
 		return
 	}
 
+	if len(segments) > 1 {
+		switch segments[1] {
+			case "occurrences":
+				server.handleOccurrences(w, r, appointmentID, segments[2:])
+			case "history":
+				server.getStatusHistory(w, r, appointmentID)
+			default:
+				writeJSONError(w, "Not Found", http.StatusNotFound)
+		}
+		return
+	}
+
 	switch r.Method {
 		case http.MethodGet:
 			server.getAppointmentByID(w, r, appointmentID)
@@ -46,17 +68,34 @@ func (server *Server) handleRecurringAppointments(w http.ResponseWriter, r *http
 		return
 	}
 
-	limitStr := r.URL.Query().Get("limit")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 {
-		limit = 10
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	start, end, err := parseTimeWindow(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	recurring, err := server.AppointmentService.GetFutureOccurrences(limit)
+	location, err := responseLocation(r, currentUser)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recurring, err := server.AppointmentService.ExpandOccurrences(r.Context(), currentUser, start, end)
+	if errors.Is(err, service.ErrUnauthorized) {
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		writeJSONError(w, "Failed to fetch recurring appointments", http.StatusInternalServerError)
 		return
 	}
+	localizeAppointments(recurring, location)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(recurring)
@@ -92,17 +131,29 @@ func (server *Server) getAllAppointments(w http.ResponseWriter, r *http.Request)
 
 	sortCriteria := query.Get("sort")
 
+	location, err := responseLocation(r, currentUser)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	appointments, err := server.AppointmentService.GetAllAppointments(
+		r.Context(),
 		currentUser,
 		limit,
 		offset,
 		filters,
 		sortCriteria,
 	)
+	if errors.Is(err, service.ErrUnauthorized) {
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		writeJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	localizeAppointments(appointments, location)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(appointments)
@@ -121,41 +172,35 @@ func (server *Server) createAppointment(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	switch currentUser.Role {
-		case "customer":
-			newAppointment.CustomerID = currentUser.ID
-		case "provider":
-			newAppointment.ProviderID = currentUser.ID
-		case "admin":
-	}
-
 	if newAppointment.RecurrenceRule == "" {
 		newAppointment.RecurrenceRule = "None"
 	}
 	if newAppointment.Status == "" {
-		newAppointment.Status = "Scheduled"
+		newAppointment.Status = models.StatusConfirmed
 	}
 	if newAppointment.Resource == "" {
 		newAppointment.Resource = ""
 	}
+	if newAppointment.TimeZone == "" {
+		newAppointment.TimeZone = currentUser.TimeZone
+	}
+	if newAppointment.Site == "" {
+		newAppointment.Site = currentUser.Site
+	}
 
 	if err := newAppointment.Validate(); err != nil {
 		writeJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err := server.AppointmentService.CheckForConflict(newAppointment); err != nil {
-		writeJSONError(w, err.Error(), http.StatusConflict)
-		return
-	}
-
-	id, err := server.AppointmentService.CreateAppointment(currentUser, newAppointment)
+	id, err := server.AppointmentService.CreateAppointment(r.Context(), currentUser, newAppointment)
 	if err != nil {
-		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		writeAppointmentError(w, err, currentUser.Location())
 		return
 	}
 
 	newAppointment.ID = id
+	newAppointment.Time = newAppointment.Time.In(currentUser.Location())
 	
 	if server.WebSocketServer != nil {
 		message, _ := json.Marshal(newAppointment)
@@ -174,17 +219,24 @@ func (server *Server) getAppointmentByID(w http.ResponseWriter, r *http.Request,
 		return
 	}
 	
+	location, err := responseLocation(r, currentUser)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	filters := map[string]interface{}{
 		"id": appointmentID,
 	}
 
-	appointments, err := server.AppointmentService.GetAllAppointments(currentUser, 1, 0, filters, "")
+	appointments, err := server.AppointmentService.GetAllAppointments(r.Context(), currentUser, 1, 0, filters, "")
 	if err != nil || len(appointments) == 0 {
 		writeJSONError(w, "Appointment not found", http.StatusNotFound)
 		return
 	}
 
 	appointment := appointments[0]
+	appointment.Time = appointment.Time.In(location)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(appointment)
@@ -210,10 +262,11 @@ func (server *Server) updateAppointment(w http.ResponseWriter, r *http.Request,
 	
 	updatedAppointment.ID = appointmentID
 	
-	if err := server.AppointmentService.UpdateAppointment(currentUser, updatedAppointment); err != nil {
-		writeJSONError(w, err.Error(), http.StatusForbidden)
+	if err := server.AppointmentService.UpdateAppointment(r.Context(), currentUser, updatedAppointment); err != nil {
+		writeAppointmentError(w, err, currentUser.Location())
 		return
 	}
+	updatedAppointment.Time = updatedAppointment.Time.In(currentUser.Location())
 
 	if server.WebSocketServer != nil {
 		message, _ := json.Marshal(updatedAppointment)
@@ -225,8 +278,18 @@ func (server *Server) updateAppointment(w http.ResponseWriter, r *http.Request,
 }
 
 func (server *Server) updateAppointmentStatus(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Path[len("/appointments/"):]
-	appointmentID, err := strconv.Atoi(idStr)
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		writeJSONError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	appointmentID, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(r.URL.Path, "/appointments/status/"), "/"))
 	if err != nil {
 		writeJSONError(w, "Invalid appointment ID", http.StatusBadRequest)
 		return
@@ -234,18 +297,66 @@ func (server *Server) updateAppointmentStatus(w http.ResponseWriter, r *http.Req
 
 	var statusUpdate struct {
 		Status string `json:"status"`
+		Reason string `json:"reason"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&statusUpdate); err != nil {
 		writeJSONError(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
-	if err := server.AppointmentService.UpdateAppointmentStatus(appointmentID, statusUpdate.Status); err != nil {
-		http.Error(w, "Failed to update appointment status", http.StatusInternalServerError)
+	if err := server.AppointmentService.ChangeAppointmentStatus(r.Context(), currentUser, appointmentID, statusUpdate.Status, statusUpdate.Reason); err != nil {
+		var conflict *models.ConflictError
+		switch {
+			case errors.As(err, &conflict):
+				writeConflictError(w, conflict, currentUser.Location())
+			case errors.Is(err, sql.ErrNoRows):
+				writeJSONError(w, "Appointment not found", http.StatusNotFound)
+			case errors.Is(err, service.ErrUnauthorized):
+				writeJSONError(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, service.ErrInvalidStatusTransition):
+				writeJSONError(w, err.Error(), http.StatusConflict)
+			default:
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+		}
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	appointment, err := server.AppointmentService.GetAppointmentByID(r.Context(), appointmentID)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	appointment.Time = appointment.Time.In(currentUser.Location())
+
+	if server.WebSocketServer != nil {
+		message, _ := json.Marshal(appointment)
+		server.WebSocketServer.Broadcast(message)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(appointment)
+}
+
+func (server *Server) getStatusHistory(w http.ResponseWriter, r *http.Request, appointmentID int) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	history, err := server.AppointmentService.GetStatusHistory(r.Context(), currentUser, appointmentID)
+	if err != nil {
+		writeOccurrenceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
 }
 
 func (server *Server) deleteAppointment(w http.ResponseWriter, r *http.Request, appointmentID int) {
@@ -255,10 +366,96 @@ func (server *Server) deleteAppointment(w http.ResponseWriter, r *http.Request,
         return
     }
 
-	if err := server.AppointmentService.DeleteAppointment(currentUser, appointmentID); err != nil {
-		writeJSONError(w, err.Error(), http.StatusForbidden)
+	if err := server.AppointmentService.DeleteAppointment(r.Context(), currentUser, appointmentID); err != nil {
+		writeAppointmentError(w, err, currentUser.Location())
 		return
 	}
 	
 	w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+// writeAppointmentError maps the errors of appointment writes to a status
+// code. Anything unexpected is reported as an internal error.
+func writeAppointmentError(w http.ResponseWriter, err error, location *time.Location) {
+	var conflict *models.ConflictError
+	switch {
+		case errors.As(err, &conflict):
+			writeConflictError(w, conflict, location)
+		case errors.Is(err, sql.ErrNoRows):
+			writeJSONError(w, "Appointment not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrUnauthorized):
+			writeJSONError(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, service.ErrOutsideAvailability):
+			writeJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, service.ErrInvalidStatusTransition):
+			writeJSONError(w, err.Error(), http.StatusConflict)
+		default:
+			writeJSONError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func parseTimeWindow(r *http.Request) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+
+	start := time.Now()
+	if value := query.Get("start"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid start: %v", err)
+		}
+		start = parsed
+	}
+
+	end := start.Add(defaultTimeWindow)
+	if value := query.Get("end"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid end: %v", err)
+		}
+		end = parsed
+	}
+
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, errors.New("end must be after start")
+	}
+	if end.Sub(start) > maxTimeWindow {
+		return time.Time{}, time.Time{}, fmt.Errorf("time window cannot exceed %d days", int(maxTimeWindow.Hours()/24))
+	}
+	return start, end, nil
+}
+
+func responseLocation(r *http.Request, user *models.User) (*time.Location, error) {
+	if name := r.URL.Query().Get("tz"); name != "" {
+		return models.LoadLocation(name)
+	}
+	return user.Location(), nil
+}
+
+func localizeAppointments(appointments []models.Appointment, location *time.Location) {
+	for i := range appointments {
+		appointments[i].Time = appointments[i].Time.In(location)
+	}
+}
+
+func writeConflictError(w http.ResponseWriter, conflict *models.ConflictError, location *time.Location) {
+	suggestions := make([]models.TimeRange, len(conflict.Suggestions))
+	for i, suggestion := range conflict.Suggestions {
+		suggestions[i] = models.TimeRange{Start: suggestion.Start.In(location), End: suggestion.End.In(location)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(struct {
+		Error          string              `json:"error"`
+		Kind           models.ConflictKind `json:"kind"`
+		Time           time.Time           `json:"time"`
+		AppointmentIDs []int               `json:"appointment_ids"`
+		Suggestions    []models.TimeRange  `json:"suggestions"`
+	}{
+		Error:          conflict.Error(),
+		Kind:           conflict.Kind,
+		Time:           conflict.Time.In(location),
+		AppointmentIDs: conflict.AppointmentIDs,
+		Suggestions:    suggestions,
+	})
+}
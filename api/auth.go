@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ozoli99/Kaida/models"
+)
+
+type contextKey string
+
+const (
+	userContextKey    contextKey = "user"
+	sessionContextKey contextKey = "session"
+	apiKeyContextKey  contextKey = "api_key"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// AuthMiddleware authenticates requests with either an "Authorization:
+// Bearer" access token or an API key, sent as "Authorization: ApiKey <key>" or
+// in the X-API-Key header, and stores the caller in the request context. API
+// keys are limited to their scopes. Requests without credentials pass through
+// unauthenticated, so public routes keep working; handlers that need a user
+// reject them through getCurrentUser.
+func (server *Server) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		apiKey := r.Header.Get(apiKeyHeader)
+		if header == "" && apiKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if header != "" {
+			scheme, token, found := strings.Cut(header, " ")
+			token = strings.TrimSpace(token)
+			switch {
+				case !found || token == "":
+					writeJSONError(w, "Invalid authorization header", http.StatusUnauthorized)
+					return
+				case strings.EqualFold(scheme, "ApiKey"):
+					apiKey = token
+				case strings.EqualFold(scheme, "Bearer"):
+					server.authenticateBearer(w, r, next, token)
+					return
+				default:
+					writeJSONError(w, "Invalid authorization header", http.StatusUnauthorized)
+					return
+			}
+		}
+
+		server.authenticateAPIKey(w, r, next, apiKey)
+	})
+}
+
+func (server *Server) authenticateBearer(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	if server.TokenService == nil {
+		writeJSONError(w, "Authentication is not configured", http.StatusUnauthorized)
+		return
+	}
+
+	user, session, err := server.TokenService.Authenticate(r.Context(), token)
+	if err != nil {
+		writeJSONError(w, "Invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	ctx = context.WithValue(ctx, sessionContextKey, session)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (server *Server) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, plain string) {
+	if server.APIKeyService == nil {
+		writeJSONError(w, "API keys are not enabled", http.StatusUnauthorized)
+		return
+	}
+
+	user, key, err := server.APIKeyService.AuthenticateAPIKey(r.Context(), plain)
+	if err != nil {
+		writeJSONError(w, "Invalid API key", http.StatusUnauthorized)
+		return
+	}
+
+	if scope := requiredScope(r); !key.HasScope(scope) {
+		writeJSONError(w, "API key is missing the "+scope+" scope", http.StatusForbidden)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	ctx = context.WithValue(ctx, apiKeyContextKey, key)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// requiredScope maps a request to the API key scope that allows it: account
+// and key management needs users:manage, reads need appointments:read and
+// every other request needs appointments:write.
+func requiredScope(r *http.Request) string {
+	for _, prefix := range []string{"/users", "/role-changes", "/sessions", "/api-keys"} {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return models.ScopeUsersManage
+		}
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return models.ScopeAppointmentsRead
+	}
+	return models.ScopeAppointmentsWrite
+}
+
+// UserFromContext returns the user placed in ctx by AuthMiddleware.
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(userContextKey).(*models.User)
+	return user, ok && user != nil
+}
+
+// SessionFromContext returns the session placed in ctx by AuthMiddleware.
+func SessionFromContext(ctx context.Context) (models.Session, bool) {
+	session, ok := ctx.Value(sessionContextKey).(models.Session)
+	return session, ok
+}
+
+// APIKeyFromContext returns the API key placed in ctx by AuthMiddleware.
+func APIKeyFromContext(ctx context.Context) (models.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey).(models.APIKey)
+	return key, ok
+}
+
+func (server *Server) getCurrentUser(r *http.Request) (*models.User, error) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		return nil, errors.New("not authenticated")
+	}
+	return user, nil
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+)
+
+func (server *Server) handleAvailability(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	criteria, err := parseSlotCriteria(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	location, err := responseLocation(r, currentUser)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	slots, err := server.AppointmentService.FindAvailableSlots(r.Context(), currentUser, criteria)
+	if err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	for i := range slots {
+		slots[i].Start = slots[i].Start.In(location)
+		slots[i].End = slots[i].End.In(location)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(slots)
+}
+
+func parseSlotCriteria(r *http.Request) (models.SlotCriteria, error) {
+	query := r.URL.Query()
+
+	from, to, err := parseTimeWindow(r)
+	if err != nil {
+		return models.SlotCriteria{}, err
+	}
+	criteria := models.SlotCriteria{
+		Resource: query.Get("resource"),
+		From:     from,
+		To:       to,
+	}
+
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{
+		{"provider_id", &criteria.ProviderID},
+		{"duration", &criteria.Duration},
+		{"step", &criteria.Step},
+		{"buffer_before", &criteria.BufferBefore},
+		{"buffer_after", &criteria.BufferAfter},
+		{"limit", &criteria.Limit},
+	} {
+		if value := query.Get(param.name); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return models.SlotCriteria{}, fmt.Errorf("invalid %s: %q", param.name, value)
+			}
+			*param.value = number
+		}
+	}
+
+	if value := query.Get("preferred"); value != "" {
+		preferred, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return models.SlotCriteria{}, fmt.Errorf("invalid preferred: %v", err)
+		}
+		criteria.PreferredTime = preferred
+	}
+
+	return criteria, nil
+}
+
+func (server *Server) handleWorkingHours(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/availability/working-hours"), "/")
+	if idStr != "" {
+		hoursID, err := strconv.Atoi(idStr)
+		if err != nil {
+			writeJSONError(w, "Invalid working hours ID", http.StatusBadRequest)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			writeJSONError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		server.deleteWorkingHours(w, r, hoursID)
+		return
+	}
+
+	switch r.Method {
+		case http.MethodGet:
+			server.getWorkingHours(w, r)
+		case http.MethodPost:
+			server.createWorkingHours(w, r)
+		default:
+			writeJSONError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (server *Server) handleAvailabilityOverrides(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/availability/overrides"), "/")
+	if idStr != "" {
+		overrideID, err := strconv.Atoi(idStr)
+		if err != nil {
+			writeJSONError(w, "Invalid override ID", http.StatusBadRequest)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			writeJSONError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		server.deleteAvailabilityOverride(w, r, overrideID)
+		return
+	}
+
+	switch r.Method {
+		case http.MethodGet:
+			server.getAvailabilityOverrides(w, r)
+		case http.MethodPost:
+			server.createAvailabilityOverride(w, r)
+		default:
+			writeJSONError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (server *Server) getWorkingHours(w http.ResponseWriter, r *http.Request) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	providerID, _ := strconv.Atoi(r.URL.Query().Get("provider_id"))
+	workingHours, err := server.AvailabilityService.GetWorkingHours(r.Context(), currentUser, providerID, r.URL.Query().Get("resource"))
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workingHours)
+}
+
+func (server *Server) createWorkingHours(w http.ResponseWriter, r *http.Request) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var hours models.WorkingHours
+	if err := json.NewDecoder(r.Body).Decode(&hours); err != nil {
+		writeJSONError(w, fmt.Sprintf("Invalid input: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	id, err := server.AvailabilityService.CreateWorkingHours(r.Context(), currentUser, hours)
+	if err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	hours.ID = id
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hours)
+}
+
+func (server *Server) deleteWorkingHours(w http.ResponseWriter, r *http.Request, hoursID int) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := server.AvailabilityService.DeleteWorkingHours(r.Context(), currentUser, hoursID); err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) getAvailabilityOverrides(w http.ResponseWriter, r *http.Request) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	providerID, _ := strconv.Atoi(r.URL.Query().Get("provider_id"))
+	overrides, err := server.AvailabilityService.GetAvailabilityOverrides(r.Context(), currentUser, providerID, r.URL.Query().Get("resource"))
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(overrides)
+}
+
+func (server *Server) createAvailabilityOverride(w http.ResponseWriter, r *http.Request) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var override models.AvailabilityOverride
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		writeJSONError(w, fmt.Sprintf("Invalid input: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	id, err := server.AvailabilityService.CreateAvailabilityOverride(r.Context(), currentUser, override)
+	if err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	override.ID = id
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(override)
+}
+
+func (server *Server) deleteAvailabilityOverride(w http.ResponseWriter, r *http.Request, overrideID int) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := server.AvailabilityService.DeleteAvailabilityOverride(r.Context(), currentUser, overrideID); err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeAvailabilityError(w http.ResponseWriter, err error) {
+	switch {
+		case errors.Is(err, sql.ErrNoRows), strings.HasSuffix(err.Error(), "not found"):
+			writeJSONError(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrUnauthorized):
+			writeJSONError(w, err.Error(), http.StatusForbidden)
+		default:
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -8,8 +8,11 @@ import (
 )
 
 type Server struct {
-	AppointmentService service.AppointmentService
-	UserService        service.UserService
+	AppointmentService  service.AppointmentService
+	UserService         service.UserService
+	AvailabilityService service.AvailabilityService
+	TokenService        service.TokenService
+	APIKeyService       service.APIKeyService
 	
 	WebSocketServer    *WebSocketServer
 	MiddlewareChain    []func(http.Handler) http.Handler
@@ -31,9 +34,28 @@ func (server *Server) StartServer(port string) error {
 	http.Handle("/appointments/", server.applyMiddleware(http.HandlerFunc(server.handleAppointmentByID)))
 	http.Handle("/appointments/status/", server.applyMiddleware(http.HandlerFunc(server.updateAppointmentStatus)))
 	http.Handle("/recurring", server.applyMiddleware(http.HandlerFunc(server.handleRecurringAppointments)))
+	http.Handle("/availability", server.applyMiddleware(http.HandlerFunc(server.handleAvailability)))
+	http.Handle("/availability/working-hours", server.applyMiddleware(http.HandlerFunc(server.handleWorkingHours)))
+	http.Handle("/availability/working-hours/", server.applyMiddleware(http.HandlerFunc(server.handleWorkingHours)))
+	http.Handle("/availability/overrides", server.applyMiddleware(http.HandlerFunc(server.handleAvailabilityOverrides)))
+	http.Handle("/availability/overrides/", server.applyMiddleware(http.HandlerFunc(server.handleAvailabilityOverrides)))
 	
 	http.HandleFunc("/users/register", server.handleUserRegister)
     http.HandleFunc("/users/login", server.handleUserLogin)
+	http.HandleFunc("/users/refresh", server.handleTokenRefresh)
+	http.Handle("/users/logout", server.applyMiddleware(http.HandlerFunc(server.handleLogout)))
+	http.Handle("/users/logout-all", server.applyMiddleware(http.HandlerFunc(server.handleLogoutAll)))
+	http.HandleFunc("/users/password-reset", server.handlePasswordResetRequest)
+	http.HandleFunc("/users/password-reset/confirm", server.handlePasswordResetConfirm)
+	http.Handle("/users/verify-email", server.applyMiddleware(http.HandlerFunc(server.handleEmailVerificationRequest)))
+	http.HandleFunc("/users/verify-email/confirm", server.handleEmailVerificationConfirm)
+	http.Handle("/users", server.applyMiddleware(http.HandlerFunc(server.handleUsers)))
+	http.Handle("/users/", server.applyMiddleware(http.HandlerFunc(server.handleUserByID)))
+	http.Handle("/role-changes", server.applyMiddleware(http.HandlerFunc(server.handleRoleChanges)))
+	http.Handle("/sessions", server.applyMiddleware(http.HandlerFunc(server.handleSessions)))
+	http.Handle("/sessions/", server.applyMiddleware(http.HandlerFunc(server.handleSessionByID)))
+	http.Handle("/api-keys", server.applyMiddleware(http.HandlerFunc(server.handleAPIKeys)))
+	http.Handle("/api-keys/", server.applyMiddleware(http.HandlerFunc(server.handleAPIKeyByID)))
 	
 	log.Printf("Starting server on :%s", port)
 	return http.ListenAndServe(":"+port, nil)
@@ -50,8 +72,8 @@ func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+)
+
+func (server *Server) handleOccurrences(w http.ResponseWriter, r *http.Request, appointmentID int, segments []string) {
+	switch {
+		case len(segments) == 0:
+			if r.Method != http.MethodGet {
+				writeJSONError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			server.getOccurrences(w, r, appointmentID)
+		case len(segments) == 1 && segments[0] == "exceptions":
+			switch r.Method {
+				case http.MethodGet:
+					server.getOccurrenceExceptions(w, r, appointmentID)
+				case http.MethodPost:
+					server.createOccurrenceException(w, r, appointmentID)
+				default:
+					writeJSONError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			}
+		case len(segments) == 2 && segments[0] == "exceptions":
+			exceptionID, err := strconv.Atoi(segments[1])
+			if err != nil {
+				writeJSONError(w, "Invalid exception ID", http.StatusBadRequest)
+				return
+			}
+			if r.Method != http.MethodDelete {
+				writeJSONError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			server.deleteOccurrenceException(w, r, appointmentID, exceptionID)
+		default:
+			writeJSONError(w, "Not Found", http.StatusNotFound)
+	}
+}
+
+func (server *Server) getOccurrences(w http.ResponseWriter, r *http.Request, appointmentID int) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	start, end, err := parseTimeWindow(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	location, err := responseLocation(r, currentUser)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	occurrences, err := server.AppointmentService.GetOccurrences(r.Context(), currentUser, appointmentID, start, end)
+	if err != nil {
+		writeOccurrenceError(w, err)
+		return
+	}
+	localizeAppointments(occurrences, location)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(occurrences)
+}
+
+func (server *Server) getOccurrenceExceptions(w http.ResponseWriter, r *http.Request, appointmentID int) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	exceptions, err := server.AppointmentService.GetOccurrenceExceptions(r.Context(), currentUser, appointmentID)
+	if err != nil {
+		writeOccurrenceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exceptions)
+}
+
+func (server *Server) createOccurrenceException(w http.ResponseWriter, r *http.Request, appointmentID int) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var exception models.OccurrenceException
+	if err := json.NewDecoder(r.Body).Decode(&exception); err != nil {
+		writeJSONError(w, fmt.Sprintf("Invalid input: %v", err), http.StatusBadRequest)
+		return
+	}
+	exception.AppointmentID = appointmentID
+
+	id, err := server.AppointmentService.CreateOccurrenceException(r.Context(), currentUser, exception)
+	if err != nil {
+		writeOccurrenceError(w, err)
+		return
+	}
+
+	exception.ID = id
+
+	if server.WebSocketServer != nil {
+		message, _ := json.Marshal(exception)
+		server.WebSocketServer.Broadcast(message)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(exception)
+}
+
+func (server *Server) deleteOccurrenceException(w http.ResponseWriter, r *http.Request, appointmentID, exceptionID int) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := server.AppointmentService.DeleteOccurrenceException(r.Context(), currentUser, appointmentID, exceptionID); err != nil {
+		writeOccurrenceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeOccurrenceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrUnauthorized) {
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	writeJSONError(w, err.Error(), http.StatusBadRequest)
+}
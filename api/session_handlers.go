@@ -0,0 +1,117 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ozoli99/Kaida/service"
+)
+
+func (server *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, ok := SessionFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := server.TokenService.Logout(r.Context(), session.ID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) handleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := server.TokenService.LogoutAll(r.Context(), currentUser.ID); err != nil {
+		writeJSONError(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID := 0
+	if value := r.URL.Query().Get("user_id"); value != "" {
+		userID, err = strconv.Atoi(value)
+		if err != nil {
+			writeJSONError(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sessions, err := server.TokenService.GetSessions(r.Context(), currentUser, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUnauthorized) {
+			writeJSONError(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+func (server *Server) handleSessionByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/sessions/"))
+	if err != nil {
+		writeJSONError(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := server.TokenService.RevokeSession(r.Context(), currentUser, sessionID); err != nil {
+		switch {
+			case errors.Is(err, sql.ErrNoRows):
+				writeJSONError(w, "Session not found", http.StatusNotFound)
+			case errors.Is(err, service.ErrUnauthorized):
+				writeJSONError(w, err.Error(), http.StatusForbidden)
+			default:
+				writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
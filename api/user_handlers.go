@@ -18,6 +18,7 @@ func (server *Server) handleUserRegister(w http.ResponseWriter, r *http.Request)
 		Email string `json:"email"`
 		Password string `json:"password"`
 		Role string `json:"role"`
+		TimeZone string `json:"time_zone"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -25,11 +26,17 @@ func (server *Server) handleUserRegister(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if req.Role != "" && req.Role != models.RoleCustomer {
+		writeJSONError(w, "Only customers can register themselves", http.StatusForbidden)
+		return
+	}
+
 	user, err := server.UserService.RegisterUser(
+		r.Context(),
 		req.Username, 
 		req.Email, 
 		req.Password, 
-		req.Role,
+		req.TimeZone,
 	)
     if err != nil {
         writeJSONError(w, err.Error(), http.StatusBadRequest)
@@ -56,28 +63,58 @@ func (server *Server) handleUserLogin(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    user, err := server.UserService.AuthenticateUser(req.Email, req.Password)
+    // A locked account gets the same answer as a wrong password, so the
+    // response does not tell which email addresses have an account.
+    user, err := server.UserService.AuthenticateUser(r.Context(), req.Email, req.Password)
     if err != nil {
         writeJSONError(w, "Invalid credentials", http.StatusUnauthorized)
         return
     }
 
+    tokens, err := server.TokenService.IssueTokens(r.Context(), user)
+    if err != nil {
+        writeJSONError(w, "Failed to issue tokens", http.StatusInternalServerError)
+        return
+    }
+
     user.Password = ""
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(user)
+    writeTokens(w, user, tokens)
 }
 
-func (server *Server) getCurrentUser(r *http.Request) (*models.User, error) {
-    user := &models.User{
-        ID:    2,
-        Role:  "customer",
-        Email: "test@example.com",
+func (server *Server) handleTokenRefresh(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var req struct {
+        RefreshToken string `json:"refresh_token"`
     }
-    return user, nil
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSONError(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    tokens, err := server.TokenService.Refresh(r.Context(), req.RefreshToken)
+    if err != nil {
+        writeJSONError(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(tokens)
+}
+
+func writeTokens(w http.ResponseWriter, user *models.User, tokens models.TokenPair) {
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(struct {
+        User *models.User `json:"user"`
+        models.TokenPair
+    }{user, tokens})
 }
 
 func writeJSONError(w http.ResponseWriter, message string, status int) {
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(status)
     json.NewEncoder(w).Encode(map[string]string{"error": message})
-}
\ No newline at end of file
+}
@@ -0,0 +1,293 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+)
+
+func (server *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+		case http.MethodGet:
+			server.getUsers(w, r)
+		case http.MethodPost:
+			server.createUser(w, r)
+		default:
+			writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUserByID serves /users/{id} and its sub-resources. "me" stands for
+// the authenticated user's ID.
+func (server *Server) handleUserByID(w http.ResponseWriter, r *http.Request) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/users/"), "/"), "/")
+	userID := currentUser.ID
+	if segments[0] != "me" {
+		userID, err = strconv.Atoi(segments[0])
+		if err != nil {
+			writeJSONError(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch {
+		case len(segments) == 1:
+			switch r.Method {
+				case http.MethodGet:
+					server.getUser(w, r, userID)
+				case http.MethodPut, http.MethodPatch:
+					server.updateUser(w, r, userID)
+				case http.MethodDelete:
+					server.deleteUser(w, r, userID)
+				default:
+					writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case len(segments) == 2 && segments[1] == "password":
+			if r.Method != http.MethodPut && r.Method != http.MethodPost {
+				writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			server.changePassword(w, r, userID)
+		case len(segments) == 2 && segments[1] == "role":
+			if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+				writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			server.changeUserRole(w, r, userID)
+		default:
+			writeJSONError(w, "Not Found", http.StatusNotFound)
+	}
+}
+
+func (server *Server) getUsers(w http.ResponseWriter, r *http.Request) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	users, err := server.UserService.GetUsers(r.Context(), currentUser, limit, offset)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+func (server *Server) getUser(w http.ResponseWriter, r *http.Request, userID int) {
+	currentUser, _ := server.getCurrentUser(r)
+	user, err := server.UserService.GetUser(r.Context(), currentUser, userID)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// updateUser applies the fields present in the body to the stored profile,
+// so PUT and PATCH both accept partial updates.
+func (server *Server) updateUser(w http.ResponseWriter, r *http.Request, userID int) {
+	currentUser, _ := server.getCurrentUser(r)
+	user, err := server.UserService.GetUser(r.Context(), currentUser, userID)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	var req struct {
+		Username *string `json:"username"`
+		Email    *string `json:"email"`
+		TimeZone *string `json:"time_zone"`
+		Site     *string `json:"site"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Username != nil {
+		user.Username = *req.Username
+	}
+	if req.Email != nil {
+		user.Email = *req.Email
+	}
+	if req.TimeZone != nil {
+		user.TimeZone = *req.TimeZone
+	}
+	if req.Site != nil {
+		user.Site = *req.Site
+	}
+
+	updated, err := server.UserService.UpdateUser(r.Context(), currentUser, *user)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (server *Server) deleteUser(w http.ResponseWriter, r *http.Request, userID int) {
+	currentUser, _ := server.getCurrentUser(r)
+	if err := server.UserService.DeleteUser(r.Context(), currentUser, userID); err != nil {
+		writeUserError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) changePassword(w http.ResponseWriter, r *http.Request, userID int) {
+	currentUser, _ := server.getCurrentUser(r)
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := server.UserService.ChangePassword(r.Context(), currentUser, userID, req.CurrentPassword, req.NewPassword); err != nil {
+		writeUserError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) createUser(w http.ResponseWriter, r *http.Request) {
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+		TimeZone string `json:"time_zone"`
+		Site     string `json:"site"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := server.UserService.CreateUser(r.Context(), currentUser, models.User{
+		Username: req.Username,
+		Email:    req.Email,
+		Role:     req.Role,
+		TimeZone: req.TimeZone,
+		Site:     req.Site,
+	}, req.Password)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+func (server *Server) changeUserRole(w http.ResponseWriter, r *http.Request, userID int) {
+	currentUser, _ := server.getCurrentUser(r)
+
+	var req struct {
+		Role   string `json:"role"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := server.UserService.ChangeRole(r.Context(), currentUser, userID, req.Role, req.Reason); err != nil {
+		writeUserError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) handleRoleChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser, err := server.getCurrentUser(r)
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID := 0
+	if value := r.URL.Query().Get("user_id"); value != "" {
+		userID, err = strconv.Atoi(value)
+		if err != nil {
+			writeJSONError(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	changes, err := server.UserService.GetRoleChanges(r.Context(), currentUser, userID)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+func writeUserError(w http.ResponseWriter, err error) {
+	var locked *service.LockedError
+	switch {
+		case errors.As(err, &locked):
+			writeLockedError(w, locked)
+		case errors.Is(err, service.ErrUnauthorized):
+			writeJSONError(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, sql.ErrNoRows):
+			writeJSONError(w, "User not found", http.StatusNotFound)
+		default:
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// writeLockedError answers with 429 and tells the client when the account is
+// unlocked again.
+func writeLockedError(w http.ResponseWriter, locked *service.LockedError) {
+	retryAfter := int(math.Ceil(time.Until(locked.Until).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeJSONError(w, "Too many failed logins, try again later", http.StatusTooManyRequests)
+}
@@ -0,0 +1,91 @@
+// Command migrate applies or reverts the Kaida schema migrations without
+// starting the server. The driver and DSN default to KAIDA_DB_DRIVER and
+// KAIDA_DB_DSN, like the example server.
+//
+//	migrate [-driver sqlite|postgres] [-dsn connection] up|down [steps]|status
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/ozoli99/Kaida/db"
+)
+
+func main() {
+	driver := flag.String("driver", envOr("KAIDA_DB_DRIVER", db.DialectSQLite), "database driver, sqlite or postgres")
+	dsn := flag.String("dsn", os.Getenv("KAIDA_DB_DSN"), "connection string, defaults to the driver's default")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] up|down [steps]|status\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *dsn == "" {
+		*dsn = db.DefaultSQLiteDSN
+		if *driver == db.DialectPostgres {
+			*dsn = db.DefaultPostgresDSN
+		}
+	}
+
+	connection, err := sql.Open(*driver, *dsn)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer connection.Close()
+
+	migrator, err := db.NewMigrator(connection, *driver)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	switch flag.Arg(0) {
+		case "up":
+			applied, err := migrator.Up(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Applied %d migration(s)\n", applied)
+		case "down":
+			steps := 1
+			if flag.NArg() > 1 {
+				steps, err = strconv.Atoi(flag.Arg(1))
+				if err != nil || steps < 1 {
+					log.Fatalf("Invalid number of steps %q", flag.Arg(1))
+				}
+			}
+			reverted, err := migrator.Down(ctx, steps)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Reverted %d migration(s)\n", reverted)
+		case "status":
+			statuses, err := migrator.Status(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, status := range statuses {
+				appliedAt := "pending"
+				if status.Applied {
+					appliedAt = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+				}
+				fmt.Printf("%04d  %-30s %s\n", status.Version, status.Name, appliedAt)
+			}
+		default:
+			flag.Usage()
+			os.Exit(2)
+	}
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
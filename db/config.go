@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultSQLiteDSN opens appointments.db with a private cache per connection.
+// A shared cache replaces SQLite's file locks with table locks that fail with
+// SQLITE_LOCKED instead of honouring BusyTimeout, which breaks WithTx under
+// concurrent writers.
+const DefaultSQLiteDSN = "file:appointments.db?mode=rwc"
+
+const DefaultPostgresDSN = "host=localhost user=postgres dbname=appointments sslmode=disable"
+
+// DefaultBusyTimeout is how long SQLite waits for a lock when BusyTimeout is
+// not set, so writers queue up behind WithTx instead of failing right away
+// with SQLITE_BUSY.
+const DefaultBusyTimeout = 5 * time.Second
+
+// Config holds the connection settings of a database. Zero values keep the
+// defaults of database/sql and the driver. When DB is set the existing pool
+// is used as it is; DSN, BusyTimeout and StatementTimeout are then ignored
+// because they are part of how connections are opened.
+//
+// StatementTimeout is enforced by the Postgres server. BusyTimeout sets how
+// long SQLite waits for a lock held by another connection; zero means
+// DefaultBusyTimeout and a negative value does not wait at all.
+type Config struct {
+	DSN string
+	DB  *sql.DB
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	StatementTimeout time.Duration
+	BusyTimeout      time.Duration
+
+	// QueryTimeout bounds every Database method on top of the deadline of
+	// the caller's context. Zero leaves the caller's context alone.
+	QueryTimeout time.Duration
+
+	// SkipMigrations leaves the schema alone, for deployments that run
+	// cmd/migrate separately.
+	SkipMigrations bool
+}
+
+func NewSQLiteDatabase(config Config) (*SQLiteDatabase, error) {
+	database := &SQLiteDatabase{Config: config}
+	if err := database.InitializeDatabase(); err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+func NewPostgresDatabase(config Config) (*PostgresDatabase, error) {
+	database := &PostgresDatabase{Config: config}
+	if err := database.InitializeDatabase(); err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+// open returns the configured pool, opening one with driver and dsn unless
+// config wraps an existing *sql.DB, and migrates it to the latest schema.
+func (config Config) open(driver, dsn string) (*sql.DB, error) {
+	connection := config.DB
+	if connection == nil {
+		var err error
+		connection, err = sql.Open(driver, dsn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.MaxOpenConns != 0 {
+		connection.SetMaxOpenConns(config.MaxOpenConns)
+	}
+	if config.MaxIdleConns != 0 {
+		connection.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	if config.ConnMaxLifetime != 0 {
+		connection.SetConnMaxLifetime(config.ConnMaxLifetime)
+	}
+	if config.ConnMaxIdleTime != 0 {
+		connection.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+	}
+
+	if !config.SkipMigrations {
+		if err := migrate(connection, driver); err != nil {
+			if config.DB == nil {
+				connection.Close()
+			}
+			return nil, err
+		}
+	}
+	return connection, nil
+}
+
+func migrate(connection *sql.DB, driver string) error {
+	migrator, err := NewMigrator(connection, driver)
+	if err != nil {
+		return err
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+	return nil
+}
+
+func (config Config) sqliteDSN() string {
+	dsn := config.DSN
+	if dsn == "" {
+		dsn = DefaultSQLiteDSN
+	}
+	busyTimeout := config.BusyTimeout
+	if busyTimeout == 0 {
+		busyTimeout = DefaultBusyTimeout
+	}
+	if busyTimeout > 0 {
+		dsn = appendQuery(dsn, "_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()))
+	}
+	return dsn
+}
+
+// postgresDSN accepts both the key/value and the URL form of a connection
+// string.
+func (config Config) postgresDSN() string {
+	dsn := config.DSN
+	if dsn == "" {
+		dsn = DefaultPostgresDSN
+	}
+	if config.StatementTimeout > 0 {
+		timeout := fmt.Sprintf("%d", config.StatementTimeout.Milliseconds())
+		if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+			dsn = appendQuery(dsn, "statement_timeout", timeout)
+		} else {
+			dsn += " statement_timeout=" + timeout
+		}
+	}
+	return dsn
+}
+
+func appendQuery(dsn, key, value string) string {
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + url.QueryEscape(key) + "=" + url.QueryEscape(value)
+}
+
+func (config Config) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if config.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, config.QueryTimeout)
+}
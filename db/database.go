@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"time"
 
 	"github.com/ozoli99/Kaida/models"
@@ -9,21 +10,76 @@ import (
 type Database interface {
 	InitializeDatabase() error
 
-	CreateAppointment(appointment models.Appointment) (int, error)
-	GetAllAppointments(limit, offset int, filters map[string]interface{}, sort string) ([]models.Appointment, error)
-	GetAppointmentByID(appointmentID int) (models.Appointment, error)
-	GetAppointmentsByCustomerAndTimeRange(customerName string, startTime, endTime time.Time) ([]models.Appointment, error)
-	GetRecurringAppointments(limit int) ([]models.Appointment, error)
-	UpdateAppointment(appointment models.Appointment) error
-	UpdateAppointmentStatus(appointmentID int, status string) error
-	DeleteAppointment(appointmentID int) error
-	SuggestAlternativeTimes(resource string, startTime time.Time, duration int) ([]time.Time, error)
-
-	CreateUser(user *models.User) error
-	GetUserByEmail(email string) (*models.User, error)
-	GetUserByID(userID int) (*models.User, error)
-	UpdateUser(user *models.User) error
-	DeleteUser(userID int) error
-	GetAllUsers(limit, offset int) ([]models.User, error)
-	UpdatePassword(userID int, hashedPassword string) error
+	// WithTx runs fn in a transaction and commits it if fn returns nil. The
+	// Database passed to fn runs every method in that transaction.
+	WithTx(ctx context.Context, fn func(tx Database) error) error
+
+	// CreateAppointment, UpdateAppointment and ChangeAppointmentStatus return
+	// a *models.ConflictError when a single booking would overlap another
+	// active single booking of the same provider or resource that is not
+	// shared. Recurring series are not guarded by the database; their
+	// occurrences are only checked by the service.
+	CreateAppointment(ctx context.Context, appointment models.Appointment) (int, error)
+	GetAllAppointments(ctx context.Context, limit, offset int, filters map[string]interface{}, sort string) ([]models.Appointment, error)
+	GetAppointmentByID(ctx context.Context, appointmentID int) (models.Appointment, error)
+	GetOverlappingAppointments(ctx context.Context, filters map[string]interface{}, startTime, endTime time.Time) ([]models.Appointment, error)
+	GetRecurringAppointments(ctx context.Context, filters map[string]interface{}, startsBefore time.Time) ([]models.Appointment, error)
+	// GetRecurringBookings is GetRecurringAppointments for conflict checks:
+	// the provider_id and resource filters also match a series with an
+	// override that moves one of its occurrences to that provider or
+	// resource, so the caller has to match the expanded occurrences again.
+	GetRecurringBookings(ctx context.Context, filters map[string]interface{}, startsBefore time.Time) ([]models.Appointment, error)
+	UpdateAppointment(ctx context.Context, appointment models.Appointment) error
+	ChangeAppointmentStatus(ctx context.Context, change models.StatusChange) (int, error)
+	GetStatusHistory(ctx context.Context, appointmentID int) ([]models.StatusChange, error)
+	DeleteAppointment(ctx context.Context, appointmentID int) error
+
+	CreateOccurrenceException(ctx context.Context, exception models.OccurrenceException) (int, error)
+	GetOccurrenceExceptions(ctx context.Context, appointmentID int) ([]models.OccurrenceException, error)
+	// GetSeriesExceptions returns the exceptions of several series at once,
+	// keyed by appointment ID.
+	GetSeriesExceptions(ctx context.Context, appointmentIDs []int) (map[int][]models.OccurrenceException, error)
+	DeleteOccurrenceException(ctx context.Context, appointmentID, exceptionID int) error
+
+	CreateWorkingHours(ctx context.Context, hours models.WorkingHours) (int, error)
+	GetWorkingHours(ctx context.Context, filters map[string]interface{}) ([]models.WorkingHours, error)
+	DeleteWorkingHours(ctx context.Context, hoursID int) error
+	CreateAvailabilityOverride(ctx context.Context, override models.AvailabilityOverride) (int, error)
+	GetAvailabilityOverrides(ctx context.Context, filters map[string]interface{}) ([]models.AvailabilityOverride, error)
+	DeleteAvailabilityOverride(ctx context.Context, overrideID int) error
+
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserByID(ctx context.Context, userID int) (*models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	DeleteUser(ctx context.Context, userID int) error
+	GetAllUsers(ctx context.Context, limit, offset int) ([]models.User, error)
+	// UpdatePassword stores a new password hash and clears the failed login
+	// count and any lockout, which were earned against the old password.
+	UpdatePassword(ctx context.Context, userID int, hashedPassword string) error
+	ChangeUserRole(ctx context.Context, change models.RoleChange) (int, error)
+	GetRoleChanges(ctx context.Context, userID int) ([]models.RoleChange, error)
+	MarkEmailVerified(ctx context.Context, userID int) error
+	RecordFailedLogin(ctx context.Context, userID int) (int, error)
+	LockUser(ctx context.Context, userID int, until time.Time) error
+	ResetFailedLogins(ctx context.Context, userID int) error
+
+	CreateUserToken(ctx context.Context, token models.UserToken) (int, error)
+	ConsumeUserToken(ctx context.Context, tokenHash, purpose string) (models.UserToken, error)
+	InvalidateUserTokens(ctx context.Context, userID int, purpose string) error
+
+	CreateSession(ctx context.Context, session models.Session) (int, error)
+	GetSessionByID(ctx context.Context, sessionID int) (models.Session, error)
+	GetSessionByTokenHash(ctx context.Context, tokenHash string) (models.Session, error)
+	GetSessions(ctx context.Context, userID int) ([]models.Session, error)
+	RotateSessionToken(ctx context.Context, sessionID int, currentHash, newHash string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, sessionID int) error
+	RevokeUserSessions(ctx context.Context, userID int) error
+
+	CreateAPIKey(ctx context.Context, key models.APIKey) (int, error)
+	GetAPIKeyByID(ctx context.Context, keyID int) (models.APIKey, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error)
+	GetAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error)
+	TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error
+	RevokeAPIKey(ctx context.Context, keyID int) error
 }
\ No newline at end of file
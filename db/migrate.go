@@ -0,0 +1,334 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+const (
+	DialectSQLite   = "sqlite"
+	DialectPostgres = "postgres"
+)
+
+var ErrChecksumMismatch = errors.New("migration checksum mismatch")
+
+// migrationLockID is the Postgres advisory lock key held while migrating.
+const migrationLockID = 7429018364
+
+// Migration is one versioned schema change. Checksum is the SHA-256 of the
+// up script and is recorded when the migration is applied, so edits to an
+// applied migration are detected.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"applied_at,omitempty"`
+}
+
+// Migrator applies the embedded migrations of one dialect. Every run happens
+// in a single transaction that holds a lock, BEGIN IMMEDIATE on SQLite and an
+// advisory lock on Postgres, so concurrent instances wait for each other and
+// a failed run leaves the schema untouched.
+type Migrator struct {
+	Connection *sql.DB
+	Dialect    string
+
+	migrations []Migration
+}
+
+func NewMigrator(connection *sql.DB, dialect string) (*Migrator, error) {
+	migrations, err := LoadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{Connection: connection, Dialect: dialect, migrations: migrations}, nil
+}
+
+// LoadMigrations reads the embedded migrations of dialect, named
+// <version>_<name>.up.sql and <version>_<name>.down.sql, ordered by version.
+func LoadMigrations(dialect string) ([]Migration, error) {
+	if dialect != DialectSQLite && dialect != DialectPostgres {
+		return nil, fmt.Errorf("unsupported migration dialect %q", dialect)
+	}
+
+	directory := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		versionText, name, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionText)
+		if !ok || !found || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		contents, err := migrationFiles.ReadFile(path.Join(directory, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", entry.Name(), err)
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(contents)
+			checksum := sha256.Sum256(contents)
+			migration.Checksum = hex.EncodeToString(checksum[:])
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up applies every pending migration and returns how many were applied.
+func (migrator *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := migrator.locked(ctx, func(conn *sql.Conn, history map[int]appliedMigration) error {
+		for _, migration := range migrator.migrations {
+			if _, exists := history[migration.Version]; exists {
+				continue
+			}
+			if _, err := conn.ExecContext(ctx, migration.Up); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+			query := migrator.bind("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)")
+			if _, err := conn.ExecContext(ctx, query, migration.Version, migration.Name, migration.Checksum, migrator.timestamp(time.Now())); err != nil {
+				return fmt.Errorf("failed to record migration %d: %v", migration.Version, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return applied, nil
+}
+
+// Down reverts the last steps applied migrations and returns how many were
+// reverted.
+func (migrator *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := migrator.locked(ctx, func(conn *sql.Conn, history map[int]appliedMigration) error {
+		for index := len(migrator.migrations) - 1; index >= 0 && reverted < steps; index-- {
+			migration := migrator.migrations[index]
+			if _, exists := history[migration.Version]; !exists {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s cannot be reverted", migration.Version, migration.Name)
+			}
+			if _, err := conn.ExecContext(ctx, migration.Down); err != nil {
+				return fmt.Errorf("failed to revert migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, migrator.bind("DELETE FROM schema_migrations WHERE version = ?"), migration.Version); err != nil {
+				return fmt.Errorf("failed to record migration %d: %v", migration.Version, err)
+			}
+			reverted++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reverted, nil
+}
+
+// Status lists every known migration and whether it has been applied. It
+// only reads, without taking the migration lock or creating the
+// schema_migrations table, so it can run next to a migration in progress;
+// on a database that was never migrated every migration is pending.
+func (migrator *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	history := make(map[int]appliedMigration)
+	exists, err := migrator.historyExists(ctx, migrator.Connection)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		history, err = migrator.history(ctx, migrator.Connection)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range migrator.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if applied, exists := history[migration.Version]; exists {
+			status.Applied = true
+			status.AppliedAt = applied.appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// locked runs apply in a transaction that holds the migration lock, after
+// verifying the checksums of the migrations applied so far.
+func (migrator *Migrator) locked(ctx context.Context, apply func(conn *sql.Conn, history map[int]appliedMigration) error) error {
+	conn, err := migrator.Connection.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %v", err)
+	}
+	defer conn.Close()
+
+	begin := []string{"BEGIN IMMEDIATE"}
+	if migrator.Dialect == DialectPostgres {
+		begin = []string{"BEGIN", fmt.Sprintf("SELECT pg_advisory_xact_lock(%d)", migrationLockID)}
+	}
+	for _, statement := range begin {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			conn.ExecContext(context.Background(), "ROLLBACK")
+			return fmt.Errorf("failed to lock schema migrations: %v", err)
+		}
+	}
+
+	if err := migrator.runLocked(ctx, conn, apply); err != nil {
+		conn.ExecContext(context.Background(), "ROLLBACK")
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return fmt.Errorf("failed to commit migrations: %v", err)
+	}
+	return nil
+}
+
+func (migrator *Migrator) runLocked(ctx context.Context, conn *sql.Conn, apply func(conn *sql.Conn, history map[int]appliedMigration) error) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema migrations table: %v", err)
+	}
+
+	history, err := migrator.history(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return apply(conn, history)
+}
+
+func (migrator *Migrator) historyExists(ctx context.Context, query querier) (bool, error) {
+	statement := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	if migrator.Dialect == DialectPostgres {
+		statement = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations'"
+	}
+	var count int
+	if err := query.QueryRowContext(ctx, statement).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to look up schema migrations table: %v", err)
+	}
+	return count > 0, nil
+}
+
+// history reads the applied migrations and verifies their checksums against
+// the embedded ones.
+func (migrator *Migrator) history(ctx context.Context, query querier) (map[int]appliedMigration, error) {
+	rows, err := query.QueryContext(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema migrations: %v", err)
+	}
+	defer rows.Close()
+
+	history := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var applied appliedMigration
+		if err := rows.Scan(&version, &applied.checksum, &applied.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema migration row: %v", err)
+		}
+		history[version] = applied
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	known := make(map[int]Migration, len(migrator.migrations))
+	for _, migration := range migrator.migrations {
+		known[migration.Version] = migration
+	}
+	for version, applied := range history {
+		migration, exists := known[version]
+		if !exists {
+			return nil, fmt.Errorf("database has migration %d applied, which this build does not know", version)
+		}
+		if applied.checksum != migration.Checksum {
+			return nil, fmt.Errorf("%w: migration %d_%s was changed after it was applied", ErrChecksumMismatch, version, migration.Name)
+		}
+	}
+	return history, nil
+}
+
+// bind rewrites ? placeholders into the dialect's bind parameters.
+func (migrator *Migrator) bind(query string) string {
+	if migrator.Dialect != DialectPostgres {
+		return query
+	}
+	var builder strings.Builder
+	position := 0
+	for _, character := range query {
+		if character == '?' {
+			position++
+			builder.WriteString("$" + strconv.Itoa(position))
+			continue
+		}
+		builder.WriteRune(character)
+	}
+	return builder.String()
+}
+
+func (migrator *Migrator) timestamp(at time.Time) interface{} {
+	if migrator.Dialect == DialectSQLite {
+		return at.UTC().Format(time.RFC3339)
+	}
+	return at.UTC()
+}
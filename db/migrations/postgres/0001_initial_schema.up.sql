@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(50) NOT NULL,
+    email VARCHAR(100) NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    role VARCHAR(50) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS appointments (
+    id SERIAL PRIMARY KEY,
+    customer_name VARCHAR(100) NOT NULL,
+    time TIMESTAMP NOT NULL,
+    duration INT NOT NULL,
+    notes TEXT,
+    recurrence_rule TEXT,
+    status VARCHAR(20) DEFAULT 'Scheduled'
+        CHECK (status IN ('Scheduled', 'Completed', 'Cancelled')),
+    resource VARCHAR(100),
+    customer_id INT REFERENCES users(id),
+    provider_id INT REFERENCES users(id)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE users
+    DROP COLUMN locked_until,
+    DROP COLUMN failed_logins,
+    DROP COLUMN email_verified,
+    DROP COLUMN site,
+    DROP COLUMN time_zone;
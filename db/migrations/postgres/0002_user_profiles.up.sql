@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN site VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN failed_logins INT NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until TIMESTAMPTZ;
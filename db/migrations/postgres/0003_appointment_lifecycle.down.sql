@@ -0,0 +1,19 @@
+DROP TABLE status_history;
+DROP TABLE appointment_exceptions;
+
+-- Statuses the old schema does not know are folded into the closest one.
+ALTER TABLE appointments DROP CONSTRAINT appointments_status_check;
+
+UPDATE appointments SET status = CASE
+    WHEN status IN ('Completed', 'Cancelled') THEN status
+    WHEN status = 'NoShow' THEN 'Cancelled'
+    ELSE 'Scheduled'
+END;
+
+ALTER TABLE appointments
+    DROP COLUMN site,
+    DROP COLUMN time_zone,
+    ADD CONSTRAINT appointments_status_check
+        CHECK (status IN ('Scheduled', 'Completed', 'Cancelled')),
+    ALTER COLUMN status SET DEFAULT 'Scheduled',
+    ALTER COLUMN time TYPE TIMESTAMP;
@@ -0,0 +1,34 @@
+ALTER TABLE appointments DROP CONSTRAINT IF EXISTS appointments_status_check;
+
+ALTER TABLE appointments
+    ALTER COLUMN time TYPE TIMESTAMPTZ,
+    ALTER COLUMN status SET DEFAULT 'Confirmed',
+    ADD CONSTRAINT appointments_status_check
+        CHECK (status IN ('Requested', 'Confirmed', 'CheckedIn', 'InProgress', 'Completed', 'Cancelled', 'NoShow', 'Rescheduled', 'Scheduled')),
+    ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN site VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE TABLE appointment_exceptions (
+    id SERIAL PRIMARY KEY,
+    appointment_id INT NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL
+        CHECK (type IN ('skip', 'add', 'override')),
+    occurrence_time TIMESTAMPTZ NOT NULL,
+    time TIMESTAMPTZ,
+    duration INT NOT NULL DEFAULT 0,
+    resource VARCHAR(100) NOT NULL DEFAULT '',
+    provider_id INT NOT NULL DEFAULT 0,
+    notes TEXT NOT NULL DEFAULT '',
+    UNIQUE (appointment_id, occurrence_time)
+);
+
+CREATE TABLE status_history (
+    id SERIAL PRIMARY KEY,
+    appointment_id INT NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    actor_id INT NOT NULL DEFAULT 0,
+    actor_role VARCHAR(50) NOT NULL DEFAULT '',
+    changed_at TIMESTAMPTZ NOT NULL,
+    reason TEXT NOT NULL DEFAULT ''
+);
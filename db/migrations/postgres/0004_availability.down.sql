@@ -0,0 +1,2 @@
+DROP TABLE availability_overrides;
+DROP TABLE working_hours;
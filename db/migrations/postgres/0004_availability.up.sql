@@ -0,0 +1,21 @@
+CREATE TABLE working_hours (
+    id SERIAL PRIMARY KEY,
+    provider_id INT NOT NULL DEFAULT 0,
+    resource VARCHAR(100) NOT NULL DEFAULT '',
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    start_time VARCHAR(5) NOT NULL,
+    end_time VARCHAR(5) NOT NULL,
+    time_zone VARCHAR(64) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE availability_overrides (
+    id SERIAL PRIMARY KEY,
+    provider_id INT NOT NULL DEFAULT 0,
+    resource VARCHAR(100) NOT NULL DEFAULT '',
+    date VARCHAR(10) NOT NULL,
+    available BOOLEAN NOT NULL DEFAULT FALSE,
+    start_time VARCHAR(5) NOT NULL DEFAULT '',
+    end_time VARCHAR(5) NOT NULL DEFAULT '',
+    time_zone VARCHAR(64) NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,4 @@
+DROP TABLE api_keys;
+DROP TABLE role_changes;
+DROP TABLE user_tokens;
+DROP TABLE sessions;
@@ -0,0 +1,13 @@
+ALTER TABLE appointments
+    DROP CONSTRAINT appointments_resource_overlap,
+    DROP CONSTRAINT appointments_provider_overlap;
+
+DROP TABLE legacy_appointment_overlaps;
+
+DROP TRIGGER appointments_during ON appointments;
+DROP FUNCTION appointments_set_during();
+
+ALTER TABLE appointments
+    DROP COLUMN during,
+    DROP COLUMN shared_resource,
+    DROP COLUMN shared_provider;
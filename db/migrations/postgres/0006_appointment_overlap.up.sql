@@ -0,0 +1,70 @@
+-- btree_gist lets the exclusion constraints compare provider_id and resource
+-- with = alongside the && overlap test on the booking range.
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+ALTER TABLE appointments
+    ADD COLUMN shared_provider BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN shared_resource BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN during TSTZRANGE;
+
+-- timestamptz + interval is not immutable, so the range is kept up to date by
+-- a trigger instead of a generated column.
+CREATE FUNCTION appointments_set_during() RETURNS trigger AS $$
+BEGIN
+    NEW.during := tstzrange(NEW.time, NEW.time + NEW.duration * INTERVAL '1 minute');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER appointments_during
+    BEFORE INSERT OR UPDATE OF time, duration ON appointments
+    FOR EACH ROW EXECUTE FUNCTION appointments_set_during();
+
+UPDATE appointments SET during = tstzrange(time, time + duration * INTERVAL '1 minute');
+ALTER TABLE appointments ALTER COLUMN during SET NOT NULL;
+
+-- Bookings made before the guards existed may already overlap, which would
+-- make the constraints below fail. Every booking that overlaps an older one
+-- is kept but marked as shared, so the guards skip it, and recorded in
+-- legacy_appointment_overlaps for the operators to resolve.
+CREATE TABLE legacy_appointment_overlaps (
+    appointment_id INTEGER NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    PRIMARY KEY (appointment_id, kind)
+);
+
+INSERT INTO legacy_appointment_overlaps (appointment_id, kind)
+SELECT later.id, 'provider' FROM appointments later
+WHERE later.status <> 'Cancelled' AND later.provider_id <> 0 AND COALESCE(later.recurrence_rule, '') IN ('', 'None')
+    AND EXISTS (
+        SELECT 1 FROM appointments earlier
+        WHERE earlier.id < later.id AND earlier.provider_id = later.provider_id
+            AND earlier.status <> 'Cancelled' AND COALESCE(earlier.recurrence_rule, '') IN ('', 'None')
+            AND earlier.during && later.during
+    );
+
+INSERT INTO legacy_appointment_overlaps (appointment_id, kind)
+SELECT later.id, 'resource' FROM appointments later
+WHERE later.status <> 'Cancelled' AND later.resource <> '' AND COALESCE(later.recurrence_rule, '') IN ('', 'None')
+    AND EXISTS (
+        SELECT 1 FROM appointments earlier
+        WHERE earlier.id < later.id AND earlier.resource = later.resource
+            AND earlier.status <> 'Cancelled' AND COALESCE(earlier.recurrence_rule, '') IN ('', 'None')
+            AND earlier.during && later.during
+    );
+
+UPDATE appointments SET shared_provider = TRUE
+WHERE id IN (SELECT appointment_id FROM legacy_appointment_overlaps WHERE kind = 'provider');
+UPDATE appointments SET shared_resource = TRUE
+WHERE id IN (SELECT appointment_id FROM legacy_appointment_overlaps WHERE kind = 'resource');
+
+-- Only single bookings are guarded. Occurrences of recurring series exist
+-- only once the service expands them, so overlaps involving a series are
+-- caught by the service's conflict check alone.
+ALTER TABLE appointments
+    ADD CONSTRAINT appointments_provider_overlap
+        EXCLUDE USING gist (provider_id WITH =, during WITH &&)
+        WHERE (status <> 'Cancelled' AND provider_id <> 0 AND NOT shared_provider AND COALESCE(recurrence_rule, '') IN ('', 'None')),
+    ADD CONSTRAINT appointments_resource_overlap
+        EXCLUDE USING gist (resource WITH =, during WITH &&)
+        WHERE (status <> 'Cancelled' AND resource <> '' AND NOT shared_resource AND COALESCE(recurrence_rule, '') IN ('', 'None'));
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    role TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS appointments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_name TEXT NOT NULL,
+    time DATETIME NOT NULL,
+    duration INTEGER NOT NULL,
+    notes TEXT,
+    recurrence_rule TEXT,
+    status TEXT DEFAULT 'Scheduled' CHECK(status IN ('Scheduled', 'Completed', 'Cancelled')),
+    resource TEXT,
+    customer_id INTEGER REFERENCES users(id),
+    provider_id INTEGER REFERENCES users(id)
+);
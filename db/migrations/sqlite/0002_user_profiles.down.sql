@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN locked_until;
+ALTER TABLE users DROP COLUMN failed_logins;
+ALTER TABLE users DROP COLUMN email_verified;
+ALTER TABLE users DROP COLUMN site;
+ALTER TABLE users DROP COLUMN time_zone;
@@ -0,0 +1,29 @@
+DROP TABLE status_history;
+DROP TABLE appointment_exceptions;
+
+CREATE TABLE appointments_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_name TEXT NOT NULL,
+    time DATETIME NOT NULL,
+    duration INTEGER NOT NULL,
+    notes TEXT,
+    recurrence_rule TEXT,
+    status TEXT DEFAULT 'Scheduled' CHECK(status IN ('Scheduled', 'Completed', 'Cancelled')),
+    resource TEXT,
+    customer_id INTEGER REFERENCES users(id),
+    provider_id INTEGER REFERENCES users(id)
+);
+
+-- Statuses the old schema does not know are folded into the closest one.
+INSERT INTO appointments_old (id, customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id)
+SELECT id, customer_name, time, duration, notes, recurrence_rule,
+    CASE
+        WHEN status IN ('Completed', 'Cancelled') THEN status
+        WHEN status = 'NoShow' THEN 'Cancelled'
+        ELSE 'Scheduled'
+    END,
+    resource, customer_id, provider_id
+FROM appointments;
+
+DROP TABLE appointments;
+ALTER TABLE appointments_old RENAME TO appointments;
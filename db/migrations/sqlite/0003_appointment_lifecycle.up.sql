@@ -0,0 +1,45 @@
+-- SQLite cannot alter a CHECK constraint, so the table is rebuilt.
+CREATE TABLE appointments_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_name TEXT NOT NULL,
+    time DATETIME NOT NULL,
+    duration INTEGER NOT NULL,
+    notes TEXT,
+    recurrence_rule TEXT,
+    status TEXT DEFAULT 'Confirmed' CHECK(status IN ('Requested', 'Confirmed', 'CheckedIn', 'InProgress', 'Completed', 'Cancelled', 'NoShow', 'Rescheduled', 'Scheduled')),
+    resource TEXT,
+    customer_id INTEGER REFERENCES users(id),
+    provider_id INTEGER REFERENCES users(id),
+    time_zone TEXT NOT NULL DEFAULT '',
+    site TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO appointments_new (id, customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id)
+SELECT id, customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id FROM appointments;
+
+DROP TABLE appointments;
+ALTER TABLE appointments_new RENAME TO appointments;
+
+CREATE TABLE appointment_exceptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    appointment_id INTEGER NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK(type IN ('skip', 'add', 'override')),
+    occurrence_time DATETIME NOT NULL,
+    time DATETIME,
+    duration INTEGER NOT NULL DEFAULT 0,
+    resource TEXT NOT NULL DEFAULT '',
+    provider_id INTEGER NOT NULL DEFAULT 0,
+    notes TEXT NOT NULL DEFAULT '',
+    UNIQUE(appointment_id, occurrence_time)
+);
+
+CREATE TABLE status_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    appointment_id INTEGER NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    actor_id INTEGER NOT NULL DEFAULT 0,
+    actor_role TEXT NOT NULL DEFAULT '',
+    changed_at DATETIME NOT NULL,
+    reason TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,21 @@
+CREATE TABLE working_hours (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    provider_id INTEGER NOT NULL DEFAULT 0,
+    resource TEXT NOT NULL DEFAULT '',
+    weekday INTEGER NOT NULL CHECK(weekday BETWEEN 0 AND 6),
+    start_time TEXT NOT NULL,
+    end_time TEXT NOT NULL,
+    time_zone TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE availability_overrides (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    provider_id INTEGER NOT NULL DEFAULT 0,
+    resource TEXT NOT NULL DEFAULT '',
+    date TEXT NOT NULL,
+    available BOOLEAN NOT NULL DEFAULT 0,
+    start_time TEXT NOT NULL DEFAULT '',
+    end_time TEXT NOT NULL DEFAULT '',
+    time_zone TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT ''
+);
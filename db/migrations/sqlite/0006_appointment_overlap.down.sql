@@ -0,0 +1,6 @@
+DROP TRIGGER appointments_overlap_update;
+DROP TRIGGER appointments_overlap_insert;
+DROP TABLE legacy_appointment_overlaps;
+
+ALTER TABLE appointments DROP COLUMN shared_resource;
+ALTER TABLE appointments DROP COLUMN shared_provider;
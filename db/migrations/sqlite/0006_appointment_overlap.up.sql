@@ -0,0 +1,97 @@
+ALTER TABLE appointments ADD COLUMN shared_provider BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE appointments ADD COLUMN shared_resource BOOLEAN NOT NULL DEFAULT 0;
+
+-- Bookings made before the guards existed may already overlap. Every booking
+-- that overlaps an older one is kept but marked as shared, so the triggers
+-- skip it, and recorded in legacy_appointment_overlaps for the operators to
+-- resolve.
+CREATE TABLE legacy_appointment_overlaps (
+    appointment_id INTEGER NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    PRIMARY KEY (appointment_id, kind)
+);
+
+INSERT INTO legacy_appointment_overlaps (appointment_id, kind)
+SELECT later.id, 'provider' FROM appointments later
+WHERE later.status <> 'Cancelled' AND later.provider_id <> 0 AND COALESCE(later.recurrence_rule, '') IN ('', 'None')
+    AND EXISTS (
+        SELECT 1 FROM appointments earlier
+        WHERE earlier.id < later.id AND earlier.provider_id = later.provider_id
+            AND earlier.status <> 'Cancelled' AND COALESCE(earlier.recurrence_rule, '') IN ('', 'None')
+            AND datetime(earlier.time) < datetime(later.time, '+' || later.duration || ' minutes')
+            AND datetime(earlier.time, '+' || earlier.duration || ' minutes') > datetime(later.time)
+    );
+
+INSERT INTO legacy_appointment_overlaps (appointment_id, kind)
+SELECT later.id, 'resource' FROM appointments later
+WHERE later.status <> 'Cancelled' AND later.resource <> '' AND COALESCE(later.recurrence_rule, '') IN ('', 'None')
+    AND EXISTS (
+        SELECT 1 FROM appointments earlier
+        WHERE earlier.id < later.id AND earlier.resource = later.resource
+            AND earlier.status <> 'Cancelled' AND COALESCE(earlier.recurrence_rule, '') IN ('', 'None')
+            AND datetime(earlier.time) < datetime(later.time, '+' || later.duration || ' minutes')
+            AND datetime(earlier.time, '+' || earlier.duration || ' minutes') > datetime(later.time)
+    );
+
+UPDATE appointments SET shared_provider = 1
+WHERE id IN (SELECT appointment_id FROM legacy_appointment_overlaps WHERE kind = 'provider');
+UPDATE appointments SET shared_resource = 1
+WHERE id IN (SELECT appointment_id FROM legacy_appointment_overlaps WHERE kind = 'resource');
+
+-- SQLite has no exclusion constraints, so overlapping active bookings of the
+-- same provider or resource are rejected by triggers. Their messages match
+-- the Postgres constraint names. Only single bookings are guarded.
+-- Occurrences of recurring series exist only once the service expands them,
+-- so overlaps involving a series are caught by the service's conflict check
+-- alone.
+CREATE TRIGGER appointments_overlap_insert
+BEFORE INSERT ON appointments
+WHEN NEW.status <> 'Cancelled' AND COALESCE(NEW.recurrence_rule, '') IN ('', 'None')
+BEGIN
+    SELECT RAISE(ABORT, 'appointments_provider_overlap')
+    WHERE NEW.provider_id <> 0 AND NOT NEW.shared_provider AND EXISTS (
+        SELECT 1 FROM appointments
+        WHERE provider_id = NEW.provider_id AND NOT shared_provider
+            AND status <> 'Cancelled' AND COALESCE(recurrence_rule, '') IN ('', 'None')
+            AND datetime(time) < datetime(NEW.time, '+' || NEW.duration || ' minutes')
+            AND datetime(time, '+' || duration || ' minutes') > datetime(NEW.time)
+    );
+    SELECT RAISE(ABORT, 'appointments_resource_overlap')
+    WHERE NEW.resource <> '' AND NOT NEW.shared_resource AND EXISTS (
+        SELECT 1 FROM appointments
+        WHERE resource = NEW.resource AND NOT shared_resource
+            AND status <> 'Cancelled' AND COALESCE(recurrence_rule, '') IN ('', 'None')
+            AND datetime(time) < datetime(NEW.time, '+' || NEW.duration || ' minutes')
+            AND datetime(time, '+' || duration || ' minutes') > datetime(NEW.time)
+    );
+END;
+
+-- Updates are only checked when they move a booking into the guarded set or
+-- to another slot, so cancelling or confirming a booking never fails on
+-- overlaps that already existed.
+CREATE TRIGGER appointments_overlap_update
+BEFORE UPDATE ON appointments
+WHEN NEW.status <> 'Cancelled' AND COALESCE(NEW.recurrence_rule, '') IN ('', 'None') AND (
+    OLD.status = 'Cancelled' OR COALESCE(OLD.recurrence_rule, '') NOT IN ('', 'None')
+    OR datetime(OLD.time) IS NOT datetime(NEW.time) OR OLD.duration <> NEW.duration
+    OR OLD.provider_id <> NEW.provider_id OR OLD.resource <> NEW.resource
+    OR (OLD.shared_provider AND NOT NEW.shared_provider) OR (OLD.shared_resource AND NOT NEW.shared_resource)
+)
+BEGIN
+    SELECT RAISE(ABORT, 'appointments_provider_overlap')
+    WHERE NEW.provider_id <> 0 AND NOT NEW.shared_provider AND EXISTS (
+        SELECT 1 FROM appointments
+        WHERE provider_id = NEW.provider_id AND id <> NEW.id AND NOT shared_provider
+            AND status <> 'Cancelled' AND COALESCE(recurrence_rule, '') IN ('', 'None')
+            AND datetime(time) < datetime(NEW.time, '+' || NEW.duration || ' minutes')
+            AND datetime(time, '+' || duration || ' minutes') > datetime(NEW.time)
+    );
+    SELECT RAISE(ABORT, 'appointments_resource_overlap')
+    WHERE NEW.resource <> '' AND NOT NEW.shared_resource AND EXISTS (
+        SELECT 1 FROM appointments
+        WHERE resource = NEW.resource AND id <> NEW.id AND NOT shared_resource
+            AND status <> 'Cancelled' AND COALESCE(recurrence_rule, '') IN ('', 'None')
+            AND datetime(time) < datetime(NEW.time, '+' || NEW.duration || ' minutes')
+            AND datetime(time, '+' || duration || ' minutes') > datetime(NEW.time)
+    );
+END;
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/ozoli99/Kaida/models"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// overlapGuards maps the Postgres exclusion constraints, and the SQLite
+// triggers that raise the same names, to the conflict they stand for.
+var overlapGuards = map[string]models.ConflictKind{
+	"appointments_provider_overlap": models.ConflictProvider,
+	"appointments_resource_overlap": models.ConflictResource,
+}
+
+// overlapConflict returns the conflict the service would have reported if
+// err was raised by one of the overlap guards, and nil otherwise. SQLite only
+// reports the trigger's message, so the guard is found by its name in it. The
+// guards do not name the bookings they collided with, so AppointmentIDs is
+// empty and it is up to the service to fill them in.
+func overlapConflict(err error, at time.Time) *models.ConflictError {
+	name := ""
+	var pqError *pq.Error
+	var sqliteError *sqlite.Error
+	switch {
+		case errors.As(err, &pqError):
+			if pqError.Code != "23P01" {
+				return nil
+			}
+			name = pqError.Constraint
+		case errors.As(err, &sqliteError):
+			if sqliteError.Code() != sqlite3.SQLITE_CONSTRAINT_TRIGGER {
+				return nil
+			}
+			for guard := range overlapGuards {
+				if strings.Contains(sqliteError.Error(), guard) {
+					name = guard
+				}
+			}
+	}
+
+	kind, exists := overlapGuards[name]
+	if !exists {
+		return nil
+	}
+	return &models.ConflictError{Kind: kind, Time: at, AppointmentIDs: []int{}}
+}
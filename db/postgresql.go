@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -8,99 +9,143 @@ import (
 
 	"github.com/ozoli99/Kaida/models"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type PostgresDatabase struct {
 	Connection *sql.DB
+	Config     Config
+
+	// tx is the enclosing WithTx transaction, if any.
+	tx *sql.Tx
 }
 
 func (db *PostgresDatabase) InitializeDatabase() error {
-	connectionString := "host=localhost user=postgres password=yourpassword dbname=appointments sslmode=disable"
-	connection, err := sql.Open("postgres", connectionString)
+	connection, err := db.Config.open(DialectPostgres, db.Config.postgresDSN())
 	if err != nil  {
-		return fmt.Errorf("failed to connect to PostgreSQL database: %v", err)
-	}
-
-	_, err = connection.Exec(`
-        CREATE TABLE IF NOT EXISTS users (
-            id SERIAL PRIMARY KEY,
-            username VARCHAR(50) NOT NULL,
-            email VARCHAR(100) NOT NULL UNIQUE,
-            password TEXT NOT NULL,
-            role VARCHAR(50) NOT NULL
-        );
-    `)
-    if err != nil {
-        return fmt.Errorf("failed to create users table: %v", err)
-    }
-
-	_, err = connection.Exec(`
-        CREATE TABLE IF NOT EXISTS appointments (
-            id SERIAL PRIMARY KEY,
-            customer_name VARCHAR(100) NOT NULL,
-            time TIMESTAMP NOT NULL,
-            duration INT NOT NULL,
-            notes TEXT,
-            recurrence_rule TEXT,
-            status VARCHAR(20) DEFAULT 'Scheduled' 
-                CHECK (status IN ('Scheduled', 'Completed', 'Cancelled')),
-            resource VARCHAR(100),
-            customer_id INT REFERENCES users(id),
-			provider_id INT REFERENCES users(id)
-        );
-    `)
-    if err != nil {
-        return fmt.Errorf("failed to create appointments table: %v", err)
-    }
+		return fmt.Errorf("failed to connect to PostgreSQL database: %w", err)
+	}
 
 	db.Connection = connection
 	return nil
 }
 
-func (db *PostgresDatabase) CreateAppointment(appointment models.Appointment) (int, error) {
-	query := `SELECT COUNT(*) FROM appointments WHERE resource = $1 AND time < $2 AND (time + (duration || ' minutes')::interval) > $3`
-	var count int
-	err := db.Connection.QueryRow(query, appointment.Resource, appointment.Time, appointment.Time.Add(time.Minute*time.Duration(appointment.Duration))).Scan(&count)
-	if err != nil {
-		return 0, fmt.Errorf("failed to check for resource conflicts: %v", err)
+// WithTx runs fn in a serializable transaction, so a conflict check and the
+// insert that follows it behave as if no other transaction ran at the same
+// time. Transactions that fail to serialize are retried from the start, so fn
+// must not have side effects outside the database. Calling WithTx on the
+// Database passed to fn joins the same transaction.
+func (db *PostgresDatabase) WithTx(ctx context.Context, fn func(tx Database) error) error {
+	if db.tx != nil {
+		return fn(db)
 	}
-	if count > 0 {
-		suggestions, err := db.SuggestAlternativeTimes(appointment.Resource, appointment.Time, appointment.Duration)
-		if err != nil {
-			return 0, fmt.Errorf("resource conflict: failed to suggest alternatives: %v", err)
+
+	var err error
+	for attempt := 1; attempt <= maxSerializationRetries; attempt++ {
+		err = db.runTx(ctx, fn)
+		if !isSerializationFailure(err) {
+			return err
 		}
-		return 0, fmt.Errorf("resource conflict: the resource is already booked. Suggested times: %v", suggestions)
+
+		select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt*attempt) * 10 * time.Millisecond):
+		}
+	}
+	return err
+}
+
+func (db *PostgresDatabase) runTx(ctx context.Context, fn func(tx Database) error) error {
+	transaction, err := db.Connection.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer transaction.Rollback()
+
+	if err := fn(&PostgresDatabase{Connection: db.Connection, Config: db.Config, tx: transaction}); err != nil {
+		return err
+	}
+	if err := transaction.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (db *PostgresDatabase) querier() querier {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.Connection
+}
+
+func (db *PostgresDatabase) begin(ctx context.Context) (dbTransaction, error) {
+	if db.tx != nil {
+		return joinedTransaction{db.tx}, nil
 	}
+	transaction, err := db.Connection.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+func (db *PostgresDatabase) CreateAppointment(ctx context.Context, appointment models.Appointment) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
 
-	query = "INSERT INTO appointments (customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id"
+	query := "INSERT INTO appointments (customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id, time_zone, site, shared_provider, shared_resource) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id"
 	var insertedID int
-	err = db.Connection.QueryRow(query, appointment.CustomerName, appointment.Time, appointment.Duration, appointment.Notes, appointment.RecurrenceRule, appointment.Status, appointment.Resource, appointment.CustomerID, appointment.ProviderID).Scan(&insertedID)
+	err := db.querier().QueryRowContext(ctx, query, appointment.CustomerName, appointment.Time, appointment.Duration, appointment.Notes, appointment.RecurrenceRule, appointment.Status, appointment.Resource, appointment.CustomerID, appointment.ProviderID, appointment.TimeZone, appointment.Site, appointment.SharedProvider, appointment.SharedResource).Scan(&insertedID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert appointment: %v", err)
+		if conflict := overlapConflict(err, appointment.Time); conflict != nil {
+			return 0, conflict
+		}
+		return 0, fmt.Errorf("failed to insert appointment: %w", err)
 	}
 
 	return insertedID, nil
 }
 
-func (db *PostgresDatabase) GetAllAppointments(limit, offset int, filters map[string]interface{}, sort string) ([]models.Appointment, error) {
-	query := "SELECT id, customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id FROM appointments"
+func (db *PostgresDatabase) GetAllAppointments(ctx context.Context, limit, offset int, filters map[string]interface{}, sort string) ([]models.Appointment, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + appointmentColumns + " FROM appointments"
 	var conditions []string
 	var parameters []interface{}
 
+	addCondition := func(condition string, parameter interface{}) {
+		parameters = append(parameters, parameter)
+		conditions = append(conditions, fmt.Sprintf(condition, len(parameters)))
+	}
+
+	if appointmentID, exists := filters["id"]; exists {
+		addCondition("id = $%d", appointmentID)
+	}
+
+	if customerID, exists := filters["customer_id"]; exists {
+		addCondition("customer_id = $%d", customerID)
+	}
+
+	if providerID, exists := filters["provider_id"]; exists {
+		addCondition("provider_id = $%d", providerID)
+	}
+
+	if site, exists := filters["site"]; exists {
+		addCondition("site = $%d", site)
+	}
+
 	if customerName, exists := filters["customer_name"]; exists {
-		conditions = append(conditions, "customer_name ILIKE $1")
-		parameters = append(parameters, "%"+customerName.(string)+"%")
+		addCondition("customer_name ILIKE $%d", "%"+customerName.(string)+"%")
 	}
 
 	if startTime, exists := filters["start_time"]; exists {
-		conditions = append(conditions, "time >= $2")
-		parameters = append(parameters, startTime.(string))
+		addCondition("time >= $%d", startTime.(string))
 	}
 
 	if endTime, exists := filters["end_time"]; exists {
-		conditions = append(conditions, "time <= $3")
-		parameters = append(parameters, endTime.(string))
+		addCondition("time <= $%d", endTime.(string))
 	}
 
 	if len(conditions) > 0 {
@@ -111,191 +156,384 @@ func (db *PostgresDatabase) GetAllAppointments(limit, offset int, filters map[st
 		query += " ORDER BY " + sort
 	}
 
-	query += " LIMIT $4 OFFSET $5"
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(parameters)+1, len(parameters)+2)
 	parameters = append(parameters, limit, offset)
 
-	rows, err := db.Connection.Query(query, parameters...)
+	rows, err := db.querier().QueryContext(ctx, query, parameters...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get appointments: %v", err)
+		return nil, fmt.Errorf("failed to get appointments: %w", err)
 	}
 	defer rows.Close()
 
-	var appointments []models.Appointment
-	for rows.Next() {
-		var appointment models.Appointment
-		var appointmentTime time.Time
-		if err := rows.Scan(&appointment.ID, &appointment.CustomerName, &appointmentTime, &appointment.Duration, &appointment.Notes, &appointment.RecurrenceRule, &appointment.Status, &appointment.Resource, &appointment.CustomerID, &appointment.ProviderID); err != nil {
-			return nil, fmt.Errorf("failed to scan appointment row: %v", err)
-		}
-		appointment.Time = appointmentTime
-		appointments = append(appointments, appointment)
+	appointments, err := scanAppointments(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan appointment row: %w", err)
 	}
 
 	return appointments, nil
 }
 
-func (db *PostgresDatabase) GetAppointmentByID(appointmentID int) (models.Appointment, error) {
-	query := "SELECT id, customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id FROM appointments WHERE id = $1"
-	row := db.Connection.QueryRow(query, appointmentID)
+func (db *PostgresDatabase) GetAppointmentByID(ctx context.Context, appointmentID int) (models.Appointment, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
 
-	var appointment models.Appointment
-	if err := row.Scan(&appointment.ID, &appointment.CustomerName, &appointment.Time, &appointment.Duration, &appointment.Notes, &appointment.RecurrenceRule, &appointment.Status, &appointment.Resource, &appointment.CustomerID, &appointment.ProviderID); err != nil {
-		return appointment, err
-	}
-	return appointment, nil
+	query := "SELECT " + appointmentColumns + " FROM appointments WHERE id = $1"
+	return scanAppointment(db.querier().QueryRowContext(ctx, query, appointmentID))
 }
 
-func (db *PostgresDatabase) GetAppointmentsByCustomerID(userID int) ([]models.Appointment, error) {
+func (db *PostgresDatabase) GetAppointmentsByCustomerID(ctx context.Context, userID int) ([]models.Appointment, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
     query := `
-        SELECT 
-            id, 
-            customer_name, 
-            time, 
-            duration, 
-            notes, 
-            recurrence_rule, 
-            status, 
-            resource,
-            customer_id,
-			provider_id
+        SELECT ` + appointmentColumns + `
         FROM appointments
         WHERE customer_id = $1
         ORDER BY time ASC
     `
 
-    rows, err := db.Connection.Query(query, userID)
+    rows, err := db.querier().QueryContext(ctx, query, userID)
     if err != nil {
         return nil, fmt.Errorf("failed to get appointments for user %d: %v", userID, err)
     }
     defer rows.Close()
 
-    var appointments []models.Appointment
-    for rows.Next() {
-        var ap models.Appointment
-        var apTime time.Time
-        if err := rows.Scan(
-            &ap.ID,
-            &ap.CustomerName,
-            &apTime,
-            &ap.Duration,
-            &ap.Notes,
-            &ap.RecurrenceRule,
-            &ap.Status,
-            &ap.Resource,
-            &ap.CustomerID,
-			&ap.ProviderID,
-        ); err != nil {
-            return nil, err
-        }
-        ap.Time = apTime
-        appointments = append(appointments, ap)
-    }
-    return appointments, nil
+    return scanAppointments(rows)
 }
 
-func (db *PostgresDatabase) GetAppointmentsByCustomerAndTimeRange(customerName string, startTime, endTime time.Time) ([]models.Appointment, error) {
-	query := `SELECT id, customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id FROM appointments 
-		WHERE customer_name = $1 AND time < $2 AND (time + (duration || ' minutes')::interval) > $3`
+func (db *PostgresDatabase) GetOverlappingAppointments(ctx context.Context, filters map[string]interface{}, startTime, endTime time.Time) ([]models.Appointment, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + appointmentColumns + " FROM appointments WHERE time < $1 AND (time + (duration || ' minutes')::interval) > $2"
+	parameters := []interface{}{endTime, startTime}
+
+	conditions, filterParameters := overlapConditions(filters, func(position int) string { return fmt.Sprintf("$%d", position+len(parameters)) })
+	for _, condition := range conditions {
+		query += " AND " + condition
+	}
+	parameters = append(parameters, filterParameters...)
 
-	rows, err := db.Connection.Query(query, customerName, endTime, startTime)
+	rows, err := db.querier().QueryContext(ctx, query+" ORDER BY time ASC", parameters...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get appointments: %v", err)
+		return nil, fmt.Errorf("failed to get overlapping appointments: %w", err)
 	}
 	defer rows.Close()
 
-	var appointments []models.Appointment
-	for rows.Next() {
-		var appointment models.Appointment
-		if err := rows.Scan(&appointment.ID, &appointment.CustomerName, &appointment.Time, &appointment.Duration, &appointment.Notes, &appointment.RecurrenceRule, &appointment.Status, &appointment.Resource, &appointment.CustomerID, &appointment.ProviderID); err != nil {
-			return nil, fmt.Errorf("failed to scan appointment row: %v", err)
-		}
-		appointments = append(appointments, appointment)
+	appointments, err := scanAppointments(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan appointment row: %w", err)
 	}
 
 	return appointments, nil
 }
 
-func (db *PostgresDatabase) GetRecurringAppointments(limit int) ([]models.Appointment, error) {
-	query := "SELECT id, customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id FROM appointments WHERE recurrence_rule IS NOT NULL"
-	rows, err := db.Connection.Query(query)
+func (db *PostgresDatabase) GetRecurringAppointments(ctx context.Context, filters map[string]interface{}, startsBefore time.Time) ([]models.Appointment, error) {
+	return db.recurringAppointments(ctx, filters, false, startsBefore)
+}
+
+func (db *PostgresDatabase) GetRecurringBookings(ctx context.Context, filters map[string]interface{}, startsBefore time.Time) ([]models.Appointment, error) {
+	return db.recurringAppointments(ctx, filters, true, startsBefore)
+}
+
+func (db *PostgresDatabase) recurringAppointments(ctx context.Context, filters map[string]interface{}, moved bool, startsBefore time.Time) ([]models.Appointment, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + appointmentColumns + " FROM appointments WHERE recurrence_rule IS NOT NULL AND recurrence_rule NOT IN ('', 'None') AND time < $1"
+	parameters := []interface{}{startsBefore}
+
+	conditions, filterParameters := recurringConditions(filters, moved, func(position int) string { return fmt.Sprintf("$%d", position+len(parameters)) })
+	for _, condition := range conditions {
+		query += " AND " + condition
+	}
+	parameters = append(parameters, filterParameters...)
+
+	rows, err := db.querier().QueryContext(ctx, query, parameters...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var recurringAppointments []models.Appointment
-	for rows.Next() {
-		var appointment models.Appointment
-		if err := rows.Scan(&appointment.ID, &appointment.CustomerName, &appointment.Time, &appointment.Duration, &appointment.Notes, &appointment.RecurrenceRule, &appointment.Status, &appointment.Resource, &appointment.CustomerID, &appointment.ProviderID); err != nil {
-			return nil, err
+	return scanAppointments(rows)
+}
+
+func (db *PostgresDatabase) UpdateAppointment(ctx context.Context, appointment models.Appointment) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE appointments SET customer_name = $1, time = $2, duration = $3, notes = $4, recurrence_rule = $5, status = $6, resource = $7, customer_id = $8, provider_id = $9, time_zone = $10, site = $11, shared_provider = $12, shared_resource = $13 WHERE id = $14"
+	_, err := db.querier().ExecContext(ctx, query, appointment.CustomerName, appointment.Time, appointment.Duration, appointment.Notes, appointment.RecurrenceRule, appointment.Status, appointment.Resource, appointment.CustomerID, appointment.ProviderID, appointment.TimeZone, appointment.Site, appointment.SharedProvider, appointment.SharedResource, appointment.ID)
+	if err != nil {
+		if conflict := overlapConflict(err, appointment.Time); conflict != nil {
+			return conflict
 		}
-		recurringAppointments = append(recurringAppointments, appointment)
+		return fmt.Errorf("failed to update appointment: %w", err)
 	}
-	return recurringAppointments, nil
+	return nil
 }
 
-func (db *PostgresDatabase) UpdateAppointment(appointment models.Appointment) error {
-	query := "UPDATE appointments SET customer_name = $1, time = $2, duration = $3, notes = $4, recurrence_rule = $5, status = $6, resource = $7, customer_id = $8, provider_id = $9 WHERE id = $10"
-	_, err := db.Connection.Exec(query, appointment.CustomerName, appointment.Time, appointment.Duration, appointment.Notes, appointment.RecurrenceRule, appointment.Status, appointment.Resource, appointment.CustomerID, appointment.ProviderID, appointment.ID)
+func (db *PostgresDatabase) ChangeAppointmentStatus(ctx context.Context, change models.StatusChange) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	transaction, err := db.begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to update appointment: %v", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer transaction.Rollback()
+
+	result, err := transaction.ExecContext(ctx, "UPDATE appointments SET status = $1 WHERE id = $2", change.ToStatus, change.AppointmentID)
+	if err != nil {
+		if conflict := overlapConflict(err, time.Time{}); conflict != nil {
+			return 0, conflict
+		}
+		return 0, fmt.Errorf("failed to update appointment status: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	query := "INSERT INTO status_history (appointment_id, from_status, to_status, actor_id, actor_role, changed_at, reason) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id"
+	var insertedID int
+	err = transaction.QueryRowContext(ctx, query, change.AppointmentID, change.FromStatus, change.ToStatus, change.ActorID, change.ActorRole, change.ChangedAt, change.Reason).Scan(&insertedID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record status change: %w", err)
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit status change: %w", err)
+	}
+
+	return insertedID, nil
+}
+
+func (db *PostgresDatabase) GetStatusHistory(ctx context.Context, appointmentID int) ([]models.StatusChange, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + statusChangeColumns + " FROM status_history WHERE appointment_id = $1 ORDER BY changed_at ASC, id ASC"
+	rows, err := db.querier().QueryContext(ctx, query, appointmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status history: %w", err)
+	}
+	defer rows.Close()
+
+	return scanStatusChanges(rows)
+}
+
+func (db *PostgresDatabase) DeleteAppointment(ctx context.Context, appointmentID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, "DELETE FROM appointments WHERE id = $1", appointmentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete appointment: %w", err)
 	}
 	return nil
 }
 
-func (db *PostgresDatabase) UpdateAppointmentStatus(appointmentID int, status string) error {
-	query := "UPDATE appointments SET status = $1 WHERE id = $2"
-	_, err := db.Connection.Exec(query, status, appointmentID)
-	return err
+func (db *PostgresDatabase) CreateOccurrenceException(ctx context.Context, exception models.OccurrenceException) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	var newTime interface{}
+	if !exception.Time.IsZero() {
+		newTime = exception.Time
+	}
+
+	query := "INSERT INTO appointment_exceptions (appointment_id, type, occurrence_time, time, duration, resource, provider_id, notes) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
+	var insertedID int
+	err := db.querier().QueryRowContext(ctx, query, exception.AppointmentID, exception.Type, exception.OccurrenceTime, newTime, exception.Duration, exception.Resource, exception.ProviderID, exception.Notes).Scan(&insertedID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert occurrence exception: %w", err)
+	}
+
+	return insertedID, nil
 }
 
-func (db *PostgresDatabase) DeleteAppointment(appointmentID int) error {
-	_, err := db.Connection.Exec("DELETE FROM appointments WHERE id = $1", appointmentID)
+func (db *PostgresDatabase) GetOccurrenceExceptions(ctx context.Context, appointmentID int) ([]models.OccurrenceException, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + occurrenceExceptionColumns + " FROM appointment_exceptions WHERE appointment_id = $1 ORDER BY occurrence_time ASC"
+	rows, err := db.querier().QueryContext(ctx, query, appointmentID)
 	if err != nil {
-		return fmt.Errorf("failed to delete appointment: %v", err)
+		return nil, fmt.Errorf("failed to get occurrence exceptions: %w", err)
+	}
+	defer rows.Close()
+
+	return scanOccurrenceExceptions(rows)
+}
+
+func (db *PostgresDatabase) GetSeriesExceptions(ctx context.Context, appointmentIDs []int) (map[int][]models.OccurrenceException, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	byAppointment := make(map[int][]models.OccurrenceException)
+	if len(appointmentIDs) == 0 {
+		return byAppointment, nil
+	}
+
+	ids := make([]int64, len(appointmentIDs))
+	for index, appointmentID := range appointmentIDs {
+		ids[index] = int64(appointmentID)
+	}
+	query := "SELECT " + occurrenceExceptionColumns + " FROM appointment_exceptions WHERE appointment_id = ANY($1) ORDER BY occurrence_time ASC"
+	rows, err := db.querier().QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get occurrence exceptions: %w", err)
+	}
+	defer rows.Close()
+
+	exceptions, err := scanOccurrenceExceptions(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, exception := range exceptions {
+		byAppointment[exception.AppointmentID] = append(byAppointment[exception.AppointmentID], exception)
+	}
+	return byAppointment, nil
+}
+
+func (db *PostgresDatabase) DeleteOccurrenceException(ctx context.Context, appointmentID, exceptionID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.querier().ExecContext(ctx, "DELETE FROM appointment_exceptions WHERE id = $1 AND appointment_id = $2", exceptionID, appointmentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete occurrence exception: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
 	}
 	return nil
 }
 
-func (db *PostgresDatabase) SuggestAlternativeTimes(resource string, startTime time.Time, duration int) ([]time.Time, error) {
-	query := `SELECT time, duration FROM appointments WHERE resource = $1 AND time >= $2 ORDER BY time ASC`
-	rows, err := db.Connection.Query(query, resource, startTime)
+func (db *PostgresDatabase) CreateWorkingHours(ctx context.Context, hours models.WorkingHours) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO working_hours (provider_id, resource, weekday, start_time, end_time, time_zone) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+	var insertedID int
+	err := db.querier().QueryRowContext(ctx, query, hours.ProviderID, hours.Resource, int(hours.Weekday), hours.StartTime, hours.EndTime, hours.TimeZone).Scan(&insertedID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch conflicting appointments: %v", err)
+		return 0, fmt.Errorf("failed to insert working hours: %w", err)
+	}
+
+	return insertedID, nil
+}
+
+func (db *PostgresDatabase) GetWorkingHours(ctx context.Context, filters map[string]interface{}) ([]models.WorkingHours, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT id, provider_id, resource, weekday, start_time, end_time, time_zone FROM working_hours"
+	conditions, parameters := ownerConditions(filters, func(position int) string { return fmt.Sprintf("$%d", position) })
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY weekday, start_time"
+
+	rows, err := db.querier().QueryContext(ctx, query, parameters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working hours: %w", err)
 	}
 	defer rows.Close()
 
-	var suggestions []time.Time
-	endTime := startTime.Add(time.Minute * time.Duration(duration))
+	var workingHours []models.WorkingHours
 	for rows.Next() {
-		var bookedStartTime time.Time
-		var bookedDuration int
-		if err := rows.Scan(&bookedStartTime, &bookedDuration); err != nil {
-			return nil, err
+		var hours models.WorkingHours
+		if err := rows.Scan(&hours.ID, &hours.ProviderID, &hours.Resource, &hours.Weekday, &hours.StartTime, &hours.EndTime, &hours.TimeZone); err != nil {
+			return nil, fmt.Errorf("failed to scan working hours row: %w", err)
 		}
-		bookedEndTime := bookedStartTime.Add(time.Minute * time.Duration(bookedDuration))
+		workingHours = append(workingHours, hours)
+	}
+	return workingHours, nil
+}
 
-		if endTime.Before(bookedStartTime) {
-			suggestions = append(suggestions, endTime)
-			break
+func (db *PostgresDatabase) DeleteWorkingHours(ctx context.Context, hoursID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.querier().ExecContext(ctx, "DELETE FROM working_hours WHERE id = $1", hoursID)
+	if err != nil {
+		return fmt.Errorf("failed to delete working hours: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (db *PostgresDatabase) CreateAvailabilityOverride(ctx context.Context, override models.AvailabilityOverride) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO availability_overrides (provider_id, resource, date, available, start_time, end_time, time_zone, reason) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
+	var insertedID int
+	err := db.querier().QueryRowContext(ctx, query, override.ProviderID, override.Resource, override.Date, override.Available, override.StartTime, override.EndTime, override.TimeZone, override.Reason).Scan(&insertedID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert availability override: %w", err)
+	}
+
+	return insertedID, nil
+}
+
+func (db *PostgresDatabase) GetAvailabilityOverrides(ctx context.Context, filters map[string]interface{}) ([]models.AvailabilityOverride, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT id, provider_id, resource, date, available, start_time, end_time, time_zone, reason FROM availability_overrides"
+	conditions, parameters := ownerConditions(filters, func(position int) string { return fmt.Sprintf("$%d", position) })
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY date, start_time"
+
+	rows, err := db.querier().QueryContext(ctx, query, parameters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get availability overrides: %w", err)
+	}
+	defer rows.Close()
+
+	var overrides []models.AvailabilityOverride
+	for rows.Next() {
+		var override models.AvailabilityOverride
+		if err := rows.Scan(&override.ID, &override.ProviderID, &override.Resource, &override.Date, &override.Available, &override.StartTime, &override.EndTime, &override.TimeZone, &override.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan availability override row: %w", err)
 		}
-		startTime = bookedEndTime
-		endTime = startTime.Add(time.Minute * time.Duration(duration))
+		overrides = append(overrides, override)
 	}
+	return overrides, nil
+}
+
+func (db *PostgresDatabase) DeleteAvailabilityOverride(ctx context.Context, overrideID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
 
-	suggestions = append(suggestions, endTime)
-	return suggestions, nil
+	result, err := db.querier().ExecContext(ctx, "DELETE FROM availability_overrides WHERE id = $1", overrideID)
+	if err != nil {
+		return fmt.Errorf("failed to delete availability override: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-func (db *PostgresDatabase) CreateUser(user *models.User) error {
+func (db *PostgresDatabase) CreateUser(ctx context.Context, user *models.User) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
     query := `
-    INSERT INTO users (username, email, password, role)
-    VALUES ($1, $2, $3, $4)
+    INSERT INTO users (username, email, password, role, time_zone, site)
+    VALUES ($1, $2, $3, $4, $5, $6)
     RETURNING id;
     `
 
     var newID int
-    err := db.Connection.QueryRow(query, user.Username, user.Email, user.Password, user.Role).Scan(&newID)
+    err := db.querier().QueryRowContext(ctx, query, user.Username, user.Email, user.Password, user.Role, user.TimeZone, user.Site).Scan(&newID)
     if err != nil {
         return fmt.Errorf("failed to insert user: %w", err)
     }
@@ -304,102 +542,411 @@ func (db *PostgresDatabase) CreateUser(user *models.User) error {
     return nil
 }
 
-func (db *PostgresDatabase) GetUserByEmail(email string) (*models.User, error) {
-    query := `SELECT id, username, email, password, role FROM users WHERE email = $1 LIMIT 1;`
+func (db *PostgresDatabase) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+    query := `SELECT ` + userColumns + ` FROM users WHERE email = $1 LIMIT 1;`
 
-    user := models.User{}
-    err := db.Connection.QueryRow(query, email).Scan(
-        &user.ID,
-        &user.Username,
-        &user.Email,
-        &user.Password,
-        &user.Role,
-    )
+    user, err := scanUser(db.querier().QueryRowContext(ctx, query, email))
     if err != nil {
         return nil, fmt.Errorf("failed to get user by email: %w", err)
     }
 
-    return &user, nil
+    return user, nil
 }
 
-func (db *PostgresDatabase) GetUserByID(userID int) (*models.User, error) {
-    query := `SELECT id, username, email, password, role FROM users WHERE id = $1;`
+func (db *PostgresDatabase) GetUserByID(ctx context.Context, userID int) (*models.User, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
 
-    user := models.User{}
-    err := db.Connection.QueryRow(query, userID).Scan(
-        &user.ID,
-        &user.Username,
-        &user.Email,
-        &user.Password,
-        &user.Role,
-    )
+    query := `SELECT ` + userColumns + ` FROM users WHERE id = $1;`
+
+    user, err := scanUser(db.querier().QueryRowContext(ctx, query, userID))
     if err != nil {
         return nil, fmt.Errorf("failed to get user by ID: %w", err)
     }
 
-    return &user, nil
+    return user, nil
 }
 
-func (db *PostgresDatabase) UpdateUser(user *models.User) error {
+func (db *PostgresDatabase) UpdateUser(ctx context.Context, user *models.User) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
 	query := `UPDATE users
 		SET
 			username = $1,
 			email = $2,
 			password = $3,
-			role = $4
-		WHERE id = $5
+			role = $4,
+			time_zone = $5,
+			site = $6,
+			email_verified = $7
+		WHERE id = $8
 	`
-	_, err := db.Connection.Exec(query, user.Username, user.Email, user.Password, user.Role, user.ID)
+	_, err := db.querier().ExecContext(ctx, query, user.Username, user.Email, user.Password, user.Role, user.TimeZone, user.Site, user.EmailVerified, user.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update user with ID %d: %v", user.ID, err)
 	}
 	return nil
 }
 
-func (db *PostgresDatabase) DeleteUser(userID int) error {
-	_, err := db.Connection.Exec(`DELETE FROM users WHERE id = $1`, userID)
+func (db *PostgresDatabase) DeleteUser(ctx context.Context, userID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
 	if err != nil {
 		return fmt.Errorf("failed to delete user with ID %d: %v", userID, err)
 	}
 	return nil
 }
 
-func (db *PostgresDatabase) GetAllUsers(limit, offset int) ([]models.User, error) {
+func (db *PostgresDatabase) GetAllUsers(ctx context.Context, limit, offset int) ([]models.User, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT id, username, email, password, role
+		SELECT ` + userColumns + `
 		FROM users
 		ORDER BY id
 		LIMIT $1
 		OFFSET $2
 	`
 
-	rows, err := db.Connection.Query(query, limit, offset)
+	rows, err := db.querier().QueryContext(ctx, query, limit, offset)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list users: %v", err)
+		return nil, fmt.Errorf("failed to list users: %w", err)
 	}
 	defer rows.Close()
 
 	var users []models.User
 	for rows.Next() {
-		var user models.User
-		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
-		users = append(users, user)
+		users = append(users, *user)
 	}
 
 	return users, nil
 }
 
-func (db *PostgresDatabase) UpdatePassword(userID int, hashedPassword string) error {
+func (db *PostgresDatabase) UpdatePassword(ctx context.Context, userID int, hashedPassword string) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE users
-		SET password = $1
+		SET password = $1, failed_logins = 0, locked_until = NULL
 		WHERE id = $2
 	`
-	_, err := db.Connection.Exec(query, hashedPassword, userID)
+	_, err := db.querier().ExecContext(ctx, query, hashedPassword, userID)
 	if err != nil {
 		return fmt.Errorf("failed to update password for user ID %d: %v", userID, err)
 	}
 	return nil
 }
+
+// ChangeUserRole updates the user's role and records the change in one
+// transaction. Role changes are kept after the user is deleted.
+func (db *PostgresDatabase) ChangeUserRole(ctx context.Context, change models.RoleChange) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	transaction, err := db.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer transaction.Rollback()
+
+	result, err := transaction.ExecContext(ctx, "UPDATE users SET role = $1 WHERE id = $2", change.ToRole, change.UserID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update user role: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	query := "INSERT INTO role_changes (user_id, from_role, to_role, actor_id, changed_at, reason) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+	var insertedID int
+	err = transaction.QueryRowContext(ctx, query, change.UserID, change.FromRole, change.ToRole, change.ActorID, change.ChangedAt, change.Reason).Scan(&insertedID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record role change: %w", err)
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit role change: %w", err)
+	}
+
+	return insertedID, nil
+}
+
+func (db *PostgresDatabase) GetRoleChanges(ctx context.Context, userID int) ([]models.RoleChange, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + roleChangeColumns + " FROM role_changes"
+	var parameters []interface{}
+	if userID != 0 {
+		query += " WHERE user_id = $1"
+		parameters = append(parameters, userID)
+	}
+
+	rows, err := db.querier().QueryContext(ctx, query+" ORDER BY changed_at ASC, id ASC", parameters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role changes: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRoleChanges(rows)
+}
+
+func (db *PostgresDatabase) MarkEmailVerified(ctx context.Context, userID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.querier().ExecContext(ctx, "UPDATE users SET email_verified = TRUE WHERE id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RecordFailedLogin increments the user's failed login counter and returns
+// the new count.
+func (db *PostgresDatabase) RecordFailedLogin(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	var failedLogins int
+	err := db.querier().QueryRowContext(ctx, "UPDATE users SET failed_logins = failed_logins + 1 WHERE id = $1 RETURNING failed_logins", userID).Scan(&failedLogins)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record failed login: %w", err)
+	}
+	return failedLogins, nil
+}
+
+func (db *PostgresDatabase) LockUser(ctx context.Context, userID int, until time.Time) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, "UPDATE users SET locked_until = $1 WHERE id = $2", until, userID)
+	if err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+	return nil
+}
+
+func (db *PostgresDatabase) ResetFailedLogins(ctx context.Context, userID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, "UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("failed to reset failed logins: %w", err)
+	}
+	return nil
+}
+
+func (db *PostgresDatabase) CreateUserToken(ctx context.Context, token models.UserToken) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO user_tokens (user_id, purpose, token_hash, created_at, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	var insertedID int
+	err := db.querier().QueryRowContext(ctx, query, token.UserID, token.Purpose, token.TokenHash, token.CreatedAt, token.ExpiresAt).Scan(&insertedID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create user token: %w", err)
+	}
+
+	return insertedID, nil
+}
+
+// ConsumeUserToken marks an unused, unexpired token as used and returns it.
+// It returns sql.ErrNoRows when there is no such token, including when another
+// request consumed it first.
+func (db *PostgresDatabase) ConsumeUserToken(ctx context.Context, tokenHash, purpose string) (models.UserToken, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE user_tokens SET used_at = NOW() WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW() RETURNING " + userTokenColumns
+	return scanUserToken(db.querier().QueryRowContext(ctx, query, tokenHash, purpose))
+}
+
+func (db *PostgresDatabase) InvalidateUserTokens(ctx context.Context, userID int, purpose string) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, "UPDATE user_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL", userID, purpose)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate user tokens: %w", err)
+	}
+	return nil
+}
+
+func (db *PostgresDatabase) CreateSession(ctx context.Context, session models.Session) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO sessions (user_id, refresh_token_hash, created_at, expires_at) VALUES ($1, $2, $3, $4) RETURNING id"
+	var insertedID int
+	err := db.querier().QueryRowContext(ctx, query, session.UserID, session.TokenHash, session.CreatedAt, session.ExpiresAt).Scan(&insertedID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return insertedID, nil
+}
+
+func (db *PostgresDatabase) GetSessionByID(ctx context.Context, sessionID int) (models.Session, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	return scanSession(db.querier().QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = $1", sessionID))
+}
+
+func (db *PostgresDatabase) GetSessionByTokenHash(ctx context.Context, tokenHash string) (models.Session, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE refresh_token_hash = $1 OR previous_token_hash = $1"
+	return scanSession(db.querier().QueryRowContext(ctx, query, tokenHash))
+}
+
+func (db *PostgresDatabase) GetSessions(ctx context.Context, userID int) ([]models.Session, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + sessionColumns + " FROM sessions"
+	var parameters []interface{}
+	if userID != 0 {
+		query += " WHERE user_id = $1"
+		parameters = append(parameters, userID)
+	}
+
+	rows, err := db.querier().QueryContext(ctx, query+" ORDER BY id", parameters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	defer rows.Close()
+
+	return scanSessions(rows)
+}
+
+func (db *PostgresDatabase) RotateSessionToken(ctx context.Context, sessionID int, currentHash, newHash string, expiresAt time.Time) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE sessions SET previous_token_hash = refresh_token_hash, refresh_token_hash = $1, expires_at = $2 WHERE id = $3 AND refresh_token_hash = $4 AND revoked_at IS NULL"
+	result, err := db.querier().ExecContext(ctx, query, newHash, expiresAt, sessionID, currentHash)
+	if err != nil {
+		return fmt.Errorf("failed to rotate session token: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (db *PostgresDatabase) RevokeSession(ctx context.Context, sessionID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.querier().ExecContext(ctx, "UPDATE sessions SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1", sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (db *PostgresDatabase) RevokeUserSessions(ctx context.Context, userID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+func (db *PostgresDatabase) CreateAPIKey(ctx context.Context, key models.APIKey) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+	var insertedID int
+	err := db.querier().QueryRowContext(ctx, query, key.UserID, key.Name, key.Prefix, key.KeyHash, strings.Join(key.Scopes, ","), key.CreatedAt).Scan(&insertedID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return insertedID, nil
+}
+
+func (db *PostgresDatabase) GetAPIKeyByID(ctx context.Context, keyID int) (models.APIKey, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	return scanAPIKey(db.querier().QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = $1", keyID))
+}
+
+func (db *PostgresDatabase) GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	return scanAPIKey(db.querier().QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE prefix = $1", prefix))
+}
+
+func (db *PostgresDatabase) GetAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + apiKeyColumns + " FROM api_keys"
+	var parameters []interface{}
+	if userID != 0 {
+		query += " WHERE user_id = $1"
+		parameters = append(parameters, userID)
+	}
+
+	rows, err := db.querier().QueryContext(ctx, query+" ORDER BY id", parameters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys: %w", err)
+	}
+	defer rows.Close()
+
+	return scanAPIKeys(rows)
+}
+
+func (db *PostgresDatabase) TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2", usedAt, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to update API key usage: %w", err)
+	}
+	return nil
+}
+
+func (db *PostgresDatabase) RevokeAPIKey(ctx context.Context, keyID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.querier().ExecContext(ctx, "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1", keyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
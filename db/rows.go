@@ -0,0 +1,234 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ozoli99/Kaida/models"
+)
+
+const appointmentColumns = "id, customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id, time_zone, site"
+
+const userColumns = "id, username, email, password, role, time_zone, site, email_verified, failed_logins, locked_until"
+
+const sessionColumns = "id, user_id, refresh_token_hash, previous_token_hash, created_at, expires_at, revoked_at"
+
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, scopes, created_at, last_used_at, revoked_at"
+
+const roleChangeColumns = "id, user_id, from_role, to_role, actor_id, changed_at, reason"
+
+const userTokenColumns = "id, user_id, purpose, token_hash, created_at, expires_at, used_at"
+
+const occurrenceExceptionColumns = "id, appointment_id, type, occurrence_time, time, duration, resource, provider_id, notes"
+
+const statusChangeColumns = "id, appointment_id, from_status, to_status, actor_id, actor_role, changed_at, reason"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAppointment(scanner rowScanner) (models.Appointment, error) {
+	var appointment models.Appointment
+	err := scanner.Scan(&appointment.ID, &appointment.CustomerName, &appointment.Time, &appointment.Duration, &appointment.Notes, &appointment.RecurrenceRule, &appointment.Status, &appointment.Resource, &appointment.CustomerID, &appointment.ProviderID, &appointment.TimeZone, &appointment.Site)
+	return appointment, err
+}
+
+func scanAppointments(rows *sql.Rows) ([]models.Appointment, error) {
+	var appointments []models.Appointment
+	for rows.Next() {
+		appointment, err := scanAppointment(rows)
+		if err != nil {
+			return nil, err
+		}
+		appointments = append(appointments, appointment)
+	}
+	return appointments, rows.Err()
+}
+
+func scanStatusChanges(rows *sql.Rows) ([]models.StatusChange, error) {
+	var changes []models.StatusChange
+	for rows.Next() {
+		var change models.StatusChange
+		if err := rows.Scan(&change.ID, &change.AppointmentID, &change.FromStatus, &change.ToStatus, &change.ActorID, &change.ActorRole, &change.ChangedAt, &change.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan status change row: %v", err)
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+func scanRoleChanges(rows *sql.Rows) ([]models.RoleChange, error) {
+	var changes []models.RoleChange
+	for rows.Next() {
+		var change models.RoleChange
+		if err := rows.Scan(&change.ID, &change.UserID, &change.FromRole, &change.ToRole, &change.ActorID, &change.ChangedAt, &change.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan role change row: %v", err)
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+func scanSession(scanner rowScanner) (models.Session, error) {
+	var session models.Session
+	var revokedAt sql.NullTime
+	err := scanner.Scan(&session.ID, &session.UserID, &session.TokenHash, &session.PreviousTokenHash, &session.CreatedAt, &session.ExpiresAt, &revokedAt)
+	session.RevokedAt = nullTime(revokedAt)
+	return session, err
+}
+
+func scanSessions(rows *sql.Rows) ([]models.Session, error) {
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session row: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func scanAPIKey(scanner rowScanner) (models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var lastUsedAt, revokedAt sql.NullTime
+	err := scanner.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.CreatedAt, &lastUsedAt, &revokedAt)
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	key.LastUsedAt = nullTime(lastUsedAt)
+	key.RevokedAt = nullTime(revokedAt)
+	return key, err
+}
+
+func scanAPIKeys(rows *sql.Rows) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key row: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func scanUserToken(scanner rowScanner) (models.UserToken, error) {
+	var token models.UserToken
+	var usedAt sql.NullTime
+	err := scanner.Scan(&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.CreatedAt, &token.ExpiresAt, &usedAt)
+	token.UsedAt = usedAt.Time
+	return token, err
+}
+
+func scanUser(scanner rowScanner) (*models.User, error) {
+	user := models.User{}
+	var lockedUntil sql.NullTime
+	if err := scanner.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role, &user.TimeZone, &user.Site, &user.EmailVerified, &user.FailedLogins, &lockedUntil); err != nil {
+		return nil, err
+	}
+	user.LockedUntil = lockedUntil.Time
+	return &user, nil
+}
+
+// ownerConditions builds the WHERE conditions shared by the working hours and
+// availability override queries. placeholder renders the dialect-specific
+// bind parameter for the given 1-based position.
+func ownerConditions(filters map[string]interface{}, placeholder func(position int) string) ([]string, []interface{}) {
+	var conditions []string
+	var parameters []interface{}
+	for _, filter := range []struct {
+		key    string
+		clause string
+	}{
+		{"id", "id = "},
+		{"provider_id", "provider_id = "},
+		{"resource", "resource = "},
+		{"from_date", "date >= "},
+		{"to_date", "date <= "},
+	} {
+		if value, exists := filters[filter.key]; exists {
+			parameters = append(parameters, value)
+			conditions = append(conditions, filter.clause+placeholder(len(parameters)))
+		}
+	}
+	return conditions, parameters
+}
+
+// overlapConditions builds the owner conditions of an overlap query. The
+// placeholder positions are relative to the filter parameters.
+func overlapConditions(filters map[string]interface{}, placeholder func(position int) string) ([]string, []interface{}) {
+	var conditions []string
+	var parameters []interface{}
+	for _, filter := range []struct {
+		key    string
+		clause string
+	}{
+		{"customer_id", "customer_id = "},
+		{"provider_id", "provider_id = "},
+		{"resource", "resource = "},
+	} {
+		if value, exists := filters[filter.key]; exists {
+			parameters = append(parameters, value)
+			conditions = append(conditions, filter.clause+placeholder(len(parameters)))
+		}
+	}
+	return conditions, parameters
+}
+
+// recurringConditions builds the owner conditions of a recurring series
+// query. With moved set, the provider and resource conditions also match a
+// series with an override that moves one of its occurrences there. The
+// placeholder positions are relative to the filter parameters.
+func recurringConditions(filters map[string]interface{}, moved bool, placeholder func(position int) string) ([]string, []interface{}) {
+	var conditions []string
+	var parameters []interface{}
+	for _, filter := range []struct {
+		column  string
+		movable bool
+	}{
+		{"customer_id", false},
+		{"provider_id", true},
+		{"resource", true},
+		{"site", false},
+	} {
+		value, exists := filters[filter.column]
+		if !exists {
+			continue
+		}
+		parameters = append(parameters, value)
+		condition := filter.column + " = " + placeholder(len(parameters))
+		if moved && filter.movable {
+			parameters = append(parameters, value)
+			condition = fmt.Sprintf("(%s OR EXISTS (SELECT 1 FROM appointment_exceptions WHERE appointment_exceptions.appointment_id = appointments.id AND appointment_exceptions.type = '%s' AND appointment_exceptions.%s = %s))",
+				condition, models.ExceptionOverride, filter.column, placeholder(len(parameters)))
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, parameters
+}
+
+func scanOccurrenceExceptions(rows *sql.Rows) ([]models.OccurrenceException, error) {
+	var exceptions []models.OccurrenceException
+	for rows.Next() {
+		var exception models.OccurrenceException
+		var newTime sql.NullTime
+		if err := rows.Scan(&exception.ID, &exception.AppointmentID, &exception.Type, &exception.OccurrenceTime, &newTime, &exception.Duration, &exception.Resource, &exception.ProviderID, &exception.Notes); err != nil {
+			return nil, fmt.Errorf("failed to scan occurrence exception row: %v", err)
+		}
+		exception.Time = newTime.Time
+		exceptions = append(exceptions, exception)
+	}
+	return exceptions, rows.Err()
+}
+
+// nullTime returns nil for a NULL timestamp.
+func nullTime(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Time
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -13,69 +14,85 @@ import (
 
 type SQLiteDatabase struct {
 	Connection *sql.DB
+	Config     Config
+
+	// tx is the connection of the enclosing WithTx transaction, if any.
+	tx *sql.Conn
 }
 
 func (db *SQLiteDatabase) InitializeDatabase() error {
-	connection, err := sql.Open("sqlite", "file:appointments.db?cache=shared&mode=rwc")
+	connection, err := db.Config.open(DialectSQLite, db.Config.sqliteDSN())
 	if err != nil {
 		return fmt.Errorf("failed to open SQLite database: %v", err)
 	}
 
-	usersTableQuery := `
-    CREATE TABLE IF NOT EXISTS users (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        username TEXT NOT NULL,
-        email TEXT NOT NULL UNIQUE,
-        password TEXT NOT NULL,
-        role TEXT NOT NULL
-    );`
+	db.Connection = connection
+	return nil
+}
 
-    if _, err = connection.Exec(usersTableQuery); err != nil {
-        return fmt.Errorf("failed to create users table: %v", err)
-    }
+// WithTx runs fn in a transaction started with BEGIN IMMEDIATE, which takes
+// the write lock up front, so a conflict check and the insert that follows it
+// cannot interleave with another writer. Calling WithTx on the Database
+// passed to fn joins the same transaction.
+func (db *SQLiteDatabase) WithTx(ctx context.Context, fn func(tx Database) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
 
-	appointmentsTableQuery := `CREATE TABLE IF NOT EXISTS appointments (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		customer_name TEXT NOT NULL,
-		time DATETIME NOT NULL,
-		duration INTEGER NOT NULL,
-		notes TEXT,
-		recurrence_rule TEXT,
-		status TEXT DEFAULT 'Scheduled' CHECK(status IN ('Scheduled', 'Completed', 'Cancelled')),
-		resource TEXT,
-		customer_id INTEGER REFERENCES users(id),
-		provider_id INTEGER REFERENCES users(id)
-	  );`
+	conn, err := db.Connection.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %v", err)
+	}
+	defer conn.Close()
 
-	if _, err = connection.Exec(appointmentsTableQuery); err != nil {
-		return fmt.Errorf("failed to create appointments table: %v", err)
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
 	}
+	committed := false
+	defer func() {
+		if !committed {
+			conn.ExecContext(context.Background(), "ROLLBACK")
+		}
+	}()
 
-	db.Connection = connection
+	if err := fn(&SQLiteDatabase{Connection: db.Connection, Config: db.Config, tx: conn}); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	committed = true
 	return nil
 }
 
-func (db *SQLiteDatabase) CreateAppointment(appointment models.Appointment) (int, error) {
-	query := `SELECT COUNT(*) FROM appointments
-		      	WHERE resource = ?
-				AND time < datetime(?, '+' || duration || ' minutes')
-				AND datetime(time, '+' || duration || ' minutes') > ?`
-	var count int
-	err := db.Connection.QueryRow(query, appointment.Resource, appointment.Time.Add(time.Minute*time.Duration(appointment.Duration)).Format(time.RFC3339), appointment.Time.Format(time.RFC3339)).Scan(&count)
-	if err != nil {
-		return 0, fmt.Errorf("failed to check for resource conflicts: %v", err)
+func (db *SQLiteDatabase) querier() querier {
+	if db.tx != nil {
+		return db.tx
 	}
-	if count > 0 {
-		suggestions, err := db.SuggestAlternativeTimes(appointment.Resource, appointment.Time, appointment.Duration)
-		if err != nil {
-			return 0, fmt.Errorf("resource conflict: failed to suggest alternatives: %v", err)
-		}
-		return 0, fmt.Errorf("resource conflict: the resource is already booked. Suggested times: %v", suggestions)
+	return db.Connection
+}
+
+func (db *SQLiteDatabase) begin(ctx context.Context) (dbTransaction, error) {
+	if db.tx != nil {
+		return joinedTransaction{db.tx}, nil
 	}
-	
-	query = "INSERT INTO appointments (customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
-	result, err := db.Connection.Exec(query, appointment.CustomerName, appointment.Time.Format(time.RFC3339), appointment.Duration, appointment.Notes, appointment.RecurrenceRule, appointment.Status, appointment.Resource, appointment.CustomerID, appointment.ProviderID)
+	transaction, err := db.Connection.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+func (db *SQLiteDatabase) CreateAppointment(ctx context.Context, appointment models.Appointment) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO appointments (customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id, time_zone, site, shared_provider, shared_resource) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := db.querier().ExecContext(ctx, query, appointment.CustomerName, appointment.Time.UTC().Format(time.RFC3339), appointment.Duration, appointment.Notes, appointment.RecurrenceRule, appointment.Status, appointment.Resource, appointment.CustomerID, appointment.ProviderID, appointment.TimeZone, appointment.Site, appointment.SharedProvider, appointment.SharedResource)
 	if err != nil {
+		if conflict := overlapConflict(err, appointment.Time); conflict != nil {
+			return 0, conflict
+		}
 		return 0, fmt.Errorf("failed to insert appointment: %v", err)
 	}
 
@@ -83,23 +100,46 @@ func (db *SQLiteDatabase) CreateAppointment(appointment models.Appointment) (int
 	return int(insertedID), nil
 }
 
-func (db *SQLiteDatabase) GetAllAppointments(limit, offset int, filters map[string]interface{}, sort string) ([]models.Appointment, error) {
-	query := "SELECT id, customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id FROM appointments"
+func (db *SQLiteDatabase) GetAllAppointments(ctx context.Context, limit, offset int, filters map[string]interface{}, sort string) ([]models.Appointment, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + appointmentColumns + " FROM appointments"
 	var conditions []string
 	var parameters []interface{}
 
+	if appointmentID, exists := filters["id"]; exists {
+		conditions = append(conditions, "id = ?")
+		parameters = append(parameters, appointmentID)
+	}
+
+	if customerID, exists := filters["customer_id"]; exists {
+		conditions = append(conditions, "customer_id = ?")
+		parameters = append(parameters, customerID)
+	}
+
+	if providerID, exists := filters["provider_id"]; exists {
+		conditions = append(conditions, "provider_id = ?")
+		parameters = append(parameters, providerID)
+	}
+
+	if site, exists := filters["site"]; exists {
+		conditions = append(conditions, "site = ?")
+		parameters = append(parameters, site)
+	}
+
 	if customerName, exists := filters["customer_name"]; exists {
 		conditions = append(conditions, "customer_name LIKE ?")
 		parameters = append(parameters, "%"+customerName.(string)+"%")
 	}
 
 	if startTime, exists := filters["start_time"]; exists {
-		conditions = append(conditions, "time >= ?")
+		conditions = append(conditions, "datetime(time) >= datetime(?)")
 		parameters = append(parameters, startTime.(string))
 	}
 
 	if endTime, exists := filters["end_time"]; exists {
-		conditions = append(conditions, "time <= ?")
+		conditions = append(conditions, "datetime(time) <= datetime(?)")
 		parameters = append(parameters, endTime.(string))
 	}
 
@@ -114,167 +154,392 @@ func (db *SQLiteDatabase) GetAllAppointments(limit, offset int, filters map[stri
 	query += " LIMIT ? OFFSET ?"
 	parameters = append(parameters, limit, offset)
 
-	rows, err := db.Connection.Query(query, parameters...)
+	rows, err := db.querier().QueryContext(ctx, query, parameters...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get appointments: %v", err)
 	}
 	defer rows.Close()
 
-	var appointments []models.Appointment
-	for rows.Next() {
-		var appointment models.Appointment
-		var appointmentTime string
-		if err := rows.Scan(&appointment.ID, &appointment.CustomerName, &appointmentTime, &appointment.Duration, &appointment.Notes, &appointment.RecurrenceRule, &appointment.Status, &appointment.Resource, &appointment.CustomerID, &appointment.ProviderID); err != nil {
-			return nil, fmt.Errorf("failed to scan appointment row: %v", err)
-		}
-		appointment.Time, _ = time.Parse(time.RFC3339, appointmentTime)
-		appointments = append(appointments, appointment)
+	appointments, err := scanAppointments(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan appointment row: %v", err)
 	}
 
 	return appointments, nil
 }
 
-func (db *SQLiteDatabase) GetAppointmentByID(appointmentID int) (models.Appointment, error) {
-	query := "SELECT id, customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id FROM appointments WHERE id = ?"
-	row := db.Connection.QueryRow(query, appointmentID)
+func (db *SQLiteDatabase) GetAppointmentByID(ctx context.Context, appointmentID int) (models.Appointment, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
 
-	var appointment models.Appointment
-	if err := row.Scan(&appointment.ID, &appointment.CustomerName, &appointment.Time, &appointment.Duration, &appointment.Notes, &appointment.RecurrenceRule, &appointment.Status, &appointment.Resource, &appointment.CustomerID, &appointment.ProviderID); err != nil {
-		return appointment, err
-	}
-	return appointment, nil
+	query := "SELECT " + appointmentColumns + " FROM appointments WHERE id = ?"
+	return scanAppointment(db.querier().QueryRowContext(ctx, query, appointmentID))
 }
 
-func (db *SQLiteDatabase) GetAppointmentsByCustomerID(userID int) ([]models.Appointment, error) {
+func (db *SQLiteDatabase) GetAppointmentsByCustomerID(ctx context.Context, userID int) ([]models.Appointment, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
     query := `
-        SELECT id, customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id
+        SELECT ` + appointmentColumns + `
         FROM appointments
         WHERE customer_id = ?
         ORDER BY time ASC
     `
-    rows, err := db.Connection.Query(query, userID)
+    rows, err := db.querier().QueryContext(ctx, query, userID)
     if err != nil {
         return nil, fmt.Errorf("failed to get appointments for user %d: %v", userID, err)
     }
     defer rows.Close()
 
-    var appointments []models.Appointment
-    for rows.Next() {
-        var ap models.Appointment
-        var apTime string
-        if err := rows.Scan(&ap.ID, &ap.CustomerName, &apTime, &ap.Duration, &ap.Notes, &ap.RecurrenceRule, &ap.Status, &ap.Resource, &ap.CustomerID, &ap.ProviderID); err != nil {
-            return nil, err
-        }
-        ap.Time, _ = time.Parse(time.RFC3339, apTime)
-        appointments = append(appointments, ap)
-    }
-    return appointments, nil
+    return scanAppointments(rows)
 }
 
-func (db *SQLiteDatabase) GetAppointmentsByCustomerAndTimeRange(customerName string, startTime, endTime time.Time) ([]models.Appointment, error) {
-	query := `SELECT id, customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id FROM appointments WHERE customer_name = ? AND time < ? AND datetime(time, '+' || duration || ' minutes') > ?`
+func (db *SQLiteDatabase) GetOverlappingAppointments(ctx context.Context, filters map[string]interface{}, startTime, endTime time.Time) ([]models.Appointment, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + appointmentColumns + " FROM appointments WHERE datetime(time) < datetime(?) AND datetime(time, '+' || duration || ' minutes') > datetime(?)"
+	parameters := []interface{}{endTime.UTC().Format(time.RFC3339), startTime.UTC().Format(time.RFC3339)}
 
-	rows, err := db.Connection.Query(query, customerName, endTime, startTime)
+	conditions, filterParameters := overlapConditions(filters, func(int) string { return "?" })
+	for _, condition := range conditions {
+		query += " AND " + condition
+	}
+	parameters = append(parameters, filterParameters...)
+
+	rows, err := db.querier().QueryContext(ctx, query+" ORDER BY datetime(time) ASC", parameters...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get appointments: %v", err)
+		return nil, fmt.Errorf("failed to get overlapping appointments: %v", err)
 	}
 	defer rows.Close()
 
-	var appointments []models.Appointment
-	for rows.Next() {
-		var appointment models.Appointment
-		if err := rows.Scan(&appointment.ID, &appointment.CustomerName, &appointment.Time, &appointment.Duration, &appointment.Notes, &appointment.RecurrenceRule, &appointment.Status, &appointment.Resource, &appointment.CustomerID, &appointment.ProviderID); err != nil {
-			return nil, fmt.Errorf("failed to scan appointment row: %v", err)
-		}
-		appointments = append(appointments, appointment)
+	appointments, err := scanAppointments(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan appointment row: %v", err)
 	}
 
 	return appointments, nil
 }
 
-func (db *SQLiteDatabase) GetRecurringAppointments(limit int) ([]models.Appointment, error) {
-	query := "SELECT id, customer_name, time, duration, notes, recurrence_rule, status, resource, customer_id, provider_id FROM appointments WHERE recurrence_rule IS NOT NULL"
-	rows, err := db.Connection.Query(query)
+func (db *SQLiteDatabase) GetRecurringAppointments(ctx context.Context, filters map[string]interface{}, startsBefore time.Time) ([]models.Appointment, error) {
+	return db.recurringAppointments(ctx, filters, false, startsBefore)
+}
+
+func (db *SQLiteDatabase) GetRecurringBookings(ctx context.Context, filters map[string]interface{}, startsBefore time.Time) ([]models.Appointment, error) {
+	return db.recurringAppointments(ctx, filters, true, startsBefore)
+}
+
+func (db *SQLiteDatabase) recurringAppointments(ctx context.Context, filters map[string]interface{}, moved bool, startsBefore time.Time) ([]models.Appointment, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + appointmentColumns + " FROM appointments WHERE recurrence_rule IS NOT NULL AND recurrence_rule NOT IN ('', 'None') AND datetime(time) < datetime(?)"
+	parameters := []interface{}{startsBefore.UTC().Format(time.RFC3339)}
+
+	conditions, filterParameters := recurringConditions(filters, moved, func(int) string { return "?" })
+	for _, condition := range conditions {
+		query += " AND " + condition
+	}
+	parameters = append(parameters, filterParameters...)
+
+	rows, err := db.querier().QueryContext(ctx, query, parameters...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var recurringAppointments []models.Appointment
-	for rows.Next() {
-		var appointment models.Appointment
-		if err := rows.Scan(&appointment.ID, &appointment.CustomerName, &appointment.Time, &appointment.Duration, &appointment.Notes, &appointment.RecurrenceRule, &appointment.Status, &appointment.Resource, &appointment.CustomerID, &appointment.ProviderID); err != nil {
-			return nil, err
-		}
-		recurringAppointments = append(recurringAppointments, appointment)
-	}
-	return recurringAppointments, nil
+	return scanAppointments(rows)
 }
 
-func (db *SQLiteDatabase) UpdateAppointment(appointment models.Appointment) error {
-	_, err := db.Connection.Exec(
-		"UPDATE appointments SET customer_name = ?, time = ?, duration = ?, notes = ?, recurrence_rule = ?, status = ?, resource = ?, customer_id = ?, provider_id = ? WHERE id = ?",
-		appointment.CustomerName, appointment.Time.Format(time.RFC3339), appointment.Duration, appointment.Notes, appointment.RecurrenceRule, appointment.Status, appointment.Resource, appointment.CustomerID, appointment.ProviderID, appointment.ID,
+func (db *SQLiteDatabase) UpdateAppointment(ctx context.Context, appointment models.Appointment) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, 
+		"UPDATE appointments SET customer_name = ?, time = ?, duration = ?, notes = ?, recurrence_rule = ?, status = ?, resource = ?, customer_id = ?, provider_id = ?, time_zone = ?, site = ?, shared_provider = ?, shared_resource = ? WHERE id = ?",
+		appointment.CustomerName, appointment.Time.UTC().Format(time.RFC3339), appointment.Duration, appointment.Notes, appointment.RecurrenceRule, appointment.Status, appointment.Resource, appointment.CustomerID, appointment.ProviderID, appointment.TimeZone, appointment.Site, appointment.SharedProvider, appointment.SharedResource, appointment.ID,
 	)
 	if err != nil {
+		if conflict := overlapConflict(err, appointment.Time); conflict != nil {
+			return conflict
+		}
 		return fmt.Errorf("failed to update appointment: %v", err)
 	}
 	return nil
 }
 
-func (db *SQLiteDatabase) UpdateAppointmentStatus(appointmentID int, status string) error {
-	query := "UPDATE appointments SET status = ? WHERE id = ?"
-	_, err := db.Connection.Exec(query, status, appointmentID)
-	return err
+func (db *SQLiteDatabase) ChangeAppointmentStatus(ctx context.Context, change models.StatusChange) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	transaction, err := db.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer transaction.Rollback()
+
+	result, err := transaction.ExecContext(ctx, "UPDATE appointments SET status = ? WHERE id = ?", change.ToStatus, change.AppointmentID)
+	if err != nil {
+		if conflict := overlapConflict(err, time.Time{}); conflict != nil {
+			return 0, conflict
+		}
+		return 0, fmt.Errorf("failed to update appointment status: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	query := "INSERT INTO status_history (appointment_id, from_status, to_status, actor_id, actor_role, changed_at, reason) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	result, err = transaction.ExecContext(ctx, query, change.AppointmentID, change.FromStatus, change.ToStatus, change.ActorID, change.ActorRole, change.ChangedAt.UTC().Format(time.RFC3339), change.Reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record status change: %v", err)
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit status change: %v", err)
+	}
+
+	insertedID, _ := result.LastInsertId()
+	return int(insertedID), nil
+}
+
+func (db *SQLiteDatabase) GetStatusHistory(ctx context.Context, appointmentID int) ([]models.StatusChange, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + statusChangeColumns + " FROM status_history WHERE appointment_id = ? ORDER BY datetime(changed_at) ASC, id ASC"
+	rows, err := db.querier().QueryContext(ctx, query, appointmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status history: %v", err)
+	}
+	defer rows.Close()
+
+	return scanStatusChanges(rows)
 }
 
-func (db *SQLiteDatabase) DeleteAppointment(appointmentID int) error {
-	_, err := db.Connection.Exec("DELETE FROM appointments WHERE id = ?", appointmentID)
+func (db *SQLiteDatabase) DeleteAppointment(ctx context.Context, appointmentID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := db.querier().ExecContext(ctx, "DELETE FROM status_history WHERE appointment_id = ?", appointmentID); err != nil {
+		return fmt.Errorf("failed to delete status history: %v", err)
+	}
+
+	if _, err := db.querier().ExecContext(ctx, "DELETE FROM appointment_exceptions WHERE appointment_id = ?", appointmentID); err != nil {
+		return fmt.Errorf("failed to delete appointment exceptions: %v", err)
+	}
+
+	_, err := db.querier().ExecContext(ctx, "DELETE FROM appointments WHERE id = ?", appointmentID)
 	if err != nil {
 		return fmt.Errorf("failed to delete appointment: %v", err)
 	}
 	return nil
 }
 
-func (db *SQLiteDatabase) SuggestAlternativeTimes(resource string, startTime time.Time, duration int) ([]time.Time, error) {
-	query := `SELECT time, duration FROM appointments WHERE resource = ? AND time >= ? ORDER BY time ASC`
-	rows, err := db.Connection.Query(query, resource, startTime.Format(time.RFC3339))
+func (db *SQLiteDatabase) CreateOccurrenceException(ctx context.Context, exception models.OccurrenceException) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	var newTime interface{}
+	if !exception.Time.IsZero() {
+		newTime = exception.Time.UTC().Format(time.RFC3339)
+	}
+
+	query := "INSERT INTO appointment_exceptions (appointment_id, type, occurrence_time, time, duration, resource, provider_id, notes) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := db.querier().ExecContext(ctx, query, exception.AppointmentID, exception.Type, exception.OccurrenceTime.UTC().Format(time.RFC3339), newTime, exception.Duration, exception.Resource, exception.ProviderID, exception.Notes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert occurrence exception: %v", err)
+	}
+
+	insertedID, _ := result.LastInsertId()
+	return int(insertedID), nil
+}
+
+func (db *SQLiteDatabase) GetOccurrenceExceptions(ctx context.Context, appointmentID int) ([]models.OccurrenceException, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + occurrenceExceptionColumns + " FROM appointment_exceptions WHERE appointment_id = ? ORDER BY occurrence_time ASC"
+	rows, err := db.querier().QueryContext(ctx, query, appointmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get occurrence exceptions: %v", err)
+	}
+	defer rows.Close()
+
+	return scanOccurrenceExceptions(rows)
+}
+
+func (db *SQLiteDatabase) GetSeriesExceptions(ctx context.Context, appointmentIDs []int) (map[int][]models.OccurrenceException, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	byAppointment := make(map[int][]models.OccurrenceException)
+	if len(appointmentIDs) == 0 {
+		return byAppointment, nil
+	}
+
+	placeholders := make([]string, len(appointmentIDs))
+	parameters := make([]interface{}, len(appointmentIDs))
+	for index, appointmentID := range appointmentIDs {
+		placeholders[index] = "?"
+		parameters[index] = appointmentID
+	}
+	query := "SELECT " + occurrenceExceptionColumns + " FROM appointment_exceptions WHERE appointment_id IN (" + strings.Join(placeholders, ", ") + ") ORDER BY occurrence_time ASC"
+	rows, err := db.querier().QueryContext(ctx, query, parameters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get occurrence exceptions: %v", err)
+	}
+	defer rows.Close()
+
+	exceptions, err := scanOccurrenceExceptions(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, exception := range exceptions {
+		byAppointment[exception.AppointmentID] = append(byAppointment[exception.AppointmentID], exception)
+	}
+	return byAppointment, nil
+}
+
+func (db *SQLiteDatabase) DeleteOccurrenceException(ctx context.Context, appointmentID, exceptionID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.querier().ExecContext(ctx, "DELETE FROM appointment_exceptions WHERE id = ? AND appointment_id = ?", exceptionID, appointmentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete occurrence exception: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (db *SQLiteDatabase) CreateWorkingHours(ctx context.Context, hours models.WorkingHours) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO working_hours (provider_id, resource, weekday, start_time, end_time, time_zone) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err := db.querier().ExecContext(ctx, query, hours.ProviderID, hours.Resource, int(hours.Weekday), hours.StartTime, hours.EndTime, hours.TimeZone)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get conflicting appointments: %v", err)
+		return 0, fmt.Errorf("failed to insert working hours: %v", err)
+	}
+
+	insertedID, _ := result.LastInsertId()
+	return int(insertedID), nil
+}
+
+func (db *SQLiteDatabase) GetWorkingHours(ctx context.Context, filters map[string]interface{}) ([]models.WorkingHours, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT id, provider_id, resource, weekday, start_time, end_time, time_zone FROM working_hours"
+	conditions, parameters := ownerConditions(filters, func(int) string { return "?" })
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY weekday, start_time"
+
+	rows, err := db.querier().QueryContext(ctx, query, parameters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working hours: %v", err)
 	}
 	defer rows.Close()
 
-	var suggestions []time.Time
-	endTime := startTime.Add(time.Minute * time.Duration(duration))
+	var workingHours []models.WorkingHours
 	for rows.Next() {
-		var bookedStartTime time.Time
-		var bookedDuration int
-		if err := rows.Scan(&bookedStartTime, &bookedDuration); err != nil {
-			return nil, err
+		var hours models.WorkingHours
+		if err := rows.Scan(&hours.ID, &hours.ProviderID, &hours.Resource, &hours.Weekday, &hours.StartTime, &hours.EndTime, &hours.TimeZone); err != nil {
+			return nil, fmt.Errorf("failed to scan working hours row: %v", err)
 		}
-		bookedEndTime := bookedStartTime.Add(time.Minute * time.Duration(bookedDuration))
+		workingHours = append(workingHours, hours)
+	}
+	return workingHours, nil
+}
+
+func (db *SQLiteDatabase) DeleteWorkingHours(ctx context.Context, hoursID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.querier().ExecContext(ctx, "DELETE FROM working_hours WHERE id = ?", hoursID)
+	if err != nil {
+		return fmt.Errorf("failed to delete working hours: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (db *SQLiteDatabase) CreateAvailabilityOverride(ctx context.Context, override models.AvailabilityOverride) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO availability_overrides (provider_id, resource, date, available, start_time, end_time, time_zone, reason) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := db.querier().ExecContext(ctx, query, override.ProviderID, override.Resource, override.Date, override.Available, override.StartTime, override.EndTime, override.TimeZone, override.Reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert availability override: %v", err)
+	}
+
+	insertedID, _ := result.LastInsertId()
+	return int(insertedID), nil
+}
+
+func (db *SQLiteDatabase) GetAvailabilityOverrides(ctx context.Context, filters map[string]interface{}) ([]models.AvailabilityOverride, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT id, provider_id, resource, date, available, start_time, end_time, time_zone, reason FROM availability_overrides"
+	conditions, parameters := ownerConditions(filters, func(int) string { return "?" })
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY date, start_time"
 
-		if endTime.Before(bookedStartTime) {
-			suggestions = append(suggestions, endTime)
-			break
+	rows, err := db.querier().QueryContext(ctx, query, parameters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get availability overrides: %v", err)
+	}
+	defer rows.Close()
+
+	var overrides []models.AvailabilityOverride
+	for rows.Next() {
+		var override models.AvailabilityOverride
+		if err := rows.Scan(&override.ID, &override.ProviderID, &override.Resource, &override.Date, &override.Available, &override.StartTime, &override.EndTime, &override.TimeZone, &override.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan availability override row: %v", err)
 		}
-		startTime = bookedEndTime
-		endTime = startTime.Add(time.Minute * time.Duration(duration))
+		overrides = append(overrides, override)
 	}
+	return overrides, nil
+}
+
+func (db *SQLiteDatabase) DeleteAvailabilityOverride(ctx context.Context, overrideID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
 
-	suggestions = append(suggestions, endTime)
-	return suggestions, nil
+	result, err := db.querier().ExecContext(ctx, "DELETE FROM availability_overrides WHERE id = ?", overrideID)
+	if err != nil {
+		return fmt.Errorf("failed to delete availability override: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-func (db *SQLiteDatabase) CreateUser(u *models.User) error {
-    stmt, err := db.Connection.Prepare(`
-        INSERT INTO users (username, email, password, role) 
-        VALUES (?, ?, ?, ?)
+func (db *SQLiteDatabase) CreateUser(ctx context.Context, u *models.User) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+    stmt, err := db.querier().PrepareContext(ctx, `
+        INSERT INTO users (username, email, password, role, time_zone, site) 
+        VALUES (?, ?, ?, ?, ?, ?)
     `)
     if err != nil {
         return err
     }
-    res, err := stmt.Exec(u.Username, u.Email, u.Password, u.Role)
+    res, err := stmt.ExecContext(ctx, u.Username, u.Email, u.Password, u.Role, u.TimeZone, u.Site)
     if err != nil {
         return err
     }
@@ -286,52 +551,64 @@ func (db *SQLiteDatabase) CreateUser(u *models.User) error {
     return nil
 }
 
-func (db *SQLiteDatabase) GetUserByEmail(email string) (*models.User, error) {
-    row := db.Connection.QueryRow(`
-        SELECT id, username, email, password, role 
+func (db *SQLiteDatabase) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+    row := db.querier().QueryRowContext(ctx, `
+        SELECT ` + userColumns + ` 
         FROM users 
         WHERE email = ? 
         LIMIT 1
     `, email)
 
-    user := models.User{}
-    if err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role); err != nil {
-        return nil, err
-    }
-
-    return &user, nil
+    return scanUser(row)
 }
 
-func (db *SQLiteDatabase) GetUserByID(id int) (*models.User, error) {
-    row := db.Connection.QueryRow(`
-        SELECT id, username, email, password, role 
+func (db *SQLiteDatabase) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+    row := db.querier().QueryRowContext(ctx, `
+        SELECT ` + userColumns + ` 
         FROM users 
         WHERE id = ?
     `, id)
 
-    user := models.User{}
-    if err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role); err != nil {
-        return nil, err
-    }
-
-    return &user, nil
+    return scanUser(row)
 }
 
-func (db *SQLiteDatabase) UpdateUser(user *models.User) error {
+func (db *SQLiteDatabase) UpdateUser(ctx context.Context, user *models.User) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE users
-		SET username = ?, email = ?, password = ?, role = ?
+		SET username = ?, email = ?, password = ?, role = ?, time_zone = ?, site = ?, email_verified = ?
 		WHERE id = ?
 	`
-	_, err := db.Connection.Exec(query, user.Username, user.Email, user.Password, user.Role, user.ID)
+	_, err := db.querier().ExecContext(ctx, query, user.Username, user.Email, user.Password, user.Role, user.TimeZone, user.Site, user.EmailVerified, user.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update user with ID %d: %v", user.ID, err)
 	}
 	return nil
 }
 
-func (db *SQLiteDatabase) DeleteUser(userID int) error {
-	_, err := db.Connection.Exec(`
+func (db *SQLiteDatabase) DeleteUser(ctx context.Context, userID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := db.querier().ExecContext(ctx, "DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete sessions of user %d: %v", userID, err)
+	}
+	if _, err := db.querier().ExecContext(ctx, "DELETE FROM user_tokens WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete tokens of user %d: %v", userID, err)
+	}
+	if _, err := db.querier().ExecContext(ctx, "DELETE FROM api_keys WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete API keys of user %d: %v", userID, err)
+	}
+
+	_, err := db.querier().ExecContext(ctx, `
 		DELETE FROM users
 		WHERE id = ?
 	`, userID)
@@ -341,9 +618,12 @@ func (db *SQLiteDatabase) DeleteUser(userID int) error {
 	return nil
 }
 
-func (db *SQLiteDatabase) GetAllUsers(limit, offset int) ([]models.User, error) {
-	rows, err := db.Connection.Query(`
-		SELECT id, username, email, password, role
+func (db *SQLiteDatabase) GetAllUsers(ctx context.Context, limit, offset int) ([]models.User, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.querier().QueryContext(ctx, `
+		SELECT ` + userColumns + `
 		FROM users
 		ORDER BY id
 		LIMIT ? OFFSET ?
@@ -355,19 +635,22 @@ func (db *SQLiteDatabase) GetAllUsers(limit, offset int) ([]models.User, error)
 
 	var users []models.User
 	for rows.Next() {
-		var user models.User
-		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
-		users = append(users, user)
+		users = append(users, *user)
 	}
 	return users, nil
 }
 
-func (db *SQLiteDatabase) UpdatePassword(userID int, hashedPassword string) error {
-	_, err := db.Connection.Exec(`
+func (db *SQLiteDatabase) UpdatePassword(ctx context.Context, userID int, hashedPassword string) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, `
 		UPDATE users
-		SET password = ?
+		SET password = ?, failed_logins = 0, locked_until = NULL
 		WHERE id = ?
 	`, hashedPassword, userID)
 	if err != nil {
@@ -375,3 +658,341 @@ func (db *SQLiteDatabase) UpdatePassword(userID int, hashedPassword string) erro
 	}
 	return nil
 }
+
+// ChangeUserRole updates the user's role and records the change in one
+// transaction. Role changes are kept after the user is deleted.
+func (db *SQLiteDatabase) ChangeUserRole(ctx context.Context, change models.RoleChange) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	transaction, err := db.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer transaction.Rollback()
+
+	result, err := transaction.ExecContext(ctx, "UPDATE users SET role = ? WHERE id = ?", change.ToRole, change.UserID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update user role: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	query := "INSERT INTO role_changes (user_id, from_role, to_role, actor_id, changed_at, reason) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err = transaction.ExecContext(ctx, query, change.UserID, change.FromRole, change.ToRole, change.ActorID, change.ChangedAt.UTC().Format(time.RFC3339), change.Reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record role change: %v", err)
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit role change: %v", err)
+	}
+
+	insertedID, _ := result.LastInsertId()
+	return int(insertedID), nil
+}
+
+func (db *SQLiteDatabase) GetRoleChanges(ctx context.Context, userID int) ([]models.RoleChange, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + roleChangeColumns + " FROM role_changes"
+	var parameters []interface{}
+	if userID != 0 {
+		query += " WHERE user_id = ?"
+		parameters = append(parameters, userID)
+	}
+
+	rows, err := db.querier().QueryContext(ctx, query+" ORDER BY datetime(changed_at) ASC, id ASC", parameters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role changes: %v", err)
+	}
+	defer rows.Close()
+
+	return scanRoleChanges(rows)
+}
+
+func (db *SQLiteDatabase) MarkEmailVerified(ctx context.Context, userID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.querier().ExecContext(ctx, "UPDATE users SET email_verified = 1 WHERE id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RecordFailedLogin increments the user's failed login counter and returns
+// the new count.
+func (db *SQLiteDatabase) RecordFailedLogin(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	transaction, err := db.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer transaction.Rollback()
+
+	if _, err := transaction.ExecContext(ctx, "UPDATE users SET failed_logins = failed_logins + 1 WHERE id = ?", userID); err != nil {
+		return 0, fmt.Errorf("failed to record failed login: %v", err)
+	}
+
+	var failedLogins int
+	if err := transaction.QueryRowContext(ctx, "SELECT failed_logins FROM users WHERE id = ?", userID).Scan(&failedLogins); err != nil {
+		return 0, err
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit failed login: %v", err)
+	}
+	return failedLogins, nil
+}
+
+func (db *SQLiteDatabase) LockUser(ctx context.Context, userID int, until time.Time) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, "UPDATE users SET locked_until = ? WHERE id = ?", until.UTC().Format(time.RFC3339), userID)
+	if err != nil {
+		return fmt.Errorf("failed to lock user: %v", err)
+	}
+	return nil
+}
+
+func (db *SQLiteDatabase) ResetFailedLogins(ctx context.Context, userID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, "UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("failed to reset failed logins: %v", err)
+	}
+	return nil
+}
+
+func (db *SQLiteDatabase) CreateUserToken(ctx context.Context, token models.UserToken) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO user_tokens (user_id, purpose, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?)"
+	result, err := db.querier().ExecContext(ctx, query, token.UserID, token.Purpose, token.TokenHash, token.CreatedAt.UTC().Format(time.RFC3339), token.ExpiresAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create user token: %v", err)
+	}
+
+	insertedID, _ := result.LastInsertId()
+	return int(insertedID), nil
+}
+
+// ConsumeUserToken marks an unused, unexpired token as used and returns it.
+// It returns sql.ErrNoRows when there is no such token, including when another
+// request consumed it first.
+func (db *SQLiteDatabase) ConsumeUserToken(ctx context.Context, tokenHash, purpose string) (models.UserToken, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	transaction, err := db.begin(ctx)
+	if err != nil {
+		return models.UserToken{}, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer transaction.Rollback()
+
+	query := "SELECT " + userTokenColumns + " FROM user_tokens WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND datetime(expires_at) > datetime(?)"
+	token, err := scanUserToken(transaction.QueryRowContext(ctx, query, tokenHash, purpose, now))
+	if err != nil {
+		return models.UserToken{}, err
+	}
+
+	result, err := transaction.ExecContext(ctx, "UPDATE user_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL", now, token.ID)
+	if err != nil {
+		return models.UserToken{}, fmt.Errorf("failed to consume user token: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return models.UserToken{}, sql.ErrNoRows
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return models.UserToken{}, fmt.Errorf("failed to commit user token: %v", err)
+	}
+	return token, nil
+}
+
+func (db *SQLiteDatabase) InvalidateUserTokens(ctx context.Context, userID int, purpose string) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, "UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL", time.Now().UTC().Format(time.RFC3339), userID, purpose)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate user tokens: %v", err)
+	}
+	return nil
+}
+
+func (db *SQLiteDatabase) CreateSession(ctx context.Context, session models.Session) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO sessions (user_id, refresh_token_hash, created_at, expires_at) VALUES (?, ?, ?, ?)"
+	result, err := db.querier().ExecContext(ctx, query, session.UserID, session.TokenHash, session.CreatedAt.UTC().Format(time.RFC3339), session.ExpiresAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create session: %v", err)
+	}
+
+	insertedID, _ := result.LastInsertId()
+	return int(insertedID), nil
+}
+
+func (db *SQLiteDatabase) GetSessionByID(ctx context.Context, sessionID int) (models.Session, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	return scanSession(db.querier().QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = ?", sessionID))
+}
+
+func (db *SQLiteDatabase) GetSessionByTokenHash(ctx context.Context, tokenHash string) (models.Session, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE refresh_token_hash = ? OR previous_token_hash = ?"
+	return scanSession(db.querier().QueryRowContext(ctx, query, tokenHash, tokenHash))
+}
+
+func (db *SQLiteDatabase) GetSessions(ctx context.Context, userID int) ([]models.Session, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + sessionColumns + " FROM sessions"
+	var parameters []interface{}
+	if userID != 0 {
+		query += " WHERE user_id = ?"
+		parameters = append(parameters, userID)
+	}
+
+	rows, err := db.querier().QueryContext(ctx, query+" ORDER BY id", parameters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %v", err)
+	}
+	defer rows.Close()
+
+	return scanSessions(rows)
+}
+
+func (db *SQLiteDatabase) RotateSessionToken(ctx context.Context, sessionID int, currentHash, newHash string, expiresAt time.Time) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE sessions SET previous_token_hash = refresh_token_hash, refresh_token_hash = ?, expires_at = ? WHERE id = ? AND refresh_token_hash = ? AND revoked_at IS NULL"
+	result, err := db.querier().ExecContext(ctx, query, newHash, expiresAt.UTC().Format(time.RFC3339), sessionID, currentHash)
+	if err != nil {
+		return fmt.Errorf("failed to rotate session token: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (db *SQLiteDatabase) RevokeSession(ctx context.Context, sessionID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.querier().ExecContext(ctx, "UPDATE sessions SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?", time.Now().UTC().Format(time.RFC3339), sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (db *SQLiteDatabase) RevokeUserSessions(ctx context.Context, userID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now().UTC().Format(time.RFC3339), userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %v", err)
+	}
+	return nil
+}
+
+func (db *SQLiteDatabase) CreateAPIKey(ctx context.Context, key models.APIKey) (int, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, created_at) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err := db.querier().ExecContext(ctx, query, key.UserID, key.Name, key.Prefix, key.KeyHash, strings.Join(key.Scopes, ","), key.CreatedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create API key: %v", err)
+	}
+
+	insertedID, _ := result.LastInsertId()
+	return int(insertedID), nil
+}
+
+func (db *SQLiteDatabase) GetAPIKeyByID(ctx context.Context, keyID int) (models.APIKey, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	return scanAPIKey(db.querier().QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", keyID))
+}
+
+func (db *SQLiteDatabase) GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	return scanAPIKey(db.querier().QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE prefix = ?", prefix))
+}
+
+func (db *SQLiteDatabase) GetAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + apiKeyColumns + " FROM api_keys"
+	var parameters []interface{}
+	if userID != 0 {
+		query += " WHERE user_id = ?"
+		parameters = append(parameters, userID)
+	}
+
+	rows, err := db.querier().QueryContext(ctx, query+" ORDER BY id", parameters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys: %v", err)
+	}
+	defer rows.Close()
+
+	return scanAPIKeys(rows)
+}
+
+func (db *SQLiteDatabase) TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.querier().ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", usedAt.UTC().Format(time.RFC3339), keyID)
+	if err != nil {
+		return fmt.Errorf("failed to update API key usage: %v", err)
+	}
+	return nil
+}
+
+func (db *SQLiteDatabase) RevokeAPIKey(ctx context.Context, keyID int) error {
+	ctx, cancel := db.Config.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.querier().ExecContext(ctx, "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?", time.Now().UTC().Format(time.RFC3339), keyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
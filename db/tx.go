@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// querier is implemented by *sql.DB, *sql.Conn and *sql.Tx, so the same
+// queries run inside and outside of WithTx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// dbTransaction is what the methods that need several statements to be
+// atomic work with: an *sql.Tx of their own, or the enclosing WithTx
+// transaction.
+type dbTransaction interface {
+	querier
+	Commit() error
+	Rollback() error
+}
+
+// joinedTransaction lets a method run in the enclosing WithTx transaction,
+// which is committed or rolled back by WithTx alone.
+type joinedTransaction struct {
+	querier
+}
+
+func (joinedTransaction) Commit() error {
+	return nil
+}
+
+func (joinedTransaction) Rollback() error {
+	return nil
+}
+
+// maxSerializationRetries is how often WithTx runs a Postgres transaction
+// that failed to serialize with a concurrent one.
+const maxSerializationRetries = 5
+
+// isSerializationFailure reports whether err is a Postgres serialization
+// failure or deadlock, after which the whole transaction can be retried.
+func isSerializationFailure(err error) bool {
+	var pqError *pq.Error
+	if !errors.As(err, &pqError) {
+		return false
+	}
+	return pqError.Code == "40001" || pqError.Code == "40P01"
+}
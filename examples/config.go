@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ozoli99/Kaida/db"
+)
+
+// databaseSettings is the JSON layout of the file named by KAIDA_DB_CONFIG.
+// Durations use time.ParseDuration syntax, e.g. "30s".
+type databaseSettings struct {
+	Driver           string `json:"driver"`
+	DSN              string `json:"dsn"`
+	MaxOpenConns     int    `json:"max_open_conns"`
+	MaxIdleConns     int    `json:"max_idle_conns"`
+	ConnMaxLifetime  string `json:"conn_max_lifetime"`
+	ConnMaxIdleTime  string `json:"conn_max_idle_time"`
+	StatementTimeout string `json:"statement_timeout"`
+	BusyTimeout      string `json:"busy_timeout"`
+	QueryTimeout     string `json:"query_timeout"`
+}
+
+// loadDatabaseSettings reads KAIDA_DB_CONFIG, if set, and overrides its
+// values with the matching KAIDA_DB_* environment variables.
+func loadDatabaseSettings() (databaseSettings, error) {
+	settings := databaseSettings{Driver: db.DialectSQLite}
+	if path := os.Getenv("KAIDA_DB_CONFIG"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return settings, fmt.Errorf("failed to read database config: %v", err)
+		}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return settings, fmt.Errorf("invalid database config: %v", err)
+		}
+	}
+
+	for name, target := range map[string]*string{
+		"KAIDA_DB_DRIVER":             &settings.Driver,
+		"KAIDA_DB_DSN":                &settings.DSN,
+		"KAIDA_DB_CONN_MAX_LIFETIME":  &settings.ConnMaxLifetime,
+		"KAIDA_DB_CONN_MAX_IDLE_TIME": &settings.ConnMaxIdleTime,
+		"KAIDA_DB_STATEMENT_TIMEOUT":  &settings.StatementTimeout,
+		"KAIDA_DB_BUSY_TIMEOUT":       &settings.BusyTimeout,
+		"KAIDA_DB_QUERY_TIMEOUT":      &settings.QueryTimeout,
+	} {
+		if value := os.Getenv(name); value != "" {
+			*target = value
+		}
+	}
+	for name, target := range map[string]*int{
+		"KAIDA_DB_MAX_OPEN_CONNS": &settings.MaxOpenConns,
+		"KAIDA_DB_MAX_IDLE_CONNS": &settings.MaxIdleConns,
+	} {
+		if value := os.Getenv(name); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return settings, fmt.Errorf("invalid %s: %v", name, err)
+			}
+			*target = number
+		}
+	}
+	return settings, nil
+}
+
+func (settings databaseSettings) config() (db.Config, error) {
+	config := db.Config{
+		DSN:          settings.DSN,
+		MaxOpenConns: settings.MaxOpenConns,
+		MaxIdleConns: settings.MaxIdleConns,
+	}
+	for _, duration := range []struct {
+		name   string
+		value  string
+		target *time.Duration
+	}{
+		{"conn_max_lifetime", settings.ConnMaxLifetime, &config.ConnMaxLifetime},
+		{"conn_max_idle_time", settings.ConnMaxIdleTime, &config.ConnMaxIdleTime},
+		{"statement_timeout", settings.StatementTimeout, &config.StatementTimeout},
+		{"busy_timeout", settings.BusyTimeout, &config.BusyTimeout},
+		{"query_timeout", settings.QueryTimeout, &config.QueryTimeout},
+	} {
+		if duration.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(duration.value)
+		if err != nil {
+			return config, fmt.Errorf("invalid %s: %v", duration.name, err)
+		}
+		*duration.target = parsed
+	}
+	return config, nil
+}
+
+// openDatabase connects to the database described by the KAIDA_DB_* settings.
+func openDatabase() (db.Database, error) {
+	settings, err := loadDatabaseSettings()
+	if err != nil {
+		return nil, err
+	}
+	config, err := settings.config()
+	if err != nil {
+		return nil, err
+	}
+
+	switch settings.Driver {
+		case db.DialectSQLite:
+			return db.NewSQLiteDatabase(config)
+		case db.DialectPostgres:
+			return db.NewPostgresDatabase(config)
+		default:
+			return nil, fmt.Errorf("unsupported database driver %q", settings.Driver)
+	}
+}
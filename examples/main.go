@@ -1,37 +1,52 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"log"
+	"os"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/ozoli99/Kaida/api"
-	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/mail"
 	"github.com/ozoli99/Kaida/service"
 )
 
 func main() {
-	var database db.Database
-	usePostgres := false
-
-	if usePostgres {
-		database = &db.PostgresDatabase{}
-	} else {
-		database = &db.SQLiteDatabase{}
-	}
-
-	if err := database.InitializeDatabase(); err != nil {
+	database, err := openDatabase()
+	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
-	svc := service.DefaultAppointmentService{Database: database}
+	authorizer := policy()
+	availabilityService := service.DefaultAvailabilityService{Database: database, Authorizer: authorizer}
+	svc := service.DefaultAppointmentService{Database: database, Availability: &availabilityService, Authorizer: authorizer}
+
+	userService := service.DefaultUserService{Database: database, Authorizer: authorizer, Mailer: mailer(), PasswordPolicy: passwordPolicy()}
+	bootstrapAdmin(&userService)
+	tokenService := service.DefaultTokenService{
+		Database:        database,
+		Key:             tokenKey(),
+		AccessTokenTTL:  durationFromEnv("KAIDA_ACCESS_TOKEN_TTL"),
+		RefreshTokenTTL: durationFromEnv("KAIDA_REFRESH_TOKEN_TTL"),
+		Authorizer:      authorizer,
+	}
+	apiKeyService := service.DefaultAPIKeyService{Database: database, Authorizer: authorizer}
 
 	webSocketServer := api.NewWebSocketServer()
 	api.StartWebSocketServer(webSocketServer, "8081")
 
 	httpServer := api.Server{
 		AppointmentService: &svc,
+		AvailabilityService: &availabilityService,
+		UserService: &userService,
+		TokenService: &tokenService,
+		APIKeyService: &apiKeyService,
 		WebSocketServer: webSocketServer,
 	}
 
+	httpServer.AddMiddleware(httpServer.AuthMiddleware)
 	httpServer.AddMiddleware(api.LoggingMiddleware)
 	httpServer.AddMiddleware(api.CORSMiddleware)
 
@@ -39,4 +54,89 @@ func main() {
 	if err := httpServer.StartServer("8080"); err != nil {
 		log.Fatalf("Failed to start HTTP server: %v", err)
 	}
-}
\ No newline at end of file
+}
+
+// tokenKey reads the token signing key from KAIDA_TOKEN_KEY. Without it a
+// random key is generated, which invalidates all tokens on restart.
+func tokenKey() []byte {
+	if key := os.Getenv("KAIDA_TOKEN_KEY"); key != "" {
+		return []byte(key)
+	}
+
+	log.Println("KAIDA_TOKEN_KEY is not set, using a random signing key")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatalf("Failed to generate signing key: %v", err)
+	}
+	return key
+}
+
+// bootstrapAdmin creates the first admin from KAIDA_ADMIN_EMAIL and
+// KAIDA_ADMIN_PASSWORD, since self-registration only creates customers.
+func bootstrapAdmin(userService *service.DefaultUserService) {
+	email, password := os.Getenv("KAIDA_ADMIN_EMAIL"), os.Getenv("KAIDA_ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		return
+	}
+
+	if _, err := userService.CreateInitialAdmin(context.Background(), "admin", email, password); err != nil {
+		log.Printf("Skipping admin bootstrap: %v", err)
+		return
+	}
+	log.Printf("Created admin %s", email)
+}
+
+// mailer writes outgoing mail to files in KAIDA_MAIL_DIR, or "outbox" when
+// it is not set.
+func mailer() mail.Mailer {
+	directory := os.Getenv("KAIDA_MAIL_DIR")
+	if directory == "" {
+		directory = "outbox"
+	}
+	return &mail.FileMailer{Directory: directory}
+}
+
+// policy loads the authorization rules from the JSON file named by
+// KAIDA_POLICY_FILE, falling back to service.DefaultPolicy.
+func policy() service.Authorizer {
+	path := os.Getenv("KAIDA_POLICY_FILE")
+	if path == "" {
+		return service.DefaultPolicy
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read policy file: %v", err)
+	}
+	policy, err := service.ParsePolicy(data)
+	if err != nil {
+		log.Fatalf("Invalid policy file: %v", err)
+	}
+	return policy
+}
+
+// passwordPolicy extends service.DefaultPasswordPolicy with the breached
+// password list named by KAIDA_BREACHED_PASSWORDS_FILE.
+func passwordPolicy() *service.PasswordPolicy {
+	policy := service.DefaultPasswordPolicy
+	if path := os.Getenv("KAIDA_BREACHED_PASSWORDS_FILE"); path != "" {
+		breached, err := service.LoadBreachedPasswords(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		policy.Breached = breached
+	}
+	return &policy
+}
+
+func durationFromEnv(name string) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return duration
+}
@@ -0,0 +1,81 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages to users. Production setups plug in an SMTP or
+// provider-backed implementation; MemoryMailer and FileMailer work offline.
+type Mailer interface {
+	Send(message Message) error
+}
+
+// MemoryMailer keeps sent messages in memory, which is useful in tests.
+type MemoryMailer struct {
+	mutex    sync.Mutex
+	messages []Message
+}
+
+var _ Mailer = (*MemoryMailer)(nil)
+
+func (mailer *MemoryMailer) Send(message Message) error {
+	mailer.mutex.Lock()
+	defer mailer.mutex.Unlock()
+	mailer.messages = append(mailer.messages, message)
+	return nil
+}
+
+// Messages returns the messages sent to recipient, oldest first.
+func (mailer *MemoryMailer) Messages(recipient string) []Message {
+	mailer.mutex.Lock()
+	defer mailer.mutex.Unlock()
+
+	var messages []Message
+	for _, message := range mailer.messages {
+		if message.To == recipient {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// FileMailer writes each message to its own file in Directory, for local
+// development without a mail server.
+type FileMailer struct {
+	Directory string
+}
+
+var _ Mailer = (*FileMailer)(nil)
+
+func (mailer *FileMailer) Send(message Message) error {
+	if err := os.MkdirAll(mailer.Directory, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %v", err)
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitizeFileName(message.To))
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", message.To, message.Subject, message.Body)
+	if err := os.WriteFile(filepath.Join(mailer.Directory, name), []byte(content), 0o600); err != nil {
+		return fmt.Errorf("failed to write mail: %v", err)
+	}
+	return nil
+}
+
+func sanitizeFileName(name string) string {
+	sanitized := []rune(name)
+	for i, character := range sanitized {
+		if !(character >= 'a' && character <= 'z' || character >= 'A' && character <= 'Z' || character >= '0' && character <= '9' || character == '.' || character == '@' || character == '-') {
+			sanitized[i] = '_'
+		}
+	}
+	return string(sanitized)
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	ScopeAppointmentsRead  = "appointments:read"
+	ScopeAppointmentsWrite = "appointments:write"
+	ScopeUsersManage       = "users:manage"
+)
+
+var Scopes = []string{ScopeAppointmentsRead, ScopeAppointmentsWrite, ScopeUsersManage}
+
+// APIKey lets a machine act as UserID without logging in. Only a SHA-256
+// digest of the secret is stored; Prefix is kept in clear text to look the key
+// up.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (key *APIKey) HasScope(scope string) bool {
+	for _, granted := range key.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		known := false
+		for _, candidate := range Scopes {
+			if scope == candidate {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("invalid scope %q", scope)
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -14,9 +15,19 @@ type Appointment struct {
 	RecurrenceRule string    `json:"recurrence_rules"`
 	Status         string    `json:"status"`
 	Resource       string    `json:"resource"`
+	TimeZone       string    `json:"time_zone"`
+	Site           string    `json:"site"`
 
 	CustomerID     int       `json:"customer_id"`
 	ProviderID     int       `json:"provider_id"`
+
+	SeriesID       int       `json:"series_id,omitempty"`
+
+	// SharedProvider and SharedResource exempt the appointment from the
+	// database's overlap guard when the conflict policy lets the provider or
+	// resource take more than one booking at a time.
+	SharedProvider bool      `json:"-"`
+	SharedResource bool      `json:"-"`
 }
 
 func (appointment *Appointment) Validate() error {
@@ -29,28 +40,67 @@ func (appointment *Appointment) Validate() error {
 	if appointment.Duration <= 0 {
 		return errors.New("duration must be greater than 0")
 	}
+	if appointment.Status != "" {
+		if err := ValidateStatus(appointment.Status); err != nil {
+			return err
+		}
+	}
+	if _, err := LoadLocation(appointment.TimeZone); err != nil {
+		return err
+	}
+	rule, err := ParseRecurrenceRule(appointment.RecurrenceRule)
+	if err != nil {
+		return fmt.Errorf("invalid recurrence rule: %v", err)
+	}
+	if rule != nil && len(rule.Occurrences(appointment.LocalTime(), time.Time{}, 1)) == 0 {
+		return errors.New("invalid recurrence rule: it never produces an occurrence")
+	}
 	return nil
 }
 
+// Location returns the zone the appointment is scheduled in, falling back to
+// UTC when none or an unknown zone is set.
+func (appointment *Appointment) Location() *time.Location {
+	location, err := LoadLocation(appointment.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// LocalTime returns the start time as wall-clock time in the appointment's zone.
+func (appointment *Appointment) LocalTime() time.Time {
+	return appointment.Time.In(appointment.Location())
+}
+
+func (appointment *Appointment) EndTime() time.Time {
+	return appointment.Time.Add(time.Duration(appointment.Duration) * time.Minute)
+}
+
+func (appointment *Appointment) IsCancelled() bool {
+	return appointment.Status == StatusCancelled
+}
+
+func (appointment *Appointment) IsRecurring() bool {
+	rule, err := ParseRecurrenceRule(appointment.RecurrenceRule)
+	return err == nil && rule != nil
+}
+
 func (appointment *Appointment) CalculateFutureOccurences(limit int) []time.Time {
-	if appointment.RecurrenceRule == "" {
+	rule, err := ParseRecurrenceRule(appointment.RecurrenceRule)
+	if err != nil || rule == nil {
 		return nil
 	}
 
 	var occurrences []time.Time
-	current := appointment.Time
-	for i := 0; i < limit; i++ {
-		switch appointment.RecurrenceRule {
-			case "daily":
-				current = current.AddDate(0, 0, 1)
-			case "weekly":
-				current = current.AddDate(0, 0, 7)
-			case "monthly":
-				current = current.AddDate(0, 1, 0)
-			default:
-				break
+	for _, occurrence := range rule.Occurrences(appointment.LocalTime(), time.Time{}, limit+1) {
+		if occurrence.Equal(appointment.Time) {
+			continue
+		}
+		if len(occurrences) == limit {
+			break
 		}
-		occurrences = append(occurrences, current)
+		occurrences = append(occurrences, occurrence)
 	}
 	return occurrences
 }
\ No newline at end of file
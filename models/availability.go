@@ -0,0 +1,332 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	clockLayout = "15:04"
+	dateLayout  = "2006-01-02"
+)
+
+type WorkingHours struct {
+	ID         int          `json:"id"`
+	ProviderID int          `json:"provider_id,omitempty"`
+	Resource   string       `json:"resource,omitempty"`
+	Weekday    time.Weekday `json:"weekday"`
+	StartTime  string       `json:"start_time"`
+	EndTime    string       `json:"end_time"`
+	TimeZone   string       `json:"time_zone"`
+}
+
+type AvailabilityOverride struct {
+	ID         int    `json:"id"`
+	ProviderID int    `json:"provider_id,omitempty"`
+	Resource   string `json:"resource,omitempty"`
+	Date       string `json:"date"`
+	Available  bool   `json:"available"`
+	StartTime  string `json:"start_time,omitempty"`
+	EndTime    string `json:"end_time,omitempty"`
+	TimeZone   string `json:"time_zone"`
+	Reason     string `json:"reason"`
+}
+
+type TimeRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (hours *WorkingHours) Validate() error {
+	if err := validateOwner(hours.ProviderID, hours.Resource); err != nil {
+		return err
+	}
+	if hours.Weekday < time.Sunday || hours.Weekday > time.Saturday {
+		return fmt.Errorf("invalid weekday %d", hours.Weekday)
+	}
+	if _, err := LoadLocation(hours.TimeZone); err != nil {
+		return err
+	}
+	return validateClockRange(hours.StartTime, hours.EndTime)
+}
+
+func (override *AvailabilityOverride) Validate() error {
+	if err := validateOwner(override.ProviderID, override.Resource); err != nil {
+		return err
+	}
+	if _, err := time.Parse(dateLayout, override.Date); err != nil {
+		return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", override.Date)
+	}
+	if _, err := LoadLocation(override.TimeZone); err != nil {
+		return err
+	}
+	if override.StartTime == "" && override.EndTime == "" {
+		if override.Available {
+			return errors.New("available overrides need a start and end time")
+		}
+		return nil
+	}
+	return validateClockRange(override.StartTime, override.EndTime)
+}
+
+func validateOwner(providerID int, resource string) error {
+	if (providerID == 0) == (resource == "") {
+		return errors.New("exactly one of provider_id or resource must be set")
+	}
+	return nil
+}
+
+func validateClockRange(start, end string) error {
+	startClock, err := time.Parse(clockLayout, start)
+	if err != nil {
+		return fmt.Errorf("invalid start time %q, expected HH:MM", start)
+	}
+	endClock, err := time.Parse(clockLayout, end)
+	if err != nil && end != "24:00" {
+		return fmt.Errorf("invalid end time %q, expected HH:MM", end)
+	}
+	if end != "24:00" && !endClock.After(startClock) {
+		return errors.New("end time must be after start time")
+	}
+	return nil
+}
+
+// AvailabilitySchedule combines the weekly template and date-specific
+// overrides of a single provider or resource.
+type AvailabilitySchedule struct {
+	WorkingHours []WorkingHours
+	Overrides    []AvailabilityOverride
+}
+
+// Restricted reports whether the schedule limits bookings at all. Owners
+// without working hours or overrides are bookable at any time.
+func (schedule *AvailabilitySchedule) Restricted() bool {
+	return len(schedule.WorkingHours) > 0 || len(schedule.Overrides) > 0
+}
+
+// Windows returns the merged bookable ranges between from and to. Without a
+// weekly template every day is open; an available override replaces the
+// template for its date, and an unavailable one closes its time range, or the
+// whole date when no times are given.
+func (schedule *AvailabilitySchedule) Windows(from, to time.Time) []TimeRange {
+	if !schedule.Restricted() {
+		return []TimeRange{{Start: from, End: to}}
+	}
+
+	var windows []TimeRange
+	first := from.UTC().AddDate(0, 0, -1)
+	last := to.UTC().AddDate(0, 0, 1)
+	for day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.UTC); !day.After(last); day = day.AddDate(0, 0, 1) {
+		windows = append(windows, schedule.windowsOn(day)...)
+	}
+
+	return clipRanges(mergeRanges(windows), from, to)
+}
+
+// Covers reports whether start..end lies entirely inside one bookable window.
+func (schedule *AvailabilitySchedule) Covers(start, end time.Time) bool {
+	for _, window := range schedule.Windows(start, end) {
+		if !window.Start.After(start) && !window.End.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+func (schedule *AvailabilitySchedule) windowsOn(day time.Time) []TimeRange {
+	date := day.Format(dateLayout)
+
+	var open []TimeRange
+	replaced := false
+	for _, override := range schedule.Overrides {
+		if override.Date == date && override.Available {
+			replaced = true
+			open = append(open, clockRange(day, override.StartTime, override.EndTime, override.TimeZone))
+		}
+	}
+
+	if !replaced {
+		if len(schedule.WorkingHours) == 0 {
+			open = append(open, clockRange(day, "00:00", "24:00", ""))
+		}
+		for _, hours := range schedule.WorkingHours {
+			if hours.Weekday == day.Weekday() {
+				open = append(open, clockRange(day, hours.StartTime, hours.EndTime, hours.TimeZone))
+			}
+		}
+	}
+
+	for _, override := range schedule.Overrides {
+		if override.Date != date || override.Available {
+			continue
+		}
+		closed := clockRange(day, "00:00", "24:00", override.TimeZone)
+		if override.StartTime != "" {
+			closed = clockRange(day, override.StartTime, override.EndTime, override.TimeZone)
+		}
+		open = subtractRange(open, closed)
+	}
+	return open
+}
+
+func clockRange(day time.Time, start, end, timeZone string) TimeRange {
+	location, err := LoadLocation(timeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	return TimeRange{
+		Start: onClock(day, start, location),
+		End:   onClock(day, end, location),
+	}
+}
+
+func onClock(day time.Time, clock string, location *time.Location) time.Time {
+	if clock == "24:00" {
+		return time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, location)
+	}
+	parsed, _ := time.Parse(clockLayout, clock)
+	return time.Date(day.Year(), day.Month(), day.Day(), parsed.Hour(), parsed.Minute(), 0, 0, location)
+}
+
+func subtractRange(ranges []TimeRange, removed TimeRange) []TimeRange {
+	var result []TimeRange
+	for _, current := range ranges {
+		if !removed.Start.Before(current.End) || !removed.End.After(current.Start) {
+			result = append(result, current)
+			continue
+		}
+		if current.Start.Before(removed.Start) {
+			result = append(result, TimeRange{Start: current.Start, End: removed.Start})
+		}
+		if current.End.After(removed.End) {
+			result = append(result, TimeRange{Start: removed.End, End: current.End})
+		}
+	}
+	return result
+}
+
+func mergeRanges(ranges []TimeRange) []TimeRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start.Before(ranges[j].Start) })
+
+	var merged []TimeRange
+	for _, current := range ranges {
+		if !current.End.After(current.Start) {
+			continue
+		}
+		if last := len(merged) - 1; last >= 0 && !current.Start.After(merged[last].End) {
+			if current.End.After(merged[last].End) {
+				merged[last].End = current.End
+			}
+			continue
+		}
+		merged = append(merged, current)
+	}
+	return merged
+}
+
+func clipRanges(ranges []TimeRange, from, to time.Time) []TimeRange {
+	var clipped []TimeRange
+	for _, current := range ranges {
+		if current.Start.Before(from) {
+			current.Start = from
+		}
+		if current.End.After(to) {
+			current.End = to
+		}
+		if current.End.After(current.Start) {
+			clipped = append(clipped, current)
+		}
+	}
+	return clipped
+}
+
+// maxSlotSearchWindow bounds how far a single slot search may look ahead.
+const maxSlotSearchWindow = 31 * 24 * time.Hour
+
+type SlotCriteria struct {
+	ProviderID    int       `json:"provider_id,omitempty"`
+	Resource      string    `json:"resource,omitempty"`
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	Duration      int       `json:"duration"`
+	Step          int       `json:"step,omitempty"`
+	BufferBefore  int       `json:"buffer_before,omitempty"`
+	BufferAfter   int       `json:"buffer_after,omitempty"`
+	PreferredTime time.Time `json:"preferred_time,omitempty"`
+	Limit         int       `json:"limit,omitempty"`
+}
+
+func (criteria *SlotCriteria) Validate() error {
+	if criteria.ProviderID == 0 && criteria.Resource == "" {
+		return errors.New("provider_id or resource is required")
+	}
+	if criteria.Duration <= 0 {
+		return errors.New("duration must be positive")
+	}
+	if criteria.Step < 0 || criteria.BufferBefore < 0 || criteria.BufferAfter < 0 || criteria.Limit < 0 {
+		return errors.New("step, buffers and limit cannot be negative")
+	}
+	if !criteria.To.After(criteria.From) {
+		return errors.New("end of the search window must be after its start")
+	}
+	if criteria.To.Sub(criteria.From) > maxSlotSearchWindow {
+		return fmt.Errorf("search window cannot exceed %d days", int(maxSlotSearchWindow.Hours()/24))
+	}
+	return nil
+}
+
+func (timeRange TimeRange) Overlaps(other TimeRange) bool {
+	return timeRange.Start.Before(other.End) && timeRange.End.After(other.Start)
+}
+
+// IntersectRanges returns the parts of a that are also covered by b.
+func IntersectRanges(a, b []TimeRange) []TimeRange {
+	var intersection []TimeRange
+	for _, first := range a {
+		for _, second := range b {
+			if !first.Overlaps(second) {
+				continue
+			}
+			overlap := first
+			if second.Start.After(overlap.Start) {
+				overlap.Start = second.Start
+			}
+			if second.End.Before(overlap.End) {
+				overlap.End = second.End
+			}
+			intersection = append(intersection, overlap)
+		}
+	}
+	return mergeRanges(intersection)
+}
+
+// FreeSlots cuts the busy ranges out of the open windows and returns every
+// slot of the given length that fits in what is left. Slot starts are aligned
+// to multiples of step from local midnight, so a 15 minute step yields slots
+// at :00, :15, :30 and :45 regardless of where a window begins.
+func FreeSlots(windows, busy []TimeRange, length, step time.Duration) []TimeRange {
+	free := mergeRanges(append([]TimeRange(nil), windows...))
+	for _, booked := range busy {
+		free = subtractRange(free, booked)
+	}
+
+	var slots []TimeRange
+	for _, window := range free {
+		for start := alignToStep(window.Start, step); !start.Add(length).After(window.End); start = start.Add(step) {
+			slots = append(slots, TimeRange{Start: start, End: start.Add(length)})
+		}
+	}
+	return slots
+}
+
+func alignToStep(t time.Time, step time.Duration) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	steps := offset / step
+	if offset%step != 0 {
+		steps++
+	}
+	return midnight.Add(steps * step)
+}
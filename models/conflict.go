@@ -0,0 +1,54 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type ConflictKind string
+
+const (
+	ConflictCustomer ConflictKind = "customer"
+	ConflictProvider ConflictKind = "provider"
+	ConflictResource ConflictKind = "resource"
+)
+
+// ConflictError reports that an appointment overlaps existing bookings of the
+// same customer, provider or resource. Match it with errors.As.
+type ConflictError struct {
+	Kind           ConflictKind `json:"kind"`
+	Time           time.Time    `json:"time"`
+	AppointmentIDs []int        `json:"appointment_ids"`
+	Suggestions    []TimeRange  `json:"suggestions,omitempty"`
+}
+
+func NewConflictError(kind ConflictKind, conflicting []Appointment) *ConflictError {
+	conflict := &ConflictError{Kind: kind, AppointmentIDs: []int{}}
+	seen := map[int]bool{}
+	for _, appointment := range conflicting {
+		id := appointment.ID
+		if id == 0 {
+			id = appointment.SeriesID
+		}
+		if !seen[id] {
+			seen[id] = true
+			conflict.AppointmentIDs = append(conflict.AppointmentIDs, id)
+		}
+	}
+	return conflict
+}
+
+func (conflict *ConflictError) Error() string {
+	ids := make([]string, len(conflict.AppointmentIDs))
+	for i, id := range conflict.AppointmentIDs {
+		ids[i] = fmt.Sprint(id)
+	}
+	if len(ids) == 0 {
+		return fmt.Sprintf("%s conflict: overlaps another appointment", conflict.Kind)
+	}
+	if conflict.Time.IsZero() {
+		return fmt.Sprintf("%s conflict: overlaps appointment %s", conflict.Kind, strings.Join(ids, ", "))
+	}
+	return fmt.Sprintf("%s conflict at %s: overlaps appointment %s", conflict.Kind, conflict.Time.UTC().Format(time.RFC3339), strings.Join(ids, ", "))
+}
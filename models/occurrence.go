@@ -0,0 +1,159 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	ExceptionSkip     = "skip"
+	ExceptionAdd      = "add"
+	ExceptionOverride = "override"
+)
+
+type OccurrenceException struct {
+	ID             int       `json:"id"`
+	AppointmentID  int       `json:"appointment_id"`
+	Type           string    `json:"type"`
+	OccurrenceTime time.Time `json:"occurrence_time"`
+	Time           time.Time `json:"time,omitempty"`
+	Duration       int       `json:"duration,omitempty"`
+	Resource       string    `json:"resource,omitempty"`
+	ProviderID     int       `json:"provider_id,omitempty"`
+	Notes          string    `json:"notes,omitempty"`
+}
+
+func (exception *OccurrenceException) Validate() error {
+	if exception.OccurrenceTime.IsZero() {
+		return errors.New("occurrence time cannot be empty")
+	}
+	if exception.Duration < 0 {
+		return errors.New("duration cannot be negative")
+	}
+
+	switch exception.Type {
+		case ExceptionSkip, ExceptionAdd:
+			return nil
+		case ExceptionOverride:
+			if exception.Time.IsZero() && exception.Duration == 0 && exception.Resource == "" && exception.ProviderID == 0 && exception.Notes == "" {
+				return errors.New("override must change at least one field")
+			}
+			return nil
+		default:
+			return fmt.Errorf("unknown exception type %q", exception.Type)
+	}
+}
+
+// IsOccurrence reports whether occurrenceTime is generated by the appointment's
+// recurrence rule, including the first occurrence at appointment.Time.
+func (appointment *Appointment) IsOccurrence(occurrenceTime time.Time) bool {
+	rule, err := ParseRecurrenceRule(appointment.RecurrenceRule)
+	if err != nil || rule == nil {
+		return false
+	}
+	for _, occurrence := range rule.Occurrences(appointment.LocalTime(), occurrenceTime, 0) {
+		if occurrence.Equal(occurrenceTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// OccurrencesBetween expands the series and returns every occurrence that
+// overlaps the window from..to, with exceptions applied.
+func (appointment *Appointment) OccurrencesBetween(from, to time.Time, exceptions []OccurrenceException) []Appointment {
+	rule, err := ParseRecurrenceRule(appointment.RecurrenceRule)
+	if err != nil || rule == nil {
+		return nil
+	}
+
+	horizon := to
+	for _, exception := range exceptions {
+		if exception.Type == ExceptionOverride && !exception.Time.IsZero() && exception.Time.Before(to) && exception.OccurrenceTime.After(horizon) {
+			horizon = exception.OccurrenceTime
+		}
+	}
+
+	var occurrences []Appointment
+	for _, occurrence := range appointment.ApplyExceptions(rule.Occurrences(appointment.LocalTime(), horizon, 0), exceptions) {
+		if occurrence.Time.Before(to) && occurrence.EndTime().After(from) {
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+	return occurrences
+}
+
+// ApplyExceptions turns generated occurrence times into appointment instances,
+// dropping skipped dates, adding extra dates and applying per-occurrence
+// overrides. The result is ordered by the (possibly overridden) start time.
+func (appointment *Appointment) ApplyExceptions(occurrences []time.Time, exceptions []OccurrenceException) []Appointment {
+	skipped := map[int64]bool{}
+	overrides := map[int64]OccurrenceException{}
+	for _, exception := range exceptions {
+		switch exception.Type {
+			case ExceptionSkip:
+				skipped[exception.OccurrenceTime.Unix()] = true
+			case ExceptionOverride:
+				overrides[exception.OccurrenceTime.Unix()] = exception
+			case ExceptionAdd:
+				occurrences = append(occurrences, exception.OccurrenceTime)
+		}
+	}
+
+	var instances []Appointment
+	seen := map[int64]bool{}
+	for _, occurrence := range occurrences {
+		key := occurrence.Unix()
+		if skipped[key] || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		instance := appointment.instanceAt(occurrence)
+		if override, exists := overrides[key]; exists {
+			override.applyTo(&instance)
+		}
+		instances = append(instances, instance)
+	}
+
+	sort.SliceStable(instances, func(i, j int) bool { return instances[i].Time.Before(instances[j].Time) })
+	return instances
+}
+
+// instanceAt returns the occurrence of the series at occurrence. It has no
+// recurrence rule of its own, SeriesID links it to the series.
+func (appointment *Appointment) instanceAt(occurrence time.Time) Appointment {
+	return Appointment{
+		SeriesID:     appointment.ID,
+		CustomerName: appointment.CustomerName,
+		Time:         occurrence,
+		Duration:     appointment.Duration,
+		Notes:        appointment.Notes,
+		Status:       appointment.Status,
+		Resource:     appointment.Resource,
+		CustomerID:   appointment.CustomerID,
+		ProviderID:   appointment.ProviderID,
+		TimeZone:     appointment.TimeZone,
+		Site:         appointment.Site,
+	}
+}
+
+func (exception *OccurrenceException) applyTo(instance *Appointment) {
+	if !exception.Time.IsZero() {
+		instance.Time = exception.Time
+	}
+	if exception.Duration > 0 {
+		instance.Duration = exception.Duration
+	}
+	if exception.Resource != "" {
+		instance.Resource = exception.Resource
+	}
+	if exception.ProviderID != 0 {
+		instance.ProviderID = exception.ProviderID
+	}
+	if exception.Notes != "" {
+		instance.Notes = exception.Notes
+	}
+}
@@ -0,0 +1,372 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	FrequencyDaily   Frequency = "DAILY"
+	FrequencyWeekly  Frequency = "WEEKLY"
+	FrequencyMonthly Frequency = "MONTHLY"
+	FrequencyYearly  Frequency = "YEARLY"
+)
+
+// maxRecurrencePeriods bounds how many FREQ periods are scanned during
+// expansion. maxIdleRecurrencePeriods bounds how many periods in a row may
+// pass without an occurrence, so a rule that can never match gives up early;
+// the longest gap of a satisfiable rule, e.g. FREQ=DAILY;BYMONTHDAY=31;BYDAY=MO,
+// is about 600 periods.
+const (
+	maxRecurrencePeriods     = 50000
+	maxIdleRecurrencePeriods = 1000
+)
+
+type WeekdayNum struct {
+	Weekday time.Weekday
+	N       int
+}
+
+type RecurrenceRule struct {
+	Frequency  Frequency
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	BySetPos   []int
+	Count      int
+	Until      time.Time
+	WeekStart  time.Weekday
+
+	floatingUntil bool
+}
+
+var recurrenceShorthands = map[string]Frequency{
+	"daily":   FrequencyDaily,
+	"weekly":  FrequencyWeekly,
+	"monthly": FrequencyMonthly,
+	"yearly":  FrequencyYearly,
+}
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// ParseRecurrenceRule parses an RFC 5545 RRULE value (with or without the
+// "RRULE:" prefix) or one of the "daily", "weekly", "monthly" and "yearly"
+// shorthands. An empty rule or "None" yields a nil rule.
+func ParseRecurrenceRule(value string) (*RecurrenceRule, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "none") {
+		return nil, nil
+	}
+
+	if frequency, exists := recurrenceShorthands[strings.ToLower(value)]; exists {
+		return &RecurrenceRule{Frequency: frequency, Interval: 1, WeekStart: time.Monday}, nil
+	}
+
+	if len(value) >= len("RRULE:") && strings.EqualFold(value[:len("RRULE:")], "RRULE:") {
+		value = value[len("RRULE:"):]
+	}
+
+	rule := &RecurrenceRule{Interval: 1, WeekStart: time.Monday}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+		key, val, found := strings.Cut(part, "=")
+		if !found || val == "" {
+			return nil, fmt.Errorf("malformed rule part %q", part)
+		}
+		key = strings.ToUpper(strings.TrimSpace(key))
+		val = strings.ToUpper(strings.TrimSpace(val))
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate rule part %s", key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+			case "FREQ":
+				rule.Frequency = Frequency(val)
+				switch rule.Frequency {
+					case FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyYearly:
+					default:
+						err = fmt.Errorf("unsupported frequency %q", val)
+				}
+			case "INTERVAL":
+				rule.Interval, err = parsePositiveInt(val)
+			case "COUNT":
+				rule.Count, err = parsePositiveInt(val)
+			case "UNTIL":
+				rule.Until, err = parseRuleTime(val)
+				rule.floatingUntil = !strings.HasSuffix(val, "Z")
+			case "WKST":
+				weekday, exists := weekdayCodes[val]
+				if !exists {
+					err = fmt.Errorf("invalid WKST %q", val)
+				}
+				rule.WeekStart = weekday
+			case "BYDAY":
+				rule.ByDay, err = parseByDay(val)
+			case "BYMONTHDAY":
+				rule.ByMonthDay, err = parseIntList(val, 31)
+			case "BYSETPOS":
+				rule.BySetPos, err = parseIntList(val, 366)
+			default:
+				err = fmt.Errorf("unsupported rule part %s", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := rule.validate(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (rule *RecurrenceRule) validate() error {
+	if rule.Frequency == "" {
+		return errors.New("FREQ is required")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return errors.New("COUNT and UNTIL cannot be combined")
+	}
+	for _, day := range rule.ByDay {
+		if day.N != 0 && rule.Frequency != FrequencyMonthly {
+			return fmt.Errorf("numeric BYDAY values are only supported with FREQ=%s", FrequencyMonthly)
+		}
+	}
+	if len(rule.ByMonthDay) > 0 && rule.Frequency == FrequencyWeekly {
+		return fmt.Errorf("BYMONTHDAY cannot be used with FREQ=%s", FrequencyWeekly)
+	}
+	if rule.Frequency == FrequencyYearly && (len(rule.ByDay) > 0 || len(rule.ByMonthDay) > 0 || len(rule.BySetPos) > 0) {
+		return fmt.Errorf("BYDAY, BYMONTHDAY and BYSETPOS are not supported with FREQ=%s", FrequencyYearly)
+	}
+	if len(rule.BySetPos) > 0 && len(rule.ByDay) == 0 && len(rule.ByMonthDay) == 0 {
+		return errors.New("BYSETPOS requires BYDAY or BYMONTHDAY")
+	}
+	return nil
+}
+
+// Occurrences expands the rule starting at start, returning every occurrence
+// up to and including until (zero means unbounded), capped at limit entries
+// (zero means unlimited). COUNT and UNTIL of the rule itself always apply.
+// Occurrences keep the wall-clock time of start in start's location, so a
+// series stays at the same local time across DST transitions. An UNTIL
+// without a trailing "Z" is interpreted in that location as well.
+func (rule *RecurrenceRule) Occurrences(start, until time.Time, limit int) []time.Time {
+	ruleUntil := rule.Until
+	if rule.floatingUntil {
+		ruleUntil = time.Date(ruleUntil.Year(), ruleUntil.Month(), ruleUntil.Day(), ruleUntil.Hour(), ruleUntil.Minute(), ruleUntil.Second(), ruleUntil.Nanosecond(), start.Location())
+	}
+
+	var occurrences []time.Time
+	generated, idle := 0, 0
+	for period := 0; period < maxRecurrencePeriods && idle < maxIdleRecurrencePeriods; period++ {
+		idle++
+		for _, candidate := range rule.expandPeriod(start, period) {
+			if candidate.Before(start) {
+				continue
+			}
+			idle = 0
+			if !ruleUntil.IsZero() && candidate.After(ruleUntil) {
+				return occurrences
+			}
+			if !until.IsZero() && candidate.After(until) {
+				return occurrences
+			}
+
+			occurrences = append(occurrences, candidate)
+			generated++
+			if rule.Count > 0 && generated >= rule.Count {
+				return occurrences
+			}
+			if limit > 0 && len(occurrences) >= limit {
+				return occurrences
+			}
+		}
+	}
+	return occurrences
+}
+
+func (rule *RecurrenceRule) expandPeriod(start time.Time, period int) []time.Time {
+	year, month, day := start.Date()
+	step := period * rule.Interval
+
+	var days []time.Time
+	switch rule.Frequency {
+		case FrequencyDaily:
+			candidate := rule.onDay(start, year, month, day+step)
+			if rule.matchesByDay(candidate) && rule.matchesByMonthDay(candidate) {
+				days = append(days, candidate)
+			}
+		case FrequencyWeekly:
+			offset := (int(start.Weekday()) - int(rule.WeekStart) + 7) % 7
+			weekStart := day - offset + step*7
+			for i := 0; i < 7; i++ {
+				candidate := rule.onDay(start, year, month, weekStart+i)
+				if len(rule.ByDay) == 0 {
+					if candidate.Weekday() == start.Weekday() {
+						days = append(days, candidate)
+					}
+				} else if rule.matchesByDay(candidate) {
+					days = append(days, candidate)
+				}
+			}
+		case FrequencyMonthly:
+			first := time.Date(year, month+time.Month(step), 1, 0, 0, 0, 0, start.Location())
+			for i := 1; i <= daysIn(first.Year(), first.Month()); i++ {
+				candidate := rule.onDay(start, first.Year(), first.Month(), i)
+				if len(rule.ByDay) == 0 && len(rule.ByMonthDay) == 0 {
+					if i == day {
+						days = append(days, candidate)
+					}
+				} else if rule.matchesByDay(candidate) && rule.matchesByMonthDay(candidate) {
+					days = append(days, candidate)
+				}
+			}
+		case FrequencyYearly:
+			if day <= daysIn(year+step, month) {
+				days = append(days, rule.onDay(start, year+step, month, day))
+			}
+	}
+
+	if len(rule.BySetPos) == 0 {
+		return days
+	}
+
+	var selected []time.Time
+	for _, position := range rule.BySetPos {
+		index := position - 1
+		if position < 0 {
+			index = len(days) + position
+		}
+		if index >= 0 && index < len(days) {
+			selected = append(selected, days[index])
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Before(selected[j]) })
+	return dedupeTimes(selected)
+}
+
+func (rule *RecurrenceRule) onDay(start time.Time, year int, month time.Month, day int) time.Time {
+	hour, minute, second := start.Clock()
+	return time.Date(year, month, day, hour, minute, second, start.Nanosecond(), start.Location())
+}
+
+func (rule *RecurrenceRule) matchesByDay(candidate time.Time) bool {
+	if len(rule.ByDay) == 0 {
+		return true
+	}
+	day := candidate.Day()
+	total := daysIn(candidate.Year(), candidate.Month())
+	fromStart := (day-1)/7 + 1
+	fromEnd := -((total-day)/7 + 1)
+	for _, byDay := range rule.ByDay {
+		if byDay.Weekday != candidate.Weekday() {
+			continue
+		}
+		if byDay.N == 0 || byDay.N == fromStart || byDay.N == fromEnd {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *RecurrenceRule) matchesByMonthDay(candidate time.Time) bool {
+	if len(rule.ByMonthDay) == 0 {
+		return true
+	}
+	day := candidate.Day()
+	total := daysIn(candidate.Year(), candidate.Month())
+	for _, monthDay := range rule.ByMonthDay {
+		if monthDay == day || (monthDay < 0 && total+monthDay+1 == day) {
+			return true
+		}
+	}
+	return false
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func dedupeTimes(times []time.Time) []time.Time {
+	var result []time.Time
+	for i, t := range times {
+		if i == 0 || !t.Equal(times[i-1]) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func parsePositiveInt(value string) (int, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid positive integer %q", value)
+	}
+	return number, nil
+}
+
+func parseIntList(value string, max int) ([]int, error) {
+	var numbers []int
+	for _, item := range strings.Split(value, ",") {
+		number, err := strconv.Atoi(item)
+		if err != nil || number == 0 || number > max || number < -max {
+			return nil, fmt.Errorf("invalid value %q", item)
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
+func parseByDay(value string) ([]WeekdayNum, error) {
+	var days []WeekdayNum
+	for _, item := range strings.Split(value, ",") {
+		if len(item) < 2 {
+			return nil, fmt.Errorf("invalid BYDAY value %q", item)
+		}
+		weekday, exists := weekdayCodes[item[len(item)-2:]]
+		if !exists {
+			return nil, fmt.Errorf("invalid BYDAY value %q", item)
+		}
+		day := WeekdayNum{Weekday: weekday}
+		if prefix := item[:len(item)-2]; prefix != "" {
+			n, err := strconv.Atoi(prefix)
+			if err != nil || n == 0 || n > 5 || n < -5 {
+				return nil, fmt.Errorf("invalid BYDAY value %q", item)
+			}
+			day.N = n
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+func parseRuleTime(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				parsed = parsed.Add(24*time.Hour - time.Nanosecond)
+			}
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+}
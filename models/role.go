@@ -0,0 +1,37 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	RoleAdmin        = "admin"
+	RoleProvider     = "provider"
+	RoleCustomer     = "customer"
+	RoleReceptionist = "receptionist"
+	RoleAuditor      = "auditor"
+)
+
+var Roles = []string{RoleAdmin, RoleProvider, RoleCustomer, RoleReceptionist, RoleAuditor}
+
+// RoleChange records a role being assigned to a user. FromRole is empty when
+// the role was assigned at creation.
+type RoleChange struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	FromRole  string    `json:"from_role"`
+	ToRole    string    `json:"to_role"`
+	ActorID   int       `json:"actor_id"`
+	ChangedAt time.Time `json:"changed_at"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+func ValidateRole(role string) error {
+	for _, known := range Roles {
+		if role == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown role %q", role)
+}
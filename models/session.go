@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Session is a signed-in device. Only hashes of its refresh tokens are stored;
+// PreviousTokenHash keeps the token replaced by the last rotation so reuse of
+// a stolen token can be detected.
+type Session struct {
+	ID                int        `json:"id"`
+	UserID            int        `json:"user_id"`
+	TokenHash         string     `json:"-"`
+	PreviousTokenHash string     `json:"-"`
+	CreatedAt         time.Time  `json:"created_at"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (session *Session) Active(now time.Time) bool {
+	return session.RevokedAt == nil && now.Before(session.ExpiresAt)
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	StatusRequested   = "Requested"
+	StatusConfirmed   = "Confirmed"
+	StatusCheckedIn   = "CheckedIn"
+	StatusInProgress  = "InProgress"
+	StatusCompleted   = "Completed"
+	StatusCancelled   = "Cancelled"
+	StatusNoShow      = "NoShow"
+	StatusRescheduled = "Rescheduled"
+
+	// StatusScheduled is the status used before the lifecycle was introduced.
+	// It is still accepted and means the same as StatusConfirmed.
+	StatusScheduled = "Scheduled"
+)
+
+var Statuses = []string{
+	StatusRequested,
+	StatusConfirmed,
+	StatusCheckedIn,
+	StatusInProgress,
+	StatusCompleted,
+	StatusCancelled,
+	StatusNoShow,
+	StatusRescheduled,
+}
+
+type StatusChange struct {
+	ID            int       `json:"id"`
+	AppointmentID int       `json:"appointment_id"`
+	FromStatus    string    `json:"from_status"`
+	ToStatus      string    `json:"to_status"`
+	ActorID       int       `json:"actor_id"`
+	ActorRole     string    `json:"actor_role"`
+	ChangedAt     time.Time `json:"changed_at"`
+	Reason        string    `json:"reason,omitempty"`
+}
+
+// NormalizeStatus maps the legacy Scheduled status to Confirmed and leaves
+// every other status unchanged.
+func NormalizeStatus(status string) string {
+	if status == StatusScheduled {
+		return StatusConfirmed
+	}
+	return status
+}
+
+func ValidateStatus(status string) error {
+	status = NormalizeStatus(status)
+	for _, known := range Statuses {
+		if status == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status %q", status)
+}
@@ -1,9 +1,41 @@
 package models
 
+import (
+	"fmt"
+	"time"
+)
+
 type User struct {
 	ID       int    `json:"id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Password string `json:"-"`
 	Role     string `json:"role"`
-}
\ No newline at end of file
+	TimeZone string `json:"time_zone"`
+	Site     string `json:"site"`
+
+	EmailVerified bool `json:"email_verified"`
+
+	FailedLogins int       `json:"-"`
+	LockedUntil  time.Time `json:"-"`
+}
+
+func (user *User) Location() *time.Location {
+	location, err := LoadLocation(user.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// LoadLocation resolves an IANA zone name, treating an empty name as UTC.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q", name)
+	}
+	return location, nil
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+)
+
+// UserToken is a single-use token mailed to a user to prove they control
+// their email address. Only a hash of the token is stored.
+type UserToken struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Purpose   string    `json:"purpose"`
+	TokenHash string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UsedAt    time.Time `json:"used_at,omitempty"`
+}
@@ -0,0 +1,14 @@
+package service
+
+import (
+	"context"
+
+	"github.com/ozoli99/Kaida/models"
+)
+
+type APIKeyService interface {
+	CreateAPIKey(ctx context.Context, currentUser *models.User, userID int, name string, scopes []string) (models.APIKey, string, error)
+	AuthenticateAPIKey(ctx context.Context, key string) (*models.User, models.APIKey, error)
+	GetAPIKeys(ctx context.Context, currentUser *models.User, userID int) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, currentUser *models.User, keyID int) error
+}
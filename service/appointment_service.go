@@ -1,23 +1,43 @@
 package service
 
-import "github.com/ozoli99/Kaida/models"
+import (
+	"context"
+	"time"
+
+	"github.com/ozoli99/Kaida/models"
+)
 
 type AppointmentReader interface {
-	GetAllAppointments(currentUser *models.User, limit, offset int, filters map[string]interface{}, sort string) ([]models.Appointment, error)
-	GetAppointmentByID(appointmentID int) (models.Appointment, error)
+	GetAllAppointments(ctx context.Context, currentUser *models.User, limit, offset int, filters map[string]interface{}, sort string) ([]models.Appointment, error)
+	GetAppointmentByID(ctx context.Context, appointmentID int) (models.Appointment, error)
+	GetStatusHistory(ctx context.Context, currentUser *models.User, appointmentID int) ([]models.StatusChange, error)
 }
 
 type AppointmentWriter interface {
-	CreateAppointment(currentUser *models.User, appointment models.Appointment) (int, error)
-	UpdateAppointment(currentUser *models.User, appointment models.Appointment) error
-	UpdateAppointmentStatus(appointmentID int, status string) error
-	DeleteAppointment(currentUser *models.User, appointmentID int) error
+	CreateAppointment(ctx context.Context, currentUser *models.User, appointment models.Appointment) (int, error)
+	UpdateAppointment(ctx context.Context, currentUser *models.User, appointment models.Appointment) error
+	ChangeAppointmentStatus(ctx context.Context, currentUser *models.User, appointmentID int, status, reason string) error
+	DeleteAppointment(ctx context.Context, currentUser *models.User, appointmentID int) error
+}
+
+type OccurrenceManager interface {
+	GetOccurrences(ctx context.Context, currentUser *models.User, appointmentID int, from, to time.Time) ([]models.Appointment, error)
+	GetOccurrenceExceptions(ctx context.Context, currentUser *models.User, appointmentID int) ([]models.OccurrenceException, error)
+	CreateOccurrenceException(ctx context.Context, currentUser *models.User, exception models.OccurrenceException) (int, error)
+	DeleteOccurrenceException(ctx context.Context, currentUser *models.User, appointmentID, exceptionID int) error
+}
+
+type SlotFinder interface {
+	FindAvailableSlots(ctx context.Context, currentUser *models.User, criteria models.SlotCriteria) ([]models.TimeRange, error)
+	SuggestAlternativeTimes(ctx context.Context, currentUser *models.User, appointment models.Appointment, count int) ([]models.TimeRange, error)
 }
 
 type AppointmentService interface {
 	AppointmentReader
 	AppointmentWriter
+	OccurrenceManager
+	SlotFinder
 	
-	CheckForConflict(appointment models.Appointment) error
-	GetFutureOccurrences(limit int) ([]models.Appointment, error)
+	CheckForConflict(ctx context.Context, appointment models.Appointment) error
+	ExpandOccurrences(ctx context.Context, currentUser *models.User, from, to time.Time) ([]models.Appointment, error)
 }
\ No newline at end of file
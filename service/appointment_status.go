@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ozoli99/Kaida/models"
+)
+
+var ErrInvalidStatusTransition = errors.New("invalid status transition")
+
+// statusTransitions lists the statuses each status may move to. Completed and
+// NoShow are final.
+var statusTransitions = map[string][]string{
+	models.StatusRequested:   {models.StatusConfirmed, models.StatusCancelled, models.StatusRescheduled},
+	models.StatusConfirmed:   {models.StatusCheckedIn, models.StatusInProgress, models.StatusCompleted, models.StatusCancelled, models.StatusNoShow, models.StatusRescheduled},
+	models.StatusCheckedIn:   {models.StatusInProgress, models.StatusCompleted, models.StatusCancelled, models.StatusNoShow},
+	models.StatusInProgress:  {models.StatusCompleted},
+	models.StatusRescheduled: {models.StatusRequested, models.StatusConfirmed, models.StatusCancelled},
+	models.StatusCancelled:   {models.StatusRequested, models.StatusConfirmed},
+}
+
+func canTransition(from, to string) bool {
+	return containsStatus(statusTransitions[models.NormalizeStatus(from)], models.NormalizeStatus(to))
+}
+
+func containsStatus(statuses []string, status string) bool {
+	for _, candidate := range statuses {
+		if candidate == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (service *DefaultAppointmentService) ChangeAppointmentStatus(ctx context.Context, user *models.User, appointmentID int, status, reason string) error {
+	appointment, err := service.Database.GetAppointmentByID(ctx, appointmentID)
+	if err != nil {
+		return err
+	}
+
+	if err := service.authorizer().Authorize(user, StatusAction(status), ResourceAppointment, AppointmentTarget(appointment)); err != nil {
+		return fmt.Errorf("%w: %s cannot set status %s on this appointment", ErrUnauthorized, user.Role, status)
+	}
+
+	return service.changeStatus(ctx, user, appointment.ID, status, reason)
+}
+
+func (service *DefaultAppointmentService) GetStatusHistory(ctx context.Context, user *models.User, appointmentID int) ([]models.StatusChange, error) {
+	appointment, err := service.Database.GetAppointmentByID(ctx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.authorizeRead(user, appointment); err != nil {
+		return nil, err
+	}
+
+	return service.Database.GetStatusHistory(ctx, appointmentID)
+}
+
+// changeStatus validates the transition, re-checks conflicts under the
+// current conflict policy when a cancelled appointment is reactivated and
+// records the change in the status history.
+// The appointment is read again inside the transaction, so two concurrent
+// transitions cannot both start from the same status.
+func (service *DefaultAppointmentService) changeStatus(ctx context.Context, actor *models.User, appointmentID int, status, reason string) error {
+	if err := models.ValidateStatus(status); err != nil {
+		return err
+	}
+
+	var reactivated models.Appointment
+	err := service.inTx(ctx, func(transactional *DefaultAppointmentService) error {
+		appointment, err := transactional.Database.GetAppointmentByID(ctx, appointmentID)
+		if err != nil {
+			return err
+		}
+
+		from, to := models.NormalizeStatus(appointment.Status), models.NormalizeStatus(status)
+		if !canTransition(from, to) {
+			return fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, from, to)
+		}
+
+		if appointment.IsCancelled() {
+			reactivated = appointment
+			reactivated.Status = to
+			transactional.conflictPolicy().markShared(&reactivated)
+			if err := transactional.checkConflict(ctx, reactivated); err != nil {
+				return err
+			}
+
+			// The stored flags date from the last write and may follow an
+			// older policy, so they are refreshed while the appointment is
+			// still cancelled and the guards ignore it.
+			flagged := reactivated
+			flagged.Status = appointment.Status
+			if err := transactional.Database.UpdateAppointment(ctx, flagged); err != nil {
+				return err
+			}
+		}
+
+		_, err = transactional.Database.ChangeAppointmentStatus(ctx, models.StatusChange{
+			AppointmentID: appointment.ID,
+			FromStatus:    from,
+			ToStatus:      to,
+			ActorID:       actor.ID,
+			ActorRole:     actor.Role,
+			ChangedAt:     time.Now().UTC(),
+			Reason:        reason,
+		})
+		return err
+	})
+	return service.explainConflict(ctx, err, reactivated)
+}
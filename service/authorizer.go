@@ -0,0 +1,250 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ozoli99/Kaida/models"
+)
+
+const (
+	ActionRead   = "read"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	// ActionImport allows creating appointments in any status, bypassing the
+	// usual Requested/Confirmed starting point.
+	ActionImport = "import"
+	// ActionAssignRole allows giving a user a role other than customer.
+	ActionAssignRole = "assign_role"
+)
+
+const (
+	ResourceAppointment  = "appointment"
+	ResourceAvailability = "availability"
+	ResourceSession      = "session"
+	ResourceAPIKey       = "api_key"
+	ResourceUser         = "user"
+	ResourceRoleChange   = "role_change"
+)
+
+// Wildcard matches any role, action or resource in a Rule.
+const Wildcard = "*"
+
+// StatusAction is the action of moving an appointment to status.
+func StatusAction(status string) string {
+	return "status:" + models.NormalizeStatus(status)
+}
+
+// Condition restricts a rule to targets related to the acting user.
+type Condition string
+
+const (
+	ConditionAny      Condition = ""
+	ConditionCustomer Condition = "customer"
+	ConditionProvider Condition = "provider"
+	ConditionSelf     Condition = "self"
+	ConditionSite     Condition = "site"
+)
+
+// Target describes the object an action is performed on. Only the fields
+// that apply to the resource are set.
+type Target struct {
+	CustomerID int
+	ProviderID int
+	UserID     int
+	Site       string
+}
+
+func AppointmentTarget(appointment models.Appointment) Target {
+	return Target{CustomerID: appointment.CustomerID, ProviderID: appointment.ProviderID, Site: appointment.Site}
+}
+
+// Authorizer decides whether a user may perform an action on a resource.
+type Authorizer interface {
+	Authorize(user *models.User, action, resource string, target Target) error
+	// Filters returns the listing filters that restrict resource to the
+	// targets user may perform action on. An empty map means no restriction.
+	Filters(user *models.User, action, resource string) (map[string]interface{}, error)
+}
+
+// Rule grants Role permission to perform Action on Resource when Condition
+// holds. Role, Action and Resource may be Wildcard.
+type Rule struct {
+	Role      string    `json:"role"`
+	Action    string    `json:"action"`
+	Resource  string    `json:"resource"`
+	Condition Condition `json:"condition,omitempty"`
+}
+
+// Policy is an Authorizer made of allow rules. Anything not granted by a rule
+// is denied, including every action of an unknown role.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+var _ Authorizer = (*Policy)(nil)
+
+// ParsePolicy reads a policy from JSON of the form {"rules": [...]}.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %v", err)
+	}
+	for _, rule := range policy.Rules {
+		if rule.Role == "" || rule.Action == "" || rule.Resource == "" {
+			return nil, fmt.Errorf("policy rule %+v needs a role, an action and a resource", rule)
+		}
+		switch rule.Condition {
+			case ConditionAny, ConditionCustomer, ConditionProvider, ConditionSelf, ConditionSite:
+			default:
+				return nil, fmt.Errorf("unknown policy condition %q", rule.Condition)
+		}
+	}
+	return &policy, nil
+}
+
+func (policy *Policy) Authorize(user *models.User, action, resource string, target Target) error {
+	for _, rule := range policy.matching(user, action, resource) {
+		if rule.Condition.holds(user, target) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s cannot %s this %s", ErrUnauthorized, user.Role, action, resource)
+}
+
+// Filters uses the first matching rule; a role granted the same action under
+// several conditions is only given the listing filter of the first one.
+func (policy *Policy) Filters(user *models.User, action, resource string) (map[string]interface{}, error) {
+	rules := policy.matching(user, action, resource)
+	for _, rule := range rules {
+		if rule.Condition == ConditionAny {
+			return map[string]interface{}{}, nil
+		}
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%w: %s cannot %s %s", ErrUnauthorized, user.Role, action, resource)
+	}
+	return rules[0].Condition.filters(user), nil
+}
+
+func (policy *Policy) matching(user *models.User, action, resource string) []Rule {
+	var rules []Rule
+	for _, rule := range policy.Rules {
+		if matchesRule(rule.Role, user.Role) && matchesRule(rule.Action, action) && matchesRule(rule.Resource, resource) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func matchesRule(pattern, value string) bool {
+	return pattern == Wildcard || pattern == value
+}
+
+func (condition Condition) holds(user *models.User, target Target) bool {
+	switch condition {
+		case ConditionAny:
+			return true
+		case ConditionCustomer:
+			return target.CustomerID == user.ID
+		case ConditionProvider:
+			return target.ProviderID == user.ID
+		case ConditionSelf:
+			return target.UserID == user.ID
+		case ConditionSite:
+			return user.Site != "" && target.Site == user.Site
+		default:
+			return false
+	}
+}
+
+func (condition Condition) filters(user *models.User) map[string]interface{} {
+	switch condition {
+		case ConditionCustomer:
+			return map[string]interface{}{"customer_id": user.ID}
+		case ConditionProvider:
+			return map[string]interface{}{"provider_id": user.ID}
+		case ConditionSelf:
+			return map[string]interface{}{"user_id": user.ID}
+		case ConditionSite:
+			return map[string]interface{}{"site": user.Site}
+		default:
+			return map[string]interface{}{}
+	}
+}
+
+// DefaultPolicy is used when a service has no Authorizer. Admins may do
+// anything; customers and providers manage their own appointments;
+// receptionists manage every appointment at their site but not users or
+// availability; auditors may read every appointment and role change.
+// Everyone manages their own profile, sessions and API keys.
+var DefaultPolicy = &Policy{Rules: concatRules(
+	[]Rule{{Role: models.RoleAdmin, Action: Wildcard, Resource: Wildcard}},
+	crudRules(models.RoleCustomer, ResourceAppointment, ConditionCustomer),
+	statusRules(models.RoleCustomer, ConditionCustomer, models.StatusRequested, models.StatusCancelled, models.StatusRescheduled),
+	crudRules(models.RoleProvider, ResourceAppointment, ConditionProvider),
+	statusRules(models.RoleProvider, ConditionProvider, models.StatusConfirmed, models.StatusCheckedIn, models.StatusInProgress, models.StatusCompleted, models.StatusCancelled, models.StatusNoShow, models.StatusRescheduled),
+	crudRules(models.RoleProvider, ResourceAvailability, ConditionProvider),
+	crudRules(models.RoleReceptionist, ResourceAppointment, ConditionSite),
+	statusRules(models.RoleReceptionist, ConditionSite, models.Statuses...),
+	[]Rule{
+		{Role: models.RoleAuditor, Action: ActionRead, Resource: ResourceAppointment},
+		{Role: models.RoleAuditor, Action: ActionRead, Resource: ResourceRoleChange},
+	},
+	[]Rule{
+		{Role: Wildcard, Action: ActionRead, Resource: ResourceUser, Condition: ConditionSelf},
+		{Role: Wildcard, Action: ActionUpdate, Resource: ResourceUser, Condition: ConditionSelf},
+	},
+	crudRules(Wildcard, ResourceSession, ConditionSelf),
+	crudRules(Wildcard, ResourceAPIKey, ConditionSelf),
+)}
+
+func crudRules(role, resource string, condition Condition) []Rule {
+	var rules []Rule
+	for _, action := range []string{ActionRead, ActionCreate, ActionUpdate, ActionDelete} {
+		rules = append(rules, Rule{Role: role, Action: action, Resource: resource, Condition: condition})
+	}
+	return rules
+}
+
+func statusRules(role string, condition Condition, statuses ...string) []Rule {
+	var rules []Rule
+	for _, status := range statuses {
+		rules = append(rules, Rule{Role: role, Action: StatusAction(status), Resource: ResourceAppointment, Condition: condition})
+	}
+	return rules
+}
+
+func concatRules(groups ...[]Rule) []Rule {
+	var rules []Rule
+	for _, group := range groups {
+		rules = append(rules, group...)
+	}
+	return rules
+}
+
+// listOwner resolves which user's resources a listing covers. A zero
+// userID lists everything user may read, which is either their own resources
+// or, without a condition, everyone's (zero again).
+func listOwner(authorizer Authorizer, user *models.User, resource string, userID int) (int, error) {
+	if userID != 0 {
+		return userID, authorizer.Authorize(user, ActionRead, resource, Target{UserID: userID})
+	}
+
+	filters, err := authorizer.Filters(user, ActionRead, resource)
+	if err != nil {
+		return 0, err
+	}
+	if owner, ok := filters["user_id"].(int); ok {
+		return owner, nil
+	}
+	return 0, nil
+}
+
+func authorizerOrDefault(authorizer Authorizer) Authorizer {
+	if authorizer == nil {
+		return DefaultPolicy
+	}
+	return authorizer
+}
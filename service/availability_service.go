@@ -0,0 +1,21 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/ozoli99/Kaida/models"
+)
+
+type AvailabilityService interface {
+	GetWorkingHours(ctx context.Context, currentUser *models.User, providerID int, resource string) ([]models.WorkingHours, error)
+	CreateWorkingHours(ctx context.Context, currentUser *models.User, hours models.WorkingHours) (int, error)
+	DeleteWorkingHours(ctx context.Context, currentUser *models.User, hoursID int) error
+
+	GetAvailabilityOverrides(ctx context.Context, currentUser *models.User, providerID int, resource string) ([]models.AvailabilityOverride, error)
+	CreateAvailabilityOverride(ctx context.Context, currentUser *models.User, override models.AvailabilityOverride) (int, error)
+	DeleteAvailabilityOverride(ctx context.Context, currentUser *models.User, overrideID int) error
+
+	GetSchedule(ctx context.Context, providerID int, resource string, from, to time.Time) (models.AvailabilitySchedule, error)
+	CheckAvailability(ctx context.Context, appointment models.Appointment) error
+}
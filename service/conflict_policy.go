@@ -0,0 +1,101 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ozoli99/Kaida/models"
+)
+
+// ConflictPolicy sets how many overlapping active appointments a customer,
+// provider or resource accepts at the same time. A capacity of zero disables
+// conflict checking for that dimension. ResourceCapacities overrides
+// ResourceCapacity for individual resources, e.g. a group room.
+type ConflictPolicy struct {
+	CustomerCapacity   int
+	ProviderCapacity   int
+	ResourceCapacity   int
+	ResourceCapacities map[string]int
+}
+
+var DefaultConflictPolicy = ConflictPolicy{
+	CustomerCapacity: 1,
+	ProviderCapacity: 1,
+	ResourceCapacity: 1,
+}
+
+type conflictDimension struct {
+	kind     models.ConflictKind
+	filters  map[string]interface{}
+	capacity int
+}
+
+// dimensions lists the dimensions of appointment that have to be checked.
+func (policy ConflictPolicy) dimensions(appointment models.Appointment) []conflictDimension {
+	var dimensions []conflictDimension
+	if appointment.CustomerID != 0 && policy.CustomerCapacity > 0 {
+		dimensions = append(dimensions, conflictDimension{models.ConflictCustomer, map[string]interface{}{"customer_id": appointment.CustomerID}, policy.CustomerCapacity})
+	}
+	if appointment.ProviderID != 0 && policy.ProviderCapacity > 0 {
+		dimensions = append(dimensions, conflictDimension{models.ConflictProvider, map[string]interface{}{"provider_id": appointment.ProviderID}, policy.ProviderCapacity})
+	}
+	if appointment.Resource != "" {
+		if capacity := policy.resourceCapacity(appointment.Resource); capacity > 0 {
+			dimensions = append(dimensions, conflictDimension{models.ConflictResource, map[string]interface{}{"resource": appointment.Resource}, capacity})
+		}
+	}
+	return dimensions
+}
+
+func (policy ConflictPolicy) resourceCapacity(resource string) int {
+	if capacity, exists := policy.ResourceCapacities[resource]; exists {
+		return capacity
+	}
+	return policy.ResourceCapacity
+}
+
+// markShared flags the provider and resource of appointment as shared unless
+// the policy allows exactly one booking at a time, so the database only
+// enforces exclusive bookings.
+func (policy ConflictPolicy) markShared(appointment *models.Appointment) {
+	appointment.SharedProvider = policy.ProviderCapacity != 1
+	appointment.SharedResource = policy.resourceCapacity(appointment.Resource) != 1
+}
+
+// maxConcurrent returns the highest number of bookings that overlap each
+// other at any instant between start and end.
+func maxConcurrent(bookings []models.Appointment, start, end time.Time) int {
+	type edge struct {
+		at    time.Time
+		delta int
+	}
+
+	var edges []edge
+	for _, booking := range bookings {
+		from, to := booking.Time, booking.EndTime()
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if from.Before(to) {
+			edges = append(edges, edge{from, 1}, edge{to, -1})
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].at.Equal(edges[j].at) {
+			return edges[i].delta < edges[j].delta
+		}
+		return edges[i].at.Before(edges[j].at)
+	})
+
+	current, highest := 0, 0
+	for _, edge := range edges {
+		current += edge.delta
+		if current > highest {
+			highest = current
+		}
+	}
+	return highest
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/models"
+)
+
+const (
+	apiKeyPrefix      = "kaida"
+	apiKeyPrefixBytes = 8
+	apiKeySecretBytes = 32
+
+	// apiKeyTouchInterval is how stale LastUsedAt may get before a request
+	// records the key's use again, so busy keys do not write on every call.
+	apiKeyTouchInterval = time.Minute
+)
+
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// DefaultAPIKeyService issues API keys of the form "kaida_<prefix>_<secret>".
+// The prefix identifies the key; the secret is stored as a SHA-256 digest and
+// is only returned once when the key is created. The secret is random, so a
+// slow password hash would add nothing but latency to every request.
+type DefaultAPIKeyService struct {
+	Database   db.Database
+	Authorizer Authorizer
+}
+
+var _ APIKeyService = (*DefaultAPIKeyService)(nil)
+
+// CreateAPIKey issues a key acting as userID, defaulting to user. The plain key is returned
+// alongside the stored record and cannot be recovered later.
+func (service *DefaultAPIKeyService) CreateAPIKey(ctx context.Context, user *models.User, userID int, name string, scopes []string) (models.APIKey, string, error) {
+	if userID == 0 {
+		userID = user.ID
+	}
+	if err := authorizerOrDefault(service.Authorizer).Authorize(user, ActionCreate, ResourceAPIKey, Target{UserID: userID}); err != nil {
+		return models.APIKey{}, "", err
+	}
+	if strings.TrimSpace(name) == "" {
+		return models.APIKey{}, "", errors.New("name is required")
+	}
+	if err := models.ValidateScopes(scopes); err != nil {
+		return models.APIKey{}, "", err
+	}
+	if _, err := service.Database.GetUserByID(ctx, userID); err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	prefix, err := randomKeyPart(apiKeyPrefixBytes, hex.EncodeToString)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	secret, err := randomKeyPart(apiKeySecretBytes, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	key := models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   hashToken(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	key.ID, err = service.Database.CreateAPIKey(ctx, key)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	return key, apiKeyPrefix + "_" + prefix + "_" + secret, nil
+}
+
+// AuthenticateAPIKey resolves a plain key to its owner and records its use.
+func (service *DefaultAPIKeyService) AuthenticateAPIKey(ctx context.Context, plain string) (*models.User, models.APIKey, error) {
+	parts := strings.SplitN(plain, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix {
+		return nil, models.APIKey{}, fmt.Errorf("%w: malformed key", ErrInvalidAPIKey)
+	}
+
+	key, err := service.Database.GetAPIKeyByPrefix(ctx, parts[1])
+	if err != nil {
+		return nil, models.APIKey{}, fmt.Errorf("%w: unknown key", ErrInvalidAPIKey)
+	}
+	if key.RevokedAt != nil {
+		return nil, models.APIKey{}, fmt.Errorf("%w: key has been revoked", ErrInvalidAPIKey)
+	}
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(hashToken(parts[2]))) != 1 {
+		return nil, models.APIKey{}, fmt.Errorf("%w: unknown key", ErrInvalidAPIKey)
+	}
+
+	user, err := service.Database.GetUserByID(ctx, key.UserID)
+	if err != nil {
+		return nil, models.APIKey{}, fmt.Errorf("%w: unknown user", ErrInvalidAPIKey)
+	}
+
+	if now := time.Now().UTC(); key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		key.LastUsedAt = &now
+		if err := service.Database.TouchAPIKey(ctx, key.ID, now); err != nil {
+			return nil, models.APIKey{}, err
+		}
+	}
+	return user, key, nil
+}
+
+// GetAPIKeys lists the keys of userID, or every key user may see when userID
+// is zero.
+func (service *DefaultAPIKeyService) GetAPIKeys(ctx context.Context, user *models.User, userID int) ([]models.APIKey, error) {
+	userID, err := listOwner(authorizerOrDefault(service.Authorizer), user, ResourceAPIKey, userID)
+	if err != nil {
+		return nil, err
+	}
+	return service.Database.GetAPIKeys(ctx, userID)
+}
+
+func (service *DefaultAPIKeyService) RevokeAPIKey(ctx context.Context, user *models.User, keyID int) error {
+	key, err := service.Database.GetAPIKeyByID(ctx, keyID)
+	if err != nil {
+		return err
+	}
+	if err := authorizerOrDefault(service.Authorizer).Authorize(user, ActionDelete, ResourceAPIKey, Target{UserID: key.UserID}); err != nil {
+		return err
+	}
+	return service.Database.RevokeAPIKey(ctx, keyID)
+}
+
+func randomKeyPart(size int, encode func([]byte) string) (string, error) {
+	part := make([]byte, size)
+	if _, err := rand.Read(part); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %v", err)
+	}
+	return encode(part), nil
+}
@@ -1,58 +1,153 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/ozoli99/Kaida/db"
 	"github.com/ozoli99/Kaida/models"
 )
 
+const (
+	defaultSlotStep        = 15 * time.Minute
+	defaultSlotLimit       = 100
+	defaultSuggestionCount = 3
+	suggestionHorizon      = 7 * 24 * time.Hour
+	conflictCheckHorizon   = 366 * 24 * time.Hour
+)
+
+// DefaultAppointmentService checks permissions through Authorizer, falling
+// back to DefaultPolicy when it is nil.
 type DefaultAppointmentService struct {
-	Database db.Database
+	Database       db.Database
+	Availability   AvailabilityService
+	ConflictPolicy *ConflictPolicy
+	Authorizer     Authorizer
 }
 
+var ErrUnauthorized = errors.New("unauthorized")
+
 var _ AppointmentService = (*DefaultAppointmentService)(nil)
 
-func (service *DefaultAppointmentService) GetAllAppointments(user *models.User, limit, offset int, filters map[string]interface{}, sort string) ([]models.Appointment, error) {
-	switch user.Role {
-		case "admin":
-		case "customer":
-			filters["customer_id"] = user.ID
-		case "provider":
-			filters["provider_id"]= user.ID
+func (service *DefaultAppointmentService) GetAllAppointments(ctx context.Context, user *models.User, limit, offset int, filters map[string]interface{}, sort string) ([]models.Appointment, error) {
+	visibility, err := service.visibilityFilters(user)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range visibility {
+		filters[key] = value
 	}
 
-	return service.Database.GetAllAppointments(limit, offset, filters, sort)
+	return service.Database.GetAllAppointments(ctx, limit, offset, filters, sort)
 }
 
-func (service *DefaultAppointmentService) CheckForConflict(appointment models.Appointment) error {
-	existingAppointments, err := service.Database.GetAppointmentsByCustomerAndTimeRange(appointment.CustomerName, appointment.Time, appointment.Time.Add(time.Duration(appointment.Duration)*time.Minute))
-	if err != nil {
-		return err
+// CheckForConflict checks the customer, provider and resource of appointment
+// independently against the conflict policy. Recurring appointments are
+// checked occurrence by occurrence up to conflictCheckHorizon. Cancelled
+// appointments and the appointment itself are ignored, so it can be used for
+// updates as well.
+func (service *DefaultAppointmentService) CheckForConflict(ctx context.Context, appointment models.Appointment) error {
+	return service.explainConflict(ctx, service.checkConflict(ctx, appointment), appointment)
+}
+
+// checkConflict is CheckForConflict without the suggestions. Searching for
+// them reads availability outside of the Database, so inside a transaction
+// only the conflict is reported and explainConflict fills in the rest once
+// the transaction is over.
+func (service *DefaultAppointmentService) checkConflict(ctx context.Context, appointment models.Appointment) error {
+	if appointment.IsCancelled() {
+		return nil
 	}
-	if len(existingAppointments) > 0 {
-		return errors.New("conflict detected: overlapping appointment")
+
+	policy := service.conflictPolicy()
+
+	instances := []models.Appointment{appointment}
+	if appointment.IsRecurring() {
+		occurrences, err := service.occurrencesBetween(ctx, appointment, appointment.Time, appointment.Time.Add(conflictCheckHorizon))
+		if err != nil {
+			return err
+		}
+		instances = occurrences
+	}
+	if len(instances) == 0 {
+		return nil
+	}
+
+	from, to := instances[0].Time, instances[0].EndTime()
+	for _, instance := range instances {
+		if instance.EndTime().After(to) {
+			to = instance.EndTime()
+		}
+	}
+
+	for _, dimension := range policy.dimensions(appointment) {
+		bookings, err := service.bookingsBetween(ctx, dimension.filters, from, to)
+		if err != nil {
+			return err
+		}
+
+		for _, instance := range instances {
+			var overlapping []models.Appointment
+			for _, booking := range bookings {
+				if appointment.ID != 0 && (booking.ID == appointment.ID || booking.SeriesID == appointment.ID) {
+					continue
+				}
+				if booking.Time.Before(instance.EndTime()) && booking.EndTime().After(instance.Time) {
+					overlapping = append(overlapping, booking)
+				}
+			}
+
+			if maxConcurrent(overlapping, instance.Time, instance.EndTime()) >= dimension.capacity {
+				conflict := models.NewConflictError(dimension.kind, overlapping)
+				conflict.Time = instance.Time
+				return conflict
+			}
+		}
 	}
 	return nil
 }
 
-func (service *DefaultAppointmentService) CreateAppointment(user *models.User, appointment models.Appointment) (int, error) {
+func (service *DefaultAppointmentService) CreateAppointment(ctx context.Context, user *models.User, appointment models.Appointment) (int, error) {
+	service.defaultOwner(user, &appointment)
 	if err := service.authorizeCreate(user, appointment); err != nil {
 		return 0, err
 	}
 
-	insertedID, err := service.Database.CreateAppointment(appointment)
-	if err != nil {
+	if appointment.Status == "" {
+		appointment.Status = models.StatusConfirmed
+	}
+	if !containsStatus([]string{models.StatusRequested, models.StatusConfirmed}, models.NormalizeStatus(appointment.Status)) &&
+		service.authorizer().Authorize(user, ActionImport, ResourceAppointment, AppointmentTarget(appointment)) != nil {
+		return 0, fmt.Errorf("%w: appointments must start as %s or %s", ErrInvalidStatusTransition, models.StatusRequested, models.StatusConfirmed)
+	}
+
+	if err := service.checkAvailability(ctx, appointment); err != nil {
 		return 0, err
 	}
+	service.conflictPolicy().markShared(&appointment)
+
+	var insertedID int
+	err := service.inTx(ctx, func(transactional *DefaultAppointmentService) error {
+		if err := transactional.checkConflict(ctx, appointment); err != nil {
+			return err
+		}
+
+		var err error
+		insertedID, err = transactional.Database.CreateAppointment(ctx, appointment)
+		return err
+	})
+	if err != nil {
+		return 0, service.explainConflict(ctx, err, appointment)
+	}
 
 	return insertedID, nil
 }
 
-func (service *DefaultAppointmentService) UpdateAppointment(user *models.User, appointment models.Appointment) error {
-	existingAppointment, err := service.Database.GetAppointmentByID(appointment.ID)
+func (service *DefaultAppointmentService) UpdateAppointment(ctx context.Context, user *models.User, appointment models.Appointment) error {
+	existingAppointment, err := service.Database.GetAppointmentByID(ctx, appointment.ID)
 	if err != nil {
 		return err
 	}
@@ -61,119 +156,479 @@ func (service *DefaultAppointmentService) UpdateAppointment(user *models.User, a
 		return err
 	}
 
-	return service.Database.UpdateAppointment(appointment)
+	if appointment.Status == "" {
+		appointment.Status = existingAppointment.Status
+	}
+	if models.NormalizeStatus(appointment.Status) != models.NormalizeStatus(existingAppointment.Status) {
+		return fmt.Errorf("%w: status cannot be changed by an update, use the status endpoint", ErrInvalidStatusTransition)
+	}
+
+	if err := service.checkAvailability(ctx, appointment); err != nil {
+		return err
+	}
+	service.conflictPolicy().markShared(&appointment)
+
+	err = service.inTx(ctx, func(transactional *DefaultAppointmentService) error {
+		if err := transactional.checkConflict(ctx, appointment); err != nil {
+			return err
+		}
+		return transactional.Database.UpdateAppointment(ctx, appointment)
+	})
+	return service.explainConflict(ctx, err, appointment)
 }
 
-func (service *DefaultAppointmentService) UpdateAppointmentStatus(appointmentID int, status string) error {
-	return service.Database.UpdateAppointmentStatus(appointmentID, status)
+func (service *DefaultAppointmentService) DeleteAppointment(ctx context.Context, user *models.User, appointmentID int) error {
+	appointment, err := service.Database.GetAppointmentByID(ctx, appointmentID)
+	if err != nil {
+		return err
+	}
+
+	if err := service.authorizeDelete(user, appointment); err != nil {
+		return err
+	}
+
+	return service.Database.DeleteAppointment(ctx, appointmentID)
 }
 
-func (service *DefaultAppointmentService) DeleteAppointment(user *models.User, appointmentID int) error {
-	appointment, err := service.Database.GetAppointmentByID(appointmentID)
+func (service *DefaultAppointmentService) ExpandOccurrences(ctx context.Context, user *models.User, from, to time.Time) ([]models.Appointment, error) {
+	if !from.Before(to) {
+		return nil, errors.New("end of the time window must be after its start")
+	}
+
+	filters, err := service.visibilityFilters(user)
+	if err != nil {
+		return nil, err
+	}
+
+	recurringAppointments, err := service.Database.GetRecurringAppointments(ctx, filters, to)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences, err := service.expandSeries(ctx, recurringAppointments, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool { return occurrences[i].Time.Before(occurrences[j].Time) })
+	return occurrences, nil
+}
+
+func (service *DefaultAppointmentService) GetOccurrences(ctx context.Context, user *models.User, appointmentID int, from, to time.Time) ([]models.Appointment, error) {
+	if !from.Before(to) {
+		return nil, errors.New("end of the time window must be after its start")
+	}
+
+	appointment, err := service.Database.GetAppointmentByID(ctx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.authorizeRead(user, appointment); err != nil {
+		return nil, err
+	}
+
+	return service.occurrencesBetween(ctx, appointment, from, to)
+}
+
+func (service *DefaultAppointmentService) GetOccurrenceExceptions(ctx context.Context, user *models.User, appointmentID int) ([]models.OccurrenceException, error) {
+	appointment, err := service.Database.GetAppointmentByID(ctx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.authorizeRead(user, appointment); err != nil {
+		return nil, err
+	}
+
+	return service.Database.GetOccurrenceExceptions(ctx, appointmentID)
+}
+
+func (service *DefaultAppointmentService) CreateOccurrenceException(ctx context.Context, user *models.User, exception models.OccurrenceException) (int, error) {
+	appointment, err := service.Database.GetAppointmentByID(ctx, exception.AppointmentID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := service.authorizeUpdate(user, appointment, appointment); err != nil {
+		return 0, err
+	}
+
+	if err := exception.Validate(); err != nil {
+		return 0, err
+	}
+	if !appointment.IsRecurring() {
+		return 0, fmt.Errorf("appointment %d is not recurring", appointment.ID)
+	}
+	if exception.Type != models.ExceptionAdd && !appointment.IsOccurrence(exception.OccurrenceTime) {
+		return 0, fmt.Errorf("no occurrence of appointment %d at %s", appointment.ID, exception.OccurrenceTime.Format(time.RFC3339))
+	}
+
+	return service.Database.CreateOccurrenceException(ctx, exception)
+}
+
+func (service *DefaultAppointmentService) DeleteOccurrenceException(ctx context.Context, user *models.User, appointmentID, exceptionID int) error {
+	appointment, err := service.Database.GetAppointmentByID(ctx, appointmentID)
 	if err != nil {
 		return err
 	}
 
-	if !service.authorizeDelete(user, appointment) {
-		return fmt.Errorf("unauthorized to delete appointment")
+	if err := service.authorizeUpdate(user, appointment, appointment); err != nil {
+		return err
+	}
+
+	return service.Database.DeleteOccurrenceException(ctx, appointmentID, exceptionID)
+}
+
+// FindAvailableSlots lists the open slots of the requested length for a
+// provider, a resource or both. Slots lie inside the owners' availability
+// windows and keep the requested buffers free around existing bookings,
+// including the occurrences of recurring series. When a preferred time is
+// given the slots closest to it come first, otherwise they are chronological.
+func (service *DefaultAppointmentService) FindAvailableSlots(ctx context.Context, user *models.User, criteria models.SlotCriteria) ([]models.TimeRange, error) {
+	if err := criteria.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := service.visibilityFilters(user); err != nil {
+		return nil, err
+	}
+
+	slots, err := service.openSlots(ctx, criteria, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if !criteria.PreferredTime.IsZero() {
+		sort.SliceStable(slots, func(i, j int) bool {
+			return absDuration(slots[i].Start.Sub(criteria.PreferredTime)) < absDuration(slots[j].Start.Sub(criteria.PreferredTime))
+		})
 	}
 
-	return service.Database.DeleteAppointment(appointmentID)
+	limit := criteria.Limit
+	if limit == 0 {
+		limit = defaultSlotLimit
+	}
+	if len(slots) > limit {
+		slots = slots[:limit]
+	}
+	return slots, nil
+}
+
+// SuggestAlternativeTimes returns up to count open slots before and up to
+// count after the requested appointment time, nearest first on each side and
+// then merged chronologically. A slot is only suggested when neither the
+// provider nor the resource of the appointment is booked or unavailable, and
+// slots in the past are never suggested.
+func (service *DefaultAppointmentService) SuggestAlternativeTimes(ctx context.Context, user *models.User, appointment models.Appointment, count int) ([]models.TimeRange, error) {
+	if _, err := service.visibilityFilters(user); err != nil {
+		return nil, err
+	}
+	return service.suggestAlternatives(ctx, appointment, count)
 }
 
-func (service *DefaultAppointmentService) GetFutureOccurrences(limit int) ([]models.Appointment, error) {
-	recurringAppointments, err := service.Database.GetRecurringAppointments(limit)
+func (service *DefaultAppointmentService) suggestAlternatives(ctx context.Context, appointment models.Appointment, count int) ([]models.TimeRange, error) {
+	if count <= 0 {
+		count = defaultSuggestionCount
+	}
+
+	from := appointment.Time.Add(-suggestionHorizon)
+	if now := time.Now(); from.Before(now) {
+		from = now
+	}
+	criteria := models.SlotCriteria{
+		ProviderID: appointment.ProviderID,
+		Resource:   appointment.Resource,
+		From:       from,
+		To:         appointment.Time.Add(suggestionHorizon),
+		Duration:   appointment.Duration,
+	}
+	if err := criteria.Validate(); err != nil {
+		return nil, err
+	}
+
+	slots, err := service.openSlots(ctx, criteria, appointment.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	var futureOccurrences []models.Appointment
-	for _, appointment := range recurringAppointments {
-		occurrences := appointment.CalculateFutureOccurences(limit)
-		for _, occ := range occurrences {
-			futureOccurrences = append(futureOccurrences, models.Appointment{
-				CustomerName: appointment.CustomerName,
-				Time: occ,
-				Duration: appointment.Duration,
-				Notes: appointment.Notes,
-				RecurrenceRule: appointment.RecurrenceRule,
-			})
+	split := sort.Search(len(slots), func(i int) bool { return !slots[i].Start.Before(appointment.Time) })
+	before, after := slots[:split], slots[split:]
+	if len(before) > count {
+		before = before[len(before)-count:]
+	}
+	if len(after) > count {
+		after = after[:count]
+	}
+	return append(append([]models.TimeRange{}, before...), after...), nil
+}
+
+// withSuggestions attaches alternative times for appointment to the conflict.
+// Suggestions are best effort, so a failed search leaves the conflict as is.
+func (service *DefaultAppointmentService) withSuggestions(ctx context.Context, conflict *models.ConflictError, appointment models.Appointment) *models.ConflictError {
+	suggestions, err := service.suggestAlternatives(ctx, appointment, defaultSuggestionCount)
+	if err == nil {
+		conflict.Suggestions = suggestions
+	}
+	return conflict
+}
+
+// explainConflict completes a conflict found for appointment with
+// suggestions. Conflicts raised by the database guards do not know the
+// bookings they collided with, so appointment is checked again first. It runs
+// after the transaction the conflict was found in; other errors are returned
+// as they are.
+func (service *DefaultAppointmentService) explainConflict(ctx context.Context, err error, appointment models.Appointment) error {
+	var conflict *models.ConflictError
+	if !errors.As(err, &conflict) {
+		return err
+	}
+
+	if len(conflict.AppointmentIDs) == 0 {
+		var checked *models.ConflictError
+		if errors.As(service.checkConflict(ctx, appointment), &checked) {
+			conflict = checked
+		} else if conflict.Time.IsZero() {
+			conflict.Time = appointment.Time
 		}
 	}
-	return futureOccurrences, nil
+	return service.withSuggestions(ctx, conflict, service.instanceAt(ctx, appointment, conflict.Time))
 }
 
-func (service *DefaultAppointmentService) authorizeCreate(user *models.User, appointment models.Appointment) error {
-	switch user.Role {
-		case "admin":
-			return nil
-		case "customer":
-			if appointment.CustomerID != user.ID {
-				return fmt.Errorf("unauthorized: customers can only create appointments for themselves")
-			}
-			return nil
-		case "provider":
-			if appointment.ProviderID != user.ID {
-				return fmt.Errorf("unauthorized: masseur can only create for themselves as a provider")
+// instanceAt returns the occurrence of appointment starting at at, so
+// suggestions follow an override to another provider or resource.
+func (service *DefaultAppointmentService) instanceAt(ctx context.Context, appointment models.Appointment, at time.Time) models.Appointment {
+	if appointment.IsRecurring() {
+		occurrences, err := service.occurrencesBetween(ctx, appointment, at, at.Add(time.Minute))
+		if err == nil {
+			for _, occurrence := range occurrences {
+				if occurrence.Time.Equal(at) {
+					occurrence.ID = appointment.ID
+					return occurrence
+				}
 			}
-			return nil
-		default:
-			return fmt.Errorf("unauthorized: unknown role %q", user.Role)
+		}
 	}
+	appointment.Time = at
+	return appointment
 }
 
-func (service *DefaultAppointmentService) GetAppointmentByID(appointmentID int) (models.Appointment, error) {
-	return service.Database.GetAppointmentByID(appointmentID)
+// openSlots lists every free slot matching criteria in chronological order,
+// ignoring the bookings of the appointment with excludeID.
+func (service *DefaultAppointmentService) openSlots(ctx context.Context, criteria models.SlotCriteria, excludeID int) ([]models.TimeRange, error) {
+	step := time.Duration(criteria.Step) * time.Minute
+	if step == 0 {
+		step = defaultSlotStep
+	}
+	bufferBefore := time.Duration(criteria.BufferBefore) * time.Minute
+	bufferAfter := time.Duration(criteria.BufferAfter) * time.Minute
+
+	windows := []models.TimeRange{{Start: criteria.From, End: criteria.To}}
+	var busy []models.TimeRange
+	for _, filters := range slotOwners(criteria.ProviderID, criteria.Resource) {
+		if service.Availability != nil {
+			providerID, resource := ownerOf(filters)
+			schedule, err := service.Availability.GetSchedule(ctx, providerID, resource, criteria.From, criteria.To)
+			if err != nil {
+				return nil, err
+			}
+			windows = models.IntersectRanges(windows, schedule.Windows(criteria.From, criteria.To))
+		}
+
+		bookings, err := service.bookingsBetween(ctx, filters, criteria.From.Add(-bufferBefore), criteria.To.Add(bufferAfter))
+		if err != nil {
+			return nil, err
+		}
+		for _, booking := range bookings {
+			if excludeID != 0 && (booking.ID == excludeID || booking.SeriesID == excludeID) {
+				continue
+			}
+			busy = append(busy, models.TimeRange{Start: booking.Time.Add(-bufferAfter), End: booking.EndTime().Add(bufferBefore)})
+		}
+	}
+
+	return models.FreeSlots(windows, busy, time.Duration(criteria.Duration)*time.Minute, step), nil
 }
 
-func (service *DefaultAppointmentService) authorizeUpdate(user *models.User, oldAppointment, newAppointment models.Appointment) error {
-	if user.Role == "admin" {
-		return nil
+// bookingsBetween returns the active bookings matching filters that overlap
+// from..to. Recurring series are expanded, so their individual occurrences
+// are returned instead of the series row. An override can move an occurrence
+// to another provider or resource, so the series are matched by their
+// overrides as well and their occurrences are filtered again after expansion.
+func (service *DefaultAppointmentService) bookingsBetween(ctx context.Context, filters map[string]interface{}, from, to time.Time) ([]models.Appointment, error) {
+	overlapping, err := service.Database.GetOverlappingAppointments(ctx, filters, from, to)
+	if err != nil {
+		return nil, err
 	}
 
-	if user.Role == "customer" {
-		if oldAppointment.CustomerID != user.ID {
-			return fmt.Errorf("unauthorized: cannot update appointment not owned by you")
+	var bookings []models.Appointment
+	for _, appointment := range overlapping {
+		if !appointment.IsRecurring() && !appointment.IsCancelled() {
+			bookings = append(bookings, appointment)
 		}
-		return nil
 	}
 
-	if user.Role == "provider" {
-		if oldAppointment.ProviderID != user.ID {
-			return fmt.Errorf("unauthorized: not assigned as provider for this assignment")
+	recurringAppointments, err := service.Database.GetRecurringBookings(ctx, filters, to)
+	if err != nil {
+		return nil, err
+	}
+	var series []models.Appointment
+	for _, appointment := range recurringAppointments {
+		if !appointment.IsCancelled() {
+			series = append(series, appointment)
+		}
+	}
+	occurrences, err := service.expandSeries(ctx, series, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, occurrence := range occurrences {
+		if matchesOwner(occurrence, filters) {
+			bookings = append(bookings, occurrence)
 		}
-		return nil
 	}
 
-	return fmt.Errorf("unauthorized")
+	sort.SliceStable(bookings, func(i, j int) bool { return bookings[i].Time.Before(bookings[j].Time) })
+	return bookings, nil
 }
 
-func (service *DefaultAppointmentService) authorizeDelete(user *models.User, appointment models.Appointment) bool {
-	if user.Role == "admin" {
-		return true
+// expandSeries returns the occurrences of every series overlapping from..to,
+// loading the exceptions of all of them with a single query.
+func (service *DefaultAppointmentService) expandSeries(ctx context.Context, series []models.Appointment, from, to time.Time) ([]models.Appointment, error) {
+	if len(series) == 0 {
+		return nil, nil
+	}
+
+	appointmentIDs := make([]int, len(series))
+	for index, appointment := range series {
+		appointmentIDs[index] = appointment.ID
+	}
+	exceptions, err := service.Database.GetSeriesExceptions(ctx, appointmentIDs)
+	if err != nil {
+		return nil, err
 	}
 
-	if user.Role == "customer" && appointment.CustomerID == user.ID {
-		return true
+	var occurrences []models.Appointment
+	for _, appointment := range series {
+		occurrences = append(occurrences, appointment.OccurrencesBetween(from, to, exceptions[appointment.ID])...)
 	}
+	return occurrences, nil
+}
 
-	if user.Role == "provider" && appointment.ProviderID == user.ID {
-		return true
+func (service *DefaultAppointmentService) occurrencesBetween(ctx context.Context, appointment models.Appointment, from, to time.Time) ([]models.Appointment, error) {
+	exceptions, err := service.Database.GetOccurrenceExceptions(ctx, appointment.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	return false
+	return appointment.OccurrencesBetween(from, to, exceptions), nil
 }
 
-func (service *DefaultAppointmentService) MarkAppointmentComplete(user *models.User, appointmentID int) error {
-	appointment, err := service.Database.GetAppointmentByID(appointmentID)
+func (service *DefaultAppointmentService) checkAvailability(ctx context.Context, appointment models.Appointment) error {
+	if service.Availability == nil {
+		return nil
+	}
+	return service.Availability.CheckAvailability(ctx, appointment)
+}
+
+// inTx runs fn with a copy of service whose Database is bound to a single
+// transaction, so a conflict check and the write that depends on it cannot
+// interleave with a concurrent booking.
+func (service *DefaultAppointmentService) inTx(ctx context.Context, fn func(transactional *DefaultAppointmentService) error) error {
+	return service.Database.WithTx(ctx, func(tx db.Database) error {
+		transactional := *service
+		transactional.Database = tx
+		return fn(&transactional)
+	})
+}
+
+func (service *DefaultAppointmentService) conflictPolicy() ConflictPolicy {
+	if service.ConflictPolicy != nil {
+		return *service.ConflictPolicy
+	}
+	return DefaultConflictPolicy
+}
+
+func (service *DefaultAppointmentService) authorizer() Authorizer {
+	return authorizerOrDefault(service.Authorizer)
+}
+
+func (service *DefaultAppointmentService) visibilityFilters(user *models.User) (map[string]interface{}, error) {
+	return service.authorizer().Filters(user, ActionRead, ResourceAppointment)
+}
+
+// defaultOwner fills in the owner fields the authorizer restricts the user's
+// bookings to and the appointment leaves empty, so a customer books for
+// themselves and a provider with themselves unless told otherwise.
+func (service *DefaultAppointmentService) defaultOwner(user *models.User, appointment *models.Appointment) {
+	filters, err := service.authorizer().Filters(user, ActionCreate, ResourceAppointment)
 	if err != nil {
+		return
+	}
+	if customerID, exists := filters["customer_id"].(int); exists && appointment.CustomerID == 0 {
+		appointment.CustomerID = customerID
+	}
+	if providerID, exists := filters["provider_id"].(int); exists && appointment.ProviderID == 0 {
+		appointment.ProviderID = providerID
+	}
+	if site, exists := filters["site"].(string); exists && appointment.Site == "" {
+		appointment.Site = site
+	}
+}
+
+func (service *DefaultAppointmentService) authorizeCreate(user *models.User, appointment models.Appointment) error {
+	return service.authorizer().Authorize(user, ActionCreate, ResourceAppointment, AppointmentTarget(appointment))
+}
+
+func (service *DefaultAppointmentService) GetAppointmentByID(ctx context.Context, appointmentID int) (models.Appointment, error) {
+	return service.Database.GetAppointmentByID(ctx, appointmentID)
+}
+
+func (service *DefaultAppointmentService) authorizeRead(user *models.User, appointment models.Appointment) error {
+	return service.authorizer().Authorize(user, ActionRead, ResourceAppointment, AppointmentTarget(appointment))
+}
+
+// authorizeUpdate checks the appointment both before and after the update, so
+// an appointment cannot be moved out of the user's reach.
+func (service *DefaultAppointmentService) authorizeUpdate(user *models.User, oldAppointment, newAppointment models.Appointment) error {
+	if err := service.authorizer().Authorize(user, ActionUpdate, ResourceAppointment, AppointmentTarget(oldAppointment)); err != nil {
 		return err
 	}
+	return service.authorizer().Authorize(user, ActionUpdate, ResourceAppointment, AppointmentTarget(newAppointment))
+}
+
+func (service *DefaultAppointmentService) authorizeDelete(user *models.User, appointment models.Appointment) error {
+	return service.authorizer().Authorize(user, ActionDelete, ResourceAppointment, AppointmentTarget(appointment))
+}
 
-	if !(user.Role == "admin" || (user.Role == "provider" && appointment.ProviderID == user.ID)) {
-		return fmt.Errorf("unauthorized: you are not the provider or an admin")
+func (service *DefaultAppointmentService) MarkAppointmentComplete(ctx context.Context, user *models.User, appointmentID int) error {
+	return service.ChangeAppointmentStatus(ctx, user, appointmentID, models.StatusCompleted, "")
+}
+
+func slotOwners(providerID int, resource string) []map[string]interface{} {
+	var owners []map[string]interface{}
+	if providerID != 0 {
+		owners = append(owners, map[string]interface{}{"provider_id": providerID})
+	}
+	if resource != "" {
+		owners = append(owners, map[string]interface{}{"resource": resource})
 	}
+	return owners
+}
 
-	appointment.Status = "Completed"
-	return service.Database.UpdateAppointment(appointment)
-}
\ No newline at end of file
+func ownerOf(filters map[string]interface{}) (int, string) {
+	providerID, _ := filters["provider_id"].(int)
+	resource, _ := filters["resource"].(string)
+	return providerID, resource
+}
+
+func matchesOwner(appointment models.Appointment, filters map[string]interface{}) bool {
+	providerID, resource := ownerOf(filters)
+	return (providerID == 0 || appointment.ProviderID == providerID) && (resource == "" || appointment.Resource == resource)
+}
+
+func absDuration(duration time.Duration) time.Duration {
+	if duration < 0 {
+		return -duration
+	}
+	return duration
+}
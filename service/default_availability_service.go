@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/models"
+)
+
+var ErrOutsideAvailability = errors.New("outside of availability")
+
+// DefaultAvailabilityService checks permissions through Authorizer, falling
+// back to DefaultPolicy when it is nil.
+type DefaultAvailabilityService struct {
+	Database   db.Database
+	Authorizer Authorizer
+}
+
+var _ AvailabilityService = (*DefaultAvailabilityService)(nil)
+
+func (service *DefaultAvailabilityService) GetWorkingHours(ctx context.Context, user *models.User, providerID int, resource string) ([]models.WorkingHours, error) {
+	return service.Database.GetWorkingHours(ctx, ownerFilters(providerID, resource))
+}
+
+func (service *DefaultAvailabilityService) CreateWorkingHours(ctx context.Context, user *models.User, hours models.WorkingHours) (int, error) {
+	if err := hours.Validate(); err != nil {
+		return 0, err
+	}
+
+	if err := service.authorizeManage(user, ActionCreate, hours.ProviderID); err != nil {
+		return 0, err
+	}
+
+	return service.Database.CreateWorkingHours(ctx, hours)
+}
+
+func (service *DefaultAvailabilityService) DeleteWorkingHours(ctx context.Context, user *models.User, hoursID int) error {
+	existing, err := service.Database.GetWorkingHours(ctx, map[string]interface{}{"id": hoursID})
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return fmt.Errorf("working hours %d not found", hoursID)
+	}
+
+	if err := service.authorizeManage(user, ActionDelete, existing[0].ProviderID); err != nil {
+		return err
+	}
+
+	return service.Database.DeleteWorkingHours(ctx, hoursID)
+}
+
+func (service *DefaultAvailabilityService) GetAvailabilityOverrides(ctx context.Context, user *models.User, providerID int, resource string) ([]models.AvailabilityOverride, error) {
+	return service.Database.GetAvailabilityOverrides(ctx, ownerFilters(providerID, resource))
+}
+
+func (service *DefaultAvailabilityService) CreateAvailabilityOverride(ctx context.Context, user *models.User, override models.AvailabilityOverride) (int, error) {
+	if err := override.Validate(); err != nil {
+		return 0, err
+	}
+
+	if err := service.authorizeManage(user, ActionCreate, override.ProviderID); err != nil {
+		return 0, err
+	}
+
+	return service.Database.CreateAvailabilityOverride(ctx, override)
+}
+
+func (service *DefaultAvailabilityService) DeleteAvailabilityOverride(ctx context.Context, user *models.User, overrideID int) error {
+	existing, err := service.Database.GetAvailabilityOverrides(ctx, map[string]interface{}{"id": overrideID})
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return fmt.Errorf("availability override %d not found", overrideID)
+	}
+
+	if err := service.authorizeManage(user, ActionDelete, existing[0].ProviderID); err != nil {
+		return err
+	}
+
+	return service.Database.DeleteAvailabilityOverride(ctx, overrideID)
+}
+
+func (service *DefaultAvailabilityService) GetSchedule(ctx context.Context, providerID int, resource string, from, to time.Time) (models.AvailabilitySchedule, error) {
+	var schedule models.AvailabilitySchedule
+
+	workingHours, err := service.Database.GetWorkingHours(ctx, ownerFilters(providerID, resource))
+	if err != nil {
+		return schedule, err
+	}
+
+	filters := ownerFilters(providerID, resource)
+	filters["from_date"] = from.UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	filters["to_date"] = to.UTC().AddDate(0, 0, 1).Format("2006-01-02")
+	overrides, err := service.Database.GetAvailabilityOverrides(ctx, filters)
+	if err != nil {
+		return schedule, err
+	}
+
+	schedule.WorkingHours = workingHours
+	schedule.Overrides = overrides
+	return schedule, nil
+}
+
+func (service *DefaultAvailabilityService) CheckAvailability(ctx context.Context, appointment models.Appointment) error {
+	start, end := appointment.Time, appointment.EndTime()
+
+	if appointment.ProviderID != 0 {
+		schedule, err := service.GetSchedule(ctx, appointment.ProviderID, "", start, end)
+		if err != nil {
+			return err
+		}
+		if !schedule.Covers(start, end) {
+			return fmt.Errorf("%w: provider %d is not available at %s", ErrOutsideAvailability, appointment.ProviderID, start.Format(time.RFC3339))
+		}
+	}
+
+	if appointment.Resource != "" {
+		schedule, err := service.GetSchedule(ctx, 0, appointment.Resource, start, end)
+		if err != nil {
+			return err
+		}
+		if !schedule.Covers(start, end) {
+			return fmt.Errorf("%w: resource %q is not available at %s", ErrOutsideAvailability, appointment.Resource, start.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
+
+func (service *DefaultAvailabilityService) authorizeManage(user *models.User, action string, providerID int) error {
+	return authorizerOrDefault(service.Authorizer).Authorize(user, action, ResourceAvailability, Target{ProviderID: providerID})
+}
+
+func ownerFilters(providerID int, resource string) map[string]interface{} {
+	filters := map[string]interface{}{}
+	if providerID != 0 {
+		filters["provider_id"] = providerID
+	}
+	if resource != "" {
+		filters["resource"] = resource
+	}
+	return filters
+}
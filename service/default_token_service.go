@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/models"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 7 * 24 * time.Hour
+	minimumTokenKeyLength  = 32
+	opaqueTokenBytes       = 32
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// DefaultTokenService issues HS256 JSON Web Tokens as access tokens and opaque
+// refresh tokens bound to a server-side session. Refresh tokens rotate on
+// every use. Key must be at least 32 bytes; zero TTLs fall back to 15 minutes
+// for access tokens and 7 days for refresh tokens.
+type DefaultTokenService struct {
+	Database        db.Database
+	Key             []byte
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	Authorizer      Authorizer
+}
+
+var _ TokenService = (*DefaultTokenService)(nil)
+
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	SessionID int    `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (service *DefaultTokenService) IssueTokens(ctx context.Context, user *models.User) (models.TokenPair, error) {
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	now := time.Now()
+	sessionID, err := service.Database.CreateSession(ctx, models.Session{
+		UserID:    user.ID,
+		TokenHash: hashToken(refreshToken),
+		CreatedAt: now,
+		ExpiresAt: now.Add(service.refreshTokenTTL()),
+	})
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	return service.tokenPair(user, sessionID, refreshToken)
+}
+
+// Authenticate verifies an access token and loads its user and session, so
+// revoked sessions, role changes and deleted accounts take effect before the
+// token expires.
+func (service *DefaultTokenService) Authenticate(ctx context.Context, accessToken string) (*models.User, models.Session, error) {
+	claims, err := service.verify(accessToken)
+	if err != nil {
+		return nil, models.Session{}, err
+	}
+
+	session, err := service.Database.GetSessionByID(ctx, claims.SessionID)
+	if err != nil || !session.Active(time.Now()) {
+		return nil, models.Session{}, fmt.Errorf("%w: session is no longer active", ErrInvalidToken)
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || userID != session.UserID {
+		return nil, models.Session{}, fmt.Errorf("%w: malformed subject", ErrInvalidToken)
+	}
+
+	user, err := service.Database.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, models.Session{}, fmt.Errorf("%w: unknown user", ErrInvalidToken)
+	}
+	return user, session, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair and rotates the
+// refresh token. Presenting a token that was already rotated away means it
+// leaked, so the whole session is revoked.
+func (service *DefaultTokenService) Refresh(ctx context.Context, refreshToken string) (models.TokenPair, error) {
+	tokenHash := hashToken(refreshToken)
+	session, err := service.Database.GetSessionByTokenHash(ctx, tokenHash)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%w: unknown refresh token", ErrInvalidToken)
+	}
+	if session.TokenHash != tokenHash {
+		service.Database.RevokeSession(ctx, session.ID)
+		return models.TokenPair{}, fmt.Errorf("%w: refresh token reuse detected", ErrInvalidToken)
+	}
+	if !session.Active(time.Now()) {
+		return models.TokenPair{}, fmt.Errorf("%w: session is no longer active", ErrInvalidToken)
+	}
+
+	user, err := service.Database.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%w: unknown user", ErrInvalidToken)
+	}
+
+	rotated, err := newOpaqueToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	if err := service.Database.RotateSessionToken(ctx, session.ID, tokenHash, hashToken(rotated), time.Now().Add(service.refreshTokenTTL())); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%w: refresh token was already used", ErrInvalidToken)
+	}
+
+	return service.tokenPair(user, session.ID, rotated)
+}
+
+func (service *DefaultTokenService) Logout(ctx context.Context, sessionID int) error {
+	return service.Database.RevokeSession(ctx, sessionID)
+}
+
+func (service *DefaultTokenService) LogoutAll(ctx context.Context, userID int) error {
+	return service.Database.RevokeUserSessions(ctx, userID)
+}
+
+// GetSessions lists the sessions of userID, or every session user may see
+// when userID is zero.
+func (service *DefaultTokenService) GetSessions(ctx context.Context, user *models.User, userID int) ([]models.Session, error) {
+	userID, err := listOwner(authorizerOrDefault(service.Authorizer), user, ResourceSession, userID)
+	if err != nil {
+		return nil, err
+	}
+	return service.Database.GetSessions(ctx, userID)
+}
+
+func (service *DefaultTokenService) RevokeSession(ctx context.Context, user *models.User, sessionID int) error {
+	session, err := service.Database.GetSessionByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if err := authorizerOrDefault(service.Authorizer).Authorize(user, ActionDelete, ResourceSession, Target{UserID: session.UserID}); err != nil {
+		return err
+	}
+	return service.Database.RevokeSession(ctx, sessionID)
+}
+
+func (service *DefaultTokenService) tokenPair(user *models.User, sessionID int, refreshToken string) (models.TokenPair, error) {
+	accessTTL := service.accessTokenTTL()
+	accessToken, err := service.sign(user, sessionID, accessTTL)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	return models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTTL.Seconds()),
+	}, nil
+}
+
+func (service *DefaultTokenService) sign(user *models.User, sessionID int, ttl time.Duration) (string, error) {
+	if len(service.Key) < minimumTokenKeyLength {
+		return "", fmt.Errorf("token key must be at least %d bytes", minimumTokenKeyLength)
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(tokenClaims{
+		Subject:   strconv.Itoa(user.ID),
+		Role:      user.Role,
+		SessionID: sessionID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + service.signature(unsigned), nil
+}
+
+func (service *DefaultTokenService) verify(token string) (tokenClaims, error) {
+	var claims tokenClaims
+	if len(service.Key) < minimumTokenKeyLength {
+		return claims, fmt.Errorf("token key must be at least %d bytes", minimumTokenKeyLength)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return claims, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(service.signature(parts[0]+"."+parts[1]))) {
+		return claims, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, fmt.Errorf("%w: malformed payload", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, fmt.Errorf("%w: malformed payload", ErrInvalidToken)
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+func (service *DefaultTokenService) signature(unsigned string) string {
+	mac := hmac.New(sha256.New, service.Key)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (service *DefaultTokenService) accessTokenTTL() time.Duration {
+	if service.AccessTokenTTL > 0 {
+		return service.AccessTokenTTL
+	}
+	return defaultAccessTokenTTL
+}
+
+func (service *DefaultTokenService) refreshTokenTTL() time.Duration {
+	if service.RefreshTokenTTL > 0 {
+		return service.RefreshTokenTTL
+	}
+	return defaultRefreshTokenTTL
+}
+
+// newOpaqueToken returns a random URL-safe token. Only its hashToken digest
+// is stored.
+func newOpaqueToken() (string, error) {
+	token := make([]byte, opaqueTokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,55 +1,386 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/mail"
 	"github.com/ozoli99/Kaida/models"
 )
 
+// DefaultUserService checks permissions through Authorizer, falling back to
+// DefaultPolicy when it is nil. Password reset and email verification need a
+// Mailer; zero TTLs fall back to one hour for reset tokens and 48 hours for
+// verification tokens. Nil policies fall back to DefaultPasswordPolicy and
+// DefaultLockoutPolicy, and a zero BcryptCost to bcrypt.DefaultCost.
 type DefaultUserService struct {
-	Database db.Database
+	Database   db.Database
+	Authorizer Authorizer
+	Mailer     mail.Mailer
+
+	PasswordResetTTL time.Duration
+	VerificationTTL  time.Duration
+
+	PasswordPolicy *PasswordPolicy
+	LockoutPolicy  *LockoutPolicy
+	BcryptCost     int
 }
 
 var _ UserService = (*DefaultUserService)(nil)
 
-func (userService *DefaultUserService) RegisterUser(username, email, password, role string) (*models.User, error) {
-	if strings.TrimSpace(username) == "" || strings.TrimSpace(email) == "" || strings.TrimSpace(password) == "" {
-		return nil, errors.New("username, email, and password are required")
+// RegisterUser signs up a new customer and mails a verification token when a
+// Mailer is configured. Other roles are only assigned by CreateUser and
+// ChangeRole.
+func (userService *DefaultUserService) RegisterUser(ctx context.Context, username, email, password, timeZone string) (*models.User, error) {
+	user, err := userService.createUser(ctx, models.User{Username: username, Email: email, Role: models.RoleCustomer, TimeZone: timeZone}, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if userService.Mailer != nil {
+		// A failed delivery does not undo the registration; the user can
+		// request another verification mail.
+		userService.sendVerification(ctx, user)
+	}
+	return user, nil
+}
+
+// AuthenticateUser checks the user's credentials. Repeated failures lock the
+// account as set by the lockout policy, and a password hashed with a lower
+// cost than BcryptCost is rehashed after a successful login.
+func (userService *DefaultUserService) AuthenticateUser(ctx context.Context, email, password string) (*models.User, error) {
+	user, err := userService.Database.GetUserByEmail(ctx, email)
+	if err != nil {
+		// Compare against a dummy hash, so unknown addresses take as long to
+		// reject as wrong passwords and cannot be told apart by timing.
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(userService.bcryptCost()), []byte(password))
+		return nil, errors.New("invalid credentials")
 	}
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	matches, err := userService.checkPassword(ctx, user, password)
 	if err != nil {
 		return nil, err
 	}
+	if !matches {
+		return nil, errors.New("invalid credentials")
+	}
+
+	if cost, err := bcrypt.Cost([]byte(user.Password)); err == nil && cost < userService.bcryptCost() {
+		hashed, err := userService.hashPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		if err := userService.Database.UpdatePassword(ctx, user.ID, hashed); err != nil {
+			return nil, err
+		}
+		user.Password = hashed
+	}
+
+	return user, nil
+}
+
+// checkPassword compares password with the user's hash. A locked account is
+// rejected with a *LockedError whatever the password, after the same bcrypt
+// comparison so it takes as long as any other attempt. Failures count towards
+// the lockout policy and a match resets the failure count.
+func (userService *DefaultUserService) checkPassword(ctx context.Context, user *models.User, password string) (bool, error) {
+	now := time.Now()
+	if now.Before(user.LockedUntil) {
+		bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+		return false, &LockedError{Until: user.LockedUntil}
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		failedLogins, err := userService.Database.RecordFailedLogin(ctx, user.ID)
+		if err != nil {
+			return false, err
+		}
+		if delay := userService.lockoutPolicy().delay(failedLogins); delay > 0 {
+			if err := userService.Database.LockUser(ctx, user.ID, now.Add(delay)); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+
+	if user.FailedLogins > 0 || !user.LockedUntil.IsZero() {
+		if err := userService.Database.ResetFailedLogins(ctx, user.ID); err != nil {
+			return false, err
+		}
+		user.FailedLogins = 0
+		user.LockedUntil = time.Time{}
+	}
+	return true, nil
+}
+
+func (userService *DefaultUserService) GetUsers(ctx context.Context, currentUser *models.User, limit, offset int) ([]models.User, error) {
+	if err := userService.authorizer().Authorize(currentUser, ActionRead, ResourceUser, Target{}); err != nil {
+		return nil, err
+	}
+	return userService.Database.GetAllUsers(ctx, limit, offset)
+}
+
+func (userService *DefaultUserService) GetUser(ctx context.Context, currentUser *models.User, userID int) (*models.User, error) {
+	if err := userService.authorizer().Authorize(currentUser, ActionRead, ResourceUser, Target{UserID: userID}); err != nil {
+		return nil, err
+	}
+	return userService.Database.GetUserByID(ctx, userID)
+}
 
-	user := &models.User{
-		Username: username,
-		Email: email,
-		Password: string(hashed),
-		Role: role,
+// UpdateUser updates the profile of user.ID. Roles and passwords are changed
+// through ChangeRole and ChangePassword; moving a user to another site needs
+// the same permission as assigning a role. A new email address has to be
+// verified again.
+func (userService *DefaultUserService) UpdateUser(ctx context.Context, currentUser *models.User, user models.User) (*models.User, error) {
+	if err := userService.authorizer().Authorize(currentUser, ActionUpdate, ResourceUser, Target{UserID: user.ID}); err != nil {
+		return nil, err
 	}
 
-	err = userService.Database.CreateUser(user)
+	existing, err := userService.Database.GetUserByID(ctx, user.ID)
 	if err != nil {
 		return nil, err
 	}
+	if user.Site != existing.Site {
+		if err := userService.authorizer().Authorize(currentUser, ActionAssignRole, ResourceUser, Target{UserID: user.ID}); err != nil {
+			return nil, err
+		}
+	}
 
-	return user, nil
+	if strings.TrimSpace(user.Username) == "" || strings.TrimSpace(user.Email) == "" {
+		return nil, errors.New("username and email are required")
+	}
+	if _, err := models.LoadLocation(user.TimeZone); err != nil {
+		return nil, err
+	}
+
+	user.Role = existing.Role
+	user.Password = existing.Password
+	user.EmailVerified = existing.EmailVerified && user.Email == existing.Email
+	if user.Email != existing.Email {
+		// Tokens mailed to the old address must not verify the new one.
+		if err := userService.Database.InvalidateUserTokens(ctx, user.ID, models.TokenPurposeEmailVerification); err != nil {
+			return nil, err
+		}
+	}
+	if err := userService.Database.UpdateUser(ctx, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
-func (userService *DefaultUserService) AuthenticateUser(email, password string) (*models.User, error) {
-	user, err := userService.Database.GetUserByEmail(email)
+func (userService *DefaultUserService) DeleteUser(ctx context.Context, currentUser *models.User, userID int) error {
+	if err := userService.authorizer().Authorize(currentUser, ActionDelete, ResourceUser, Target{UserID: userID}); err != nil {
+		return err
+	}
+	if _, err := userService.Database.GetUserByID(ctx, userID); err != nil {
+		return err
+	}
+	return userService.Database.DeleteUser(ctx, userID)
+}
+
+// ChangePassword replaces the user's own password after verifying the current
+// one, and signs the user out of every session.
+func (userService *DefaultUserService) ChangePassword(ctx context.Context, currentUser *models.User, userID int, currentPassword, newPassword string) error {
+	if userID != currentUser.ID {
+		return fmt.Errorf("%w: can only change your own password", ErrUnauthorized)
+	}
+
+	user, err := userService.Database.GetUserByID(ctx, userID)
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		return err
+	}
+	matches, err := userService.checkPassword(ctx, user, currentPassword)
+	if err != nil {
+		return err
+	}
+	if !matches {
+		return errors.New("current password is incorrect")
+	}
+	if err := userService.passwordPolicy().Validate(newPassword); err != nil {
+		return err
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, errors.New("invalid credentials")
+	hashed, err := userService.hashPassword(newPassword)
+	if err != nil {
+		return err
 	}
+	if err := userService.Database.UpdatePassword(ctx, userID, hashed); err != nil {
+		return err
+	}
+	return userService.Database.RevokeUserSessions(ctx, userID)
+}
 
-	return user, nil
-}
\ No newline at end of file
+// CreateInitialAdmin creates an admin account without an acting user, so a
+// fresh installation can be set up. It fails once any account uses email.
+func (userService *DefaultUserService) CreateInitialAdmin(ctx context.Context, username, email, password string) (*models.User, error) {
+	if _, err := userService.Database.GetUserByEmail(ctx, email); err == nil {
+		return nil, fmt.Errorf("user %s already exists", email)
+	}
+
+	admin, err := userService.createUser(ctx, models.User{Username: username, Email: email, Role: models.RoleAdmin}, password)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = userService.Database.ChangeUserRole(ctx, models.RoleChange{
+		UserID:    admin.ID,
+		ToRole:    admin.Role,
+		ChangedAt: time.Now().UTC(),
+		Reason:    "initial admin",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return admin, nil
+}
+
+// CreateUser creates an account with any role on behalf of currentUser and
+// records the assigned role.
+func (userService *DefaultUserService) CreateUser(ctx context.Context, currentUser *models.User, user models.User, password string) (*models.User, error) {
+	if err := models.ValidateRole(user.Role); err != nil {
+		return nil, err
+	}
+	if err := userService.authorizer().Authorize(currentUser, ActionCreate, ResourceUser, Target{}); err != nil {
+		return nil, err
+	}
+	if err := userService.authorizer().Authorize(currentUser, ActionAssignRole, ResourceUser, Target{}); err != nil {
+		return nil, err
+	}
+
+	created, err := userService.createUser(ctx, user, password)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = userService.Database.ChangeUserRole(ctx, models.RoleChange{
+		UserID:    created.ID,
+		ToRole:    created.Role,
+		ActorID:   currentUser.ID,
+		ChangedAt: time.Now().UTC(),
+		Reason:    "account created",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// ChangeRole assigns a new role to a user and records the change. Users
+// cannot change their own role, so an admin cannot lock themselves out.
+func (userService *DefaultUserService) ChangeRole(ctx context.Context, currentUser *models.User, userID int, role, reason string) error {
+	if err := models.ValidateRole(role); err != nil {
+		return err
+	}
+	if userID == currentUser.ID {
+		return fmt.Errorf("%w: cannot change your own role", ErrUnauthorized)
+	}
+	if err := userService.authorizer().Authorize(currentUser, ActionAssignRole, ResourceUser, Target{UserID: userID}); err != nil {
+		return err
+	}
+
+	user, err := userService.Database.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Role == role {
+		return nil
+	}
+
+	_, err = userService.Database.ChangeUserRole(ctx, models.RoleChange{
+		UserID:    userID,
+		FromRole:  user.Role,
+		ToRole:    role,
+		ActorID:   currentUser.ID,
+		ChangedAt: time.Now().UTC(),
+		Reason:    reason,
+	})
+	return err
+}
+
+// GetRoleChanges lists the role changes of userID, or of every user when
+// userID is zero.
+func (userService *DefaultUserService) GetRoleChanges(ctx context.Context, currentUser *models.User, userID int) ([]models.RoleChange, error) {
+	if err := userService.authorizer().Authorize(currentUser, ActionRead, ResourceRoleChange, Target{UserID: userID}); err != nil {
+		return nil, err
+	}
+	return userService.Database.GetRoleChanges(ctx, userID)
+}
+
+func (userService *DefaultUserService) createUser(ctx context.Context, user models.User, password string) (*models.User, error) {
+	if strings.TrimSpace(user.Username) == "" || strings.TrimSpace(user.Email) == "" {
+		return nil, errors.New("username, email, and password are required")
+	}
+	if err := userService.passwordPolicy().Validate(password); err != nil {
+		return nil, err
+	}
+
+	if _, err := models.LoadLocation(user.TimeZone); err != nil {
+		return nil, err
+	}
+
+	hashed, err := userService.hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = hashed
+
+	err = userService.Database.CreateUser(ctx, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (userService *DefaultUserService) hashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), userService.bcryptCost())
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+var dummyPasswordHashes sync.Map
+
+// dummyPasswordHash returns a bcrypt hash of the given cost to compare
+// against when there is no account, generated once per cost.
+func dummyPasswordHash(cost int) []byte {
+	if hash, exists := dummyPasswordHashes.Load(cost); exists {
+		return hash.([]byte)
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("kaida-dummy-password"), cost)
+	dummyPasswordHashes.Store(cost, hash)
+	return hash
+}
+
+func (userService *DefaultUserService) bcryptCost() int {
+	if userService.BcryptCost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return userService.BcryptCost
+}
+
+func (userService *DefaultUserService) passwordPolicy() PasswordPolicy {
+	if userService.PasswordPolicy == nil {
+		return DefaultPasswordPolicy
+	}
+	return *userService.PasswordPolicy
+}
+
+func (userService *DefaultUserService) lockoutPolicy() LockoutPolicy {
+	if userService.LockoutPolicy == nil {
+		return DefaultLockoutPolicy
+	}
+	return *userService.LockoutPolicy
+}
+
+func (userService *DefaultUserService) authorizer() Authorizer {
+	return authorizerOrDefault(userService.Authorizer)
+}
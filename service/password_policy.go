@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrWeakPassword = errors.New("weak password")
+
+var ErrAccountLocked = errors.New("account locked")
+
+// LockedError is returned by AuthenticateUser while an account is locked
+// after too many failed logins.
+type LockedError struct {
+	Until time.Time
+}
+
+func (err *LockedError) Error() string {
+	return fmt.Sprintf("%v until %s", ErrAccountLocked, err.Until.UTC().Format(time.RFC3339))
+}
+
+func (err *LockedError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// PasswordPolicy sets the rules new passwords have to follow. Breached holds
+// lower-cased passwords known from breaches, see LoadBreachedPasswords; they
+// are rejected regardless of case.
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	Breached      map[string]struct{}
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+}
+
+func (policy PasswordPolicy) Validate(password string) error {
+	if strings.TrimSpace(password) == "" {
+		return fmt.Errorf("%w: password is required", ErrWeakPassword)
+	}
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		return fmt.Errorf("%w: password must be at least %d characters long", ErrWeakPassword, policy.MinLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, character := range password {
+		switch {
+			case unicode.IsUpper(character):
+				hasUpper = true
+			case unicode.IsLower(character):
+				hasLower = true
+			case unicode.IsDigit(character):
+				hasDigit = true
+			default:
+				hasSymbol = true
+		}
+	}
+	for _, class := range []struct {
+		required bool
+		present  bool
+		name     string
+	}{
+		{policy.RequireUpper, hasUpper, "an upper-case letter"},
+		{policy.RequireLower, hasLower, "a lower-case letter"},
+		{policy.RequireDigit, hasDigit, "a digit"},
+		{policy.RequireSymbol, hasSymbol, "a symbol"},
+	} {
+		if class.required && !class.present {
+			return fmt.Errorf("%w: password must contain %s", ErrWeakPassword, class.name)
+		}
+	}
+
+	if _, breached := policy.Breached[strings.ToLower(password)]; breached {
+		return fmt.Errorf("%w: password appears in a list of breached passwords", ErrWeakPassword)
+	}
+	return nil
+}
+
+// LoadBreachedPasswords reads a breached-password list with one password per
+// line. Blank lines and lines starting with # are skipped.
+func LoadBreachedPasswords(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %v", err)
+	}
+	defer file.Close()
+
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %v", err)
+	}
+	return breached, nil
+}
+
+// LockoutPolicy locks an account for BaseDelay once MaxAttempts logins in a
+// row have failed. Every further failure doubles the delay, up to MaxDelay,
+// or maxLockoutDelay when MaxDelay is zero. A MaxAttempts of zero disables
+// the lockout.
+type LockoutPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// maxLockoutDelay caps the delay of a LockoutPolicy without a MaxDelay, so
+// the doubling cannot overflow time.Duration.
+const maxLockoutDelay = 24 * time.Hour
+
+var DefaultLockoutPolicy = LockoutPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Minute,
+	MaxDelay:    time.Hour,
+}
+
+// delay returns how long to lock an account after failedLogins consecutive
+// failures, or zero if it stays unlocked.
+func (policy LockoutPolicy) delay(failedLogins int) time.Duration {
+	if policy.MaxAttempts <= 0 || failedLogins < policy.MaxAttempts {
+		return 0
+	}
+
+	maxDelay := policy.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = maxLockoutDelay
+	}
+	delay := float64(policy.BaseDelay) * math.Pow(2, float64(failedLogins-policy.MaxAttempts))
+	if delay > float64(maxDelay) {
+		return maxDelay
+	}
+	return time.Duration(delay)
+}
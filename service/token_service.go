@@ -0,0 +1,18 @@
+package service
+
+import (
+	"context"
+
+	"github.com/ozoli99/Kaida/models"
+)
+
+type TokenService interface {
+	IssueTokens(ctx context.Context, user *models.User) (models.TokenPair, error)
+	Authenticate(ctx context.Context, accessToken string) (*models.User, models.Session, error)
+	Refresh(ctx context.Context, refreshToken string) (models.TokenPair, error)
+
+	Logout(ctx context.Context, sessionID int) error
+	LogoutAll(ctx context.Context, userID int) error
+	GetSessions(ctx context.Context, currentUser *models.User, userID int) ([]models.Session, error)
+	RevokeSession(ctx context.Context, currentUser *models.User, sessionID int) error
+}
@@ -1,8 +1,26 @@
 package service
 
-import "github.com/ozoli99/Kaida/models"
+import (
+	"context"
+
+	"github.com/ozoli99/Kaida/models"
+)
 
 type UserService interface {
-	RegisterUser(username, email, password, role string) (*models.User, error)
-	AuthenticateUser(email, password string) (*models.User, error)
-}
\ No newline at end of file
+	RegisterUser(ctx context.Context, username, email, password, timeZone string) (*models.User, error)
+	AuthenticateUser(ctx context.Context, email, password string) (*models.User, error)
+
+	GetUsers(ctx context.Context, currentUser *models.User, limit, offset int) ([]models.User, error)
+	GetUser(ctx context.Context, currentUser *models.User, userID int) (*models.User, error)
+	CreateUser(ctx context.Context, currentUser *models.User, user models.User, password string) (*models.User, error)
+	UpdateUser(ctx context.Context, currentUser *models.User, user models.User) (*models.User, error)
+	DeleteUser(ctx context.Context, currentUser *models.User, userID int) error
+	ChangePassword(ctx context.Context, currentUser *models.User, userID int, currentPassword, newPassword string) error
+
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	RequestEmailVerification(ctx context.Context, currentUser *models.User) error
+	VerifyEmail(ctx context.Context, token string) error
+	ChangeRole(ctx context.Context, currentUser *models.User, userID int, role, reason string) error
+	GetRoleChanges(ctx context.Context, currentUser *models.User, userID int) ([]models.RoleChange, error)
+}
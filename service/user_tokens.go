@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ozoli99/Kaida/mail"
+	"github.com/ozoli99/Kaida/models"
+)
+
+const (
+	defaultPasswordResetTTL = time.Hour
+	defaultVerificationTTL  = 48 * time.Hour
+)
+
+var ErrMailNotConfigured = errors.New("mail is not configured")
+
+// RequestPasswordReset mails a reset token to the account using email. It
+// succeeds for unknown addresses too, so it cannot be used to find out which
+// addresses have accounts.
+func (userService *DefaultUserService) RequestPasswordReset(ctx context.Context, email string) error {
+	if userService.Mailer == nil {
+		return ErrMailNotConfigured
+	}
+
+	user, err := userService.Database.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+
+	token, expiresAt, err := userService.issueUserToken(ctx, user.ID, models.TokenPurposePasswordReset, userService.passwordResetTTL())
+	if err != nil {
+		return err
+	}
+
+	return userService.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Use this token to choose a new password: %s\n\nIt expires at %s. If you did not ask for a reset you can ignore this message.", token, expiresAt.Format(time.RFC1123)),
+	})
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset
+// and signs the user out of every session.
+func (userService *DefaultUserService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if err := userService.passwordPolicy().Validate(newPassword); err != nil {
+		return err
+	}
+
+	consumed, err := userService.Database.ConsumeUserToken(ctx, hashToken(token), models.TokenPurposePasswordReset)
+	if err != nil {
+		return fmt.Errorf("%w: unknown, used or expired reset token", ErrInvalidToken)
+	}
+
+	hashed, err := userService.hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := userService.Database.UpdatePassword(ctx, consumed.UserID, hashed); err != nil {
+		return err
+	}
+	if err := userService.Database.InvalidateUserTokens(ctx, consumed.UserID, models.TokenPurposePasswordReset); err != nil {
+		return err
+	}
+	return userService.Database.RevokeUserSessions(ctx, consumed.UserID)
+}
+
+func (userService *DefaultUserService) RequestEmailVerification(ctx context.Context, currentUser *models.User) error {
+	if userService.Mailer == nil {
+		return ErrMailNotConfigured
+	}
+
+	user, err := userService.Database.GetUserByID(ctx, currentUser.ID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	return userService.sendVerification(ctx, user)
+}
+
+func (userService *DefaultUserService) VerifyEmail(ctx context.Context, token string) error {
+	consumed, err := userService.Database.ConsumeUserToken(ctx, hashToken(token), models.TokenPurposeEmailVerification)
+	if err != nil {
+		return fmt.Errorf("%w: unknown, used or expired verification token", ErrInvalidToken)
+	}
+	return userService.Database.MarkEmailVerified(ctx, consumed.UserID)
+}
+
+func (userService *DefaultUserService) sendVerification(ctx context.Context, user *models.User) error {
+	token, expiresAt, err := userService.issueUserToken(ctx, user.ID, models.TokenPurposeEmailVerification, userService.verificationTTL())
+	if err != nil {
+		return err
+	}
+
+	return userService.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Use this token to verify your email address: %s\n\nIt expires at %s.", token, expiresAt.Format(time.RFC1123)),
+	})
+}
+
+// issueUserToken replaces any outstanding token of the same purpose, so only
+// the most recently mailed one works.
+func (userService *DefaultUserService) issueUserToken(ctx context.Context, userID int, purpose string, ttl time.Duration) (string, time.Time, error) {
+	if err := userService.Database.InvalidateUserTokens(ctx, userID, purpose); err != nil {
+		return "", time.Time{}, err
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(ttl)
+	_, err = userService.Database.CreateUserToken(ctx, models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+func (userService *DefaultUserService) passwordResetTTL() time.Duration {
+	if userService.PasswordResetTTL > 0 {
+		return userService.PasswordResetTTL
+	}
+	return defaultPasswordResetTTL
+}
+
+func (userService *DefaultUserService) verificationTTL() time.Duration {
+	if userService.VerificationTTL > 0 {
+		return userService.VerificationTTL
+	}
+	return defaultVerificationTTL
+}
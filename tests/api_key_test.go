@@ -0,0 +1,115 @@
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ozoli99/Kaida/api"
+	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyService_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	users := &service.DefaultUserService{Database: database}
+	keys := &service.DefaultAPIKeyService{Database: database}
+
+	kiosk, err := createUser(t, users, "kiosk", "kiosk@example.com", "provider")
+	assert.NoError(t, err)
+	other, err := createUser(t, users, "kiosk-other", "kiosk-other@example.com", "provider")
+	assert.NoError(t, err)
+	admin, err := createUser(t, users, "kiosk-admin", "kiosk-admin@example.com", "admin")
+	assert.NoError(t, err)
+
+	_, _, err = keys.CreateAPIKey(ctx, kiosk, 0, "lobby kiosk", []string{"appointments:delete"})
+	assert.Error(t, err, "Unknown scopes should be rejected")
+	_, _, err = keys.CreateAPIKey(ctx, other, kiosk.ID, "stolen", []string{models.ScopeAppointmentsRead})
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Users cannot create keys for others")
+
+	key, plain, err := keys.CreateAPIKey(ctx, kiosk, 0, "lobby kiosk", []string{models.ScopeAppointmentsRead})
+	assert.NoError(t, err, "Creating a key should succeed")
+	assert.Equal(t, kiosk.ID, key.UserID)
+	assert.NotContains(t, key.KeyHash, plain, "Only a hash of the key should be stored")
+	encoded, err := json.Marshal(key)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(encoded), "last_used_at", "Unused keys should not report a last use")
+	assert.NotContains(t, string(encoded), "revoked_at", "Active keys should not report a revocation time")
+
+	user, authenticated, err := keys.AuthenticateAPIKey(ctx, plain)
+	assert.NoError(t, err, "The key should authenticate")
+	assert.Equal(t, kiosk.ID, user.ID)
+	assert.True(t, authenticated.HasScope(models.ScopeAppointmentsRead))
+	assert.False(t, authenticated.HasScope(models.ScopeAppointmentsWrite))
+
+	listed, err := keys.GetAPIKeys(ctx, admin, kiosk.ID)
+	assert.NoError(t, err)
+	assert.Len(t, listed, 1)
+	assert.NotNil(t, listed[0].LastUsedAt, "Using a key should record when it was last used")
+
+	_, authenticated, err = keys.AuthenticateAPIKey(ctx, plain)
+	assert.NoError(t, err)
+	assert.True(t, authenticated.LastUsedAt.Equal(*listed[0].LastUsedAt), "Recent use should not be recorded again")
+
+	_, _, err = keys.AuthenticateAPIKey(ctx, plain[:len(plain)-2]+"xx")
+	assert.True(t, errors.Is(err, service.ErrInvalidAPIKey), "Wrong secrets should be rejected")
+
+	err = keys.RevokeAPIKey(ctx, other, key.ID)
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Users cannot revoke other users' keys")
+	assert.NoError(t, keys.RevokeAPIKey(ctx, kiosk, key.ID), "Owners can revoke their keys")
+	_, _, err = keys.AuthenticateAPIKey(ctx, plain)
+	assert.True(t, errors.Is(err, service.ErrInvalidAPIKey), "Revoked keys should be rejected")
+}
+
+func TestServer_APIKeyMiddleware(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	users := &service.DefaultUserService{Database: database}
+	keys := &service.DefaultAPIKeyService{Database: database}
+	server := &api.Server{APIKeyService: keys}
+
+	partner, err := createUser(t, users, "partner", "partner@example.com", "provider")
+	assert.NoError(t, err)
+	_, plain, err := keys.CreateAPIKey(ctx, partner, 0, "partner sync", []string{models.ScopeAppointmentsRead})
+	assert.NoError(t, err)
+
+	var seenUserID int
+	handler := server.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contextUser, ok := api.UserFromContext(r.Context()); ok {
+			seenUserID = contextUser.ID
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/appointments", nil)
+	request.Header.Set("X-API-Key", plain)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, partner.ID, seenUserID, "The key owner should be placed in the request context")
+
+	request = httptest.NewRequest(http.MethodPost, "/appointments", nil)
+	request.Header.Set("Authorization", "ApiKey "+plain)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusForbidden, recorder.Code, "Writes need the appointments:write scope")
+
+	request = httptest.NewRequest(http.MethodGet, "/appointments", nil)
+	request.Header.Set("X-API-Key", "kaida_unknown_secret")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code, "Unknown keys should be rejected")
+}
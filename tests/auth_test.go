@@ -0,0 +1,192 @@
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ozoli99/Kaida/api"
+	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testTokenKey = []byte("0123456789abcdef0123456789abcdef")
+
+// createUser creates an account with any role, acting as an admin.
+func createUser(t *testing.T, users *service.DefaultUserService, username, email, role string) (*models.User, error) {
+	t.Helper()
+	return users.CreateUser(context.Background(), &models.User{ID: 1, Role: models.RoleAdmin}, models.User{Username: username, Email: email, Role: role}, "secret-password")
+}
+
+func TestTokenService_IssueAndAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	users := &service.DefaultUserService{Database: database}
+	tokens := &service.DefaultTokenService{Database: database, Key: testTokenKey}
+
+	user, err := createUser(t, users, "tokenuser", "token@example.com", "provider")
+	assert.NoError(t, err, "Registering should succeed")
+
+	pair, err := tokens.IssueTokens(ctx, user)
+	assert.NoError(t, err, "Issuing tokens should succeed")
+	assert.Equal(t, "Bearer", pair.TokenType)
+	assert.Equal(t, 900, pair.ExpiresIn)
+
+	authenticated, _, err := tokens.Authenticate(ctx, pair.AccessToken)
+	assert.NoError(t, err, "The access token should be valid")
+	assert.Equal(t, user.ID, authenticated.ID)
+	assert.Equal(t, "provider", authenticated.Role)
+
+	_, _, err = tokens.Authenticate(ctx, pair.RefreshToken)
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Refresh tokens cannot be used as access tokens")
+
+	_, _, err = tokens.Authenticate(ctx, pair.AccessToken[:len(pair.AccessToken)-2]+"xx")
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Tampered tokens should be rejected")
+
+	other := &service.DefaultTokenService{Database: database, Key: []byte("another-key-another-key-another-key")}
+	_, _, err = other.Authenticate(ctx, pair.AccessToken)
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Tokens signed with another key should be rejected")
+
+	refreshed, err := tokens.Refresh(ctx, pair.RefreshToken)
+	assert.NoError(t, err, "Refreshing should succeed")
+	_, _, err = tokens.Authenticate(ctx, refreshed.AccessToken)
+	assert.NoError(t, err)
+
+	expiring := &service.DefaultTokenService{Database: database, Key: testTokenKey, AccessTokenTTL: time.Nanosecond}
+	expired, err := expiring.IssueTokens(ctx, user)
+	assert.NoError(t, err)
+	_, _, err = expiring.Authenticate(ctx, expired.AccessToken)
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Expired tokens should be rejected")
+
+	short := &service.DefaultTokenService{Database: database, Key: []byte("short")}
+	_, err = short.IssueTokens(ctx, user)
+	assert.Error(t, err, "Short keys should be refused")
+}
+
+func TestTokenService_Sessions(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	users := &service.DefaultUserService{Database: database}
+	tokens := &service.DefaultTokenService{Database: database, Key: testTokenKey}
+
+	user, err := users.RegisterUser(ctx, "sessionuser", "session@example.com", "secret-password", "")
+	assert.NoError(t, err)
+	other, err := users.RegisterUser(ctx, "sessionother", "session-other@example.com", "secret-password", "")
+	assert.NoError(t, err)
+	admin, err := createUser(t, users, "sessionadmin", "session-admin@example.com", "admin")
+	assert.NoError(t, err)
+
+	first, err := tokens.IssueTokens(ctx, user)
+	assert.NoError(t, err)
+	rotated, err := tokens.Refresh(ctx, first.RefreshToken)
+	assert.NoError(t, err, "Refreshing should succeed")
+	assert.NotEqual(t, first.RefreshToken, rotated.RefreshToken, "Refresh tokens should rotate")
+
+	_, err = tokens.Refresh(ctx, first.RefreshToken)
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Reusing a rotated refresh token should fail")
+	_, err = tokens.Refresh(ctx, rotated.RefreshToken)
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Reuse should revoke the whole session")
+	_, _, err = tokens.Authenticate(ctx, rotated.AccessToken)
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Access tokens of a revoked session should be rejected")
+
+	second, err := tokens.IssueTokens(ctx, user)
+	assert.NoError(t, err)
+	_, session, err := tokens.Authenticate(ctx, second.AccessToken)
+	assert.NoError(t, err)
+	assert.NoError(t, tokens.Logout(ctx, session.ID), "Logging out should succeed")
+	_, _, err = tokens.Authenticate(ctx, second.AccessToken)
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Logged out sessions should be rejected")
+
+	third, err := tokens.IssueTokens(ctx, user)
+	assert.NoError(t, err)
+	fourth, err := tokens.IssueTokens(ctx, user)
+	assert.NoError(t, err)
+	assert.NoError(t, tokens.LogoutAll(ctx, user.ID), "Logging out everywhere should succeed")
+	for _, pair := range []string{third.AccessToken, fourth.AccessToken} {
+		_, _, err = tokens.Authenticate(ctx, pair)
+		assert.True(t, errors.Is(err, service.ErrInvalidToken), "Every session should be revoked")
+	}
+
+	fifth, err := tokens.IssueTokens(ctx, user)
+	assert.NoError(t, err)
+	_, session, err = tokens.Authenticate(ctx, fifth.AccessToken)
+	assert.NoError(t, err)
+
+	_, err = tokens.GetSessions(ctx, other, user.ID)
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Users cannot list other users' sessions")
+	err = tokens.RevokeSession(ctx, other, session.ID)
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Users cannot revoke other users' sessions")
+
+	sessions, err := tokens.GetSessions(ctx, admin, user.ID)
+	assert.NoError(t, err, "Admins can list any user's sessions")
+	assert.Len(t, sessions, 5)
+	for _, listed := range sessions {
+		encoded, err := json.Marshal(listed)
+		assert.NoError(t, err)
+		if listed.ID == session.ID {
+			assert.NotContains(t, string(encoded), "revoked_at", "Active sessions should not report a revocation time")
+		} else {
+			assert.NotNil(t, listed.RevokedAt, "Revoked sessions should report when they were revoked")
+		}
+	}
+	assert.NoError(t, tokens.RevokeSession(ctx, admin, session.ID), "Admins can revoke any session")
+	_, _, err = tokens.Authenticate(ctx, fifth.AccessToken)
+	assert.True(t, errors.Is(err, service.ErrInvalidToken))
+}
+
+func TestServer_AuthMiddleware(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	users := &service.DefaultUserService{Database: database}
+	tokens := &service.DefaultTokenService{Database: database, Key: testTokenKey}
+	server := &api.Server{TokenService: tokens}
+
+	user, err := users.RegisterUser(ctx, "middleware", "middleware@example.com", "secret-password", "")
+	assert.NoError(t, err)
+	pair, err := tokens.IssueTokens(ctx, user)
+	assert.NoError(t, err)
+
+	var seenUserID int
+	handler := server.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contextUser, ok := api.UserFromContext(r.Context()); ok {
+			seenUserID = contextUser.ID
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/appointments", nil)
+	request.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, user.ID, seenUserID, "The user should be placed in the request context")
+
+	request = httptest.NewRequest(http.MethodGet, "/appointments", nil)
+	request.Header.Set("Authorization", "Bearer not-a-token")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code, "Invalid tokens should be rejected")
+
+	assert.NoError(t, tokens.LogoutAll(ctx, user.ID))
+	request = httptest.NewRequest(http.MethodGet, "/appointments", nil)
+	request.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code, "Revoked sessions should be rejected")
+}
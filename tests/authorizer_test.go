@@ -0,0 +1,124 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppointmentService_ReceptionistAndAuditor(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointments := &service.DefaultAppointmentService{Database: database}
+	receptionist := &models.User{ID: 1201, Role: models.RoleReceptionist, Site: "downtown"}
+	auditor := &models.User{ID: 1202, Role: models.RoleAuditor}
+
+	appointment := models.Appointment{
+		CustomerName: "Front desk",
+		Time:         time.Date(2030, time.October, 1, 9, 0, 0, 0, time.UTC),
+		Duration:     30,
+		CustomerID:   1203,
+		ProviderID:   1204,
+		Resource:     "Reception Room",
+		Site:         "downtown",
+	}
+	appointmentID, err := appointments.CreateAppointment(ctx, receptionist, appointment)
+	assert.NoError(t, err, "Receptionists should book appointments at their site")
+
+	appointment.Site = "uptown"
+	appointment.Time = appointment.Time.Add(time.Hour)
+	_, err = appointments.CreateAppointment(ctx, receptionist, appointment)
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Receptionists cannot book at other sites")
+
+	assert.NoError(t, appointments.ChangeAppointmentStatus(ctx, receptionist, appointmentID, models.StatusCheckedIn, ""), "Receptionists should check customers in")
+
+	listed, err := appointments.GetAllAppointments(ctx, receptionist, 100, 0, map[string]interface{}{}, "")
+	assert.NoError(t, err)
+	for _, listedAppointment := range listed {
+		assert.Equal(t, "downtown", listedAppointment.Site, "Receptionists should only list their site")
+	}
+
+	_, err = appointments.GetStatusHistory(ctx, auditor, appointmentID)
+	assert.NoError(t, err, "Auditors should read any appointment")
+	err = appointments.ChangeAppointmentStatus(ctx, auditor, appointmentID, models.StatusCancelled, "")
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Auditors are read-only")
+	err = appointments.DeleteAppointment(ctx, auditor, appointmentID)
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Auditors are read-only")
+
+	stranger := &models.User{ID: 1205, Role: "janitor"}
+	_, err = appointments.GetAllAppointments(ctx, stranger, 10, 0, map[string]interface{}{}, "")
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Unknown roles should see nothing")
+}
+
+func TestPolicy_CustomRules(t *testing.T) {
+	policy, err := service.ParsePolicy([]byte(`{"rules": [
+		{"role": "customer", "action": "read", "resource": "appointment", "condition": "customer"},
+		{"role": "provider", "action": "*", "resource": "appointment", "condition": "provider"}
+	]}`))
+	assert.NoError(t, err, "Parsing a policy should succeed")
+
+	customer := &models.User{ID: 1, Role: models.RoleCustomer}
+	provider := &models.User{ID: 2, Role: models.RoleProvider}
+	target := service.Target{CustomerID: 1, ProviderID: 2}
+
+	assert.NoError(t, policy.Authorize(customer, service.ActionRead, service.ResourceAppointment, target))
+	assert.Error(t, policy.Authorize(customer, service.ActionCreate, service.ResourceAppointment, target), "Customers may only read under this policy")
+	assert.NoError(t, policy.Authorize(provider, service.StatusAction(models.StatusCompleted), service.ResourceAppointment, target))
+	assert.Error(t, policy.Authorize(provider, service.ActionRead, service.ResourceAppointment, service.Target{ProviderID: 3}))
+
+	filters, err := policy.Filters(customer, service.ActionRead, service.ResourceAppointment)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"customer_id": 1}, filters)
+
+	_, err = service.ParsePolicy([]byte(`{"rules": [{"role": "customer", "action": "read", "resource": "appointment", "condition": "friends"}]}`))
+	assert.Error(t, err, "Unknown conditions should be rejected")
+}
+
+func TestAppointmentService_DefaultsOwnerFromPolicy(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointments := &service.DefaultAppointmentService{Database: database}
+	customer := &models.User{ID: 1301, Role: models.RoleCustomer}
+	receptionist := &models.User{ID: 1302, Role: models.RoleReceptionist, Site: "harbour"}
+	start := time.Date(2030, time.November, 4, 9, 0, 0, 0, time.UTC)
+
+	customerBooking, err := appointments.CreateAppointment(ctx, customer, models.Appointment{CustomerName: "Self", Time: start, Duration: 30})
+	assert.NoError(t, err, "Customers should book for themselves by default")
+	stored, err := database.GetAppointmentByID(ctx, customerBooking)
+	assert.NoError(t, err)
+	assert.Equal(t, customer.ID, stored.CustomerID)
+
+	_, err = appointments.CreateAppointment(ctx, customer, models.Appointment{CustomerName: "Other", Time: start.Add(time.Hour), Duration: 30, CustomerID: 1399})
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Customers cannot book for someone else")
+
+	receptionBooking, err := appointments.CreateAppointment(ctx, receptionist, models.Appointment{CustomerName: "Desk", Time: start, Duration: 30, CustomerID: 1303})
+	assert.NoError(t, err, "Receptionists should book at their own site by default")
+	stored, err = database.GetAppointmentByID(ctx, receptionBooking)
+	assert.NoError(t, err)
+	assert.Equal(t, "harbour", stored.Site)
+
+	policy, err := service.ParsePolicy([]byte(`{"rules": [
+		{"role": "assistant", "action": "*", "resource": "appointment", "condition": "provider"}
+	]}`))
+	assert.NoError(t, err)
+	custom := &service.DefaultAppointmentService{Database: database, Authorizer: policy}
+	assistant := &models.User{ID: 1304, Role: "assistant"}
+	assistantBooking, err := custom.CreateAppointment(ctx, assistant, models.Appointment{CustomerName: "Assisted", Time: start, Duration: 30})
+	assert.NoError(t, err, "Custom policies should decide which owner is filled in")
+	stored, err = database.GetAppointmentByID(ctx, assistantBooking)
+	assert.NoError(t, err)
+	assert.Equal(t, assistant.ID, stored.ProviderID)
+}
@@ -0,0 +1,150 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAvailabilitySchedule_Windows(t *testing.T) {
+	schedule := models.AvailabilitySchedule{
+		WorkingHours: []models.WorkingHours{
+			{ProviderID: 1, Weekday: time.Monday, StartTime: "09:00", EndTime: "12:00", TimeZone: "Europe/Budapest"},
+			{ProviderID: 1, Weekday: time.Monday, StartTime: "13:00", EndTime: "17:00", TimeZone: "Europe/Budapest"},
+			{ProviderID: 1, Weekday: time.Tuesday, StartTime: "09:00", EndTime: "17:00", TimeZone: "Europe/Budapest"},
+		},
+		Overrides: []models.AvailabilityOverride{
+			{ProviderID: 1, Date: "2025-06-10", Available: false, Reason: "Holiday"},
+		},
+	}
+
+	budapest, _ := time.LoadLocation("Europe/Budapest")
+	from := time.Date(2025, time.June, 9, 0, 0, 0, 0, budapest)
+	windows := schedule.Windows(from, from.AddDate(0, 0, 2))
+	assert.Equal(t, []models.TimeRange{
+		{Start: time.Date(2025, time.June, 9, 9, 0, 0, 0, budapest), End: time.Date(2025, time.June, 9, 12, 0, 0, 0, budapest)},
+		{Start: time.Date(2025, time.June, 9, 13, 0, 0, 0, budapest), End: time.Date(2025, time.June, 9, 17, 0, 0, 0, budapest)},
+	}, windows, "The holiday should close Tuesday entirely")
+
+	assert.True(t, schedule.Covers(time.Date(2025, time.June, 9, 10, 0, 0, 0, budapest), time.Date(2025, time.June, 9, 11, 0, 0, 0, budapest)))
+	assert.False(t, schedule.Covers(time.Date(2025, time.June, 9, 11, 30, 0, 0, budapest), time.Date(2025, time.June, 9, 13, 30, 0, 0, budapest)), "Lunch break should not be bookable")
+	assert.False(t, schedule.Covers(time.Date(2025, time.June, 9, 3, 0, 0, 0, budapest), time.Date(2025, time.June, 9, 4, 0, 0, 0, budapest)), "Night slots should not be bookable")
+}
+
+func TestAppointmentService_EnforcesAvailability(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	availability := &service.DefaultAvailabilityService{Database: database}
+	appointments := &service.DefaultAppointmentService{Database: database, Availability: availability}
+	admin := &models.User{ID: 1, Role: "admin"}
+
+	day := time.Now().UTC().AddDate(0, 0, 7)
+	_, err = availability.CreateWorkingHours(ctx, admin, models.WorkingHours{ProviderID: 501, Weekday: day.Weekday(), StartTime: "09:00", EndTime: "17:00"})
+	assert.NoError(t, err, "Creating working hours should succeed")
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{
+		CustomerName: "Night Owl",
+		Time:         time.Date(day.Year(), day.Month(), day.Day(), 3, 0, 0, 0, time.UTC),
+		Duration:     30,
+		Status:       "Scheduled",
+		Resource:     "Room Availability",
+		ProviderID:   501,
+	})
+	assert.True(t, errors.Is(err, service.ErrOutsideAvailability), "Booking outside working hours should fail")
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{
+		CustomerName: "Early Bird",
+		Time:         time.Date(day.Year(), day.Month(), day.Day(), 9, 0, 0, 0, time.UTC),
+		Duration:     30,
+		Status:       "Scheduled",
+		Resource:     "Room Availability",
+		ProviderID:   501,
+	})
+	assert.NoError(t, err, "Booking inside working hours should succeed")
+}
+
+func TestAppointmentService_FindAvailableSlots(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	availability := &service.DefaultAvailabilityService{Database: database}
+	appointments := &service.DefaultAppointmentService{Database: database, Availability: availability}
+	admin := &models.User{ID: 1, Role: "admin"}
+
+	day := time.Date(2030, time.March, 4, 0, 0, 0, 0, time.UTC)
+	_, err = availability.CreateWorkingHours(ctx, admin, models.WorkingHours{ProviderID: 601, Weekday: day.Weekday(), StartTime: "08:00", EndTime: "13:00"})
+	assert.NoError(t, err, "Creating working hours should succeed")
+
+	_, err = database.CreateAppointment(ctx, models.Appointment{CustomerName: "Booked", Time: day.Add(10 * time.Hour), Duration: 45, Status: "Scheduled", Resource: "Slots A", ProviderID: 601})
+	assert.NoError(t, err)
+	_, err = database.CreateAppointment(ctx, models.Appointment{CustomerName: "Daily", Time: day.AddDate(0, 0, -2).Add(11*time.Hour + 30*time.Minute), Duration: 30, RecurrenceRule: "daily", Status: "Scheduled", Resource: "Slots B", ProviderID: 601})
+	assert.NoError(t, err)
+	_, err = database.CreateAppointment(ctx, models.Appointment{CustomerName: "Cancelled", Time: day.Add(8 * time.Hour), Duration: 60, Status: "Cancelled", Resource: "Slots C", ProviderID: 601})
+	assert.NoError(t, err)
+
+	criteria := models.SlotCriteria{
+		ProviderID:   601,
+		From:         day,
+		To:           day.AddDate(0, 0, 1),
+		Duration:     45,
+		BufferBefore: 15,
+		BufferAfter:  15,
+	}
+	slots, err := appointments.FindAvailableSlots(ctx, admin, criteria)
+	assert.NoError(t, err, "Searching for slots should succeed")
+
+	var starts []string
+	for _, slot := range slots {
+		starts = append(starts, slot.Start.UTC().Format("15:04"))
+	}
+	assert.Equal(t, []string{"08:00", "08:15", "08:30", "08:45", "09:00", "12:15"}, starts, "Slots should respect working hours, bookings, recurring occurrences and buffers")
+
+	criteria.PreferredTime = day.Add(12 * time.Hour)
+	criteria.Limit = 2
+	slots, err = appointments.FindAvailableSlots(ctx, admin, criteria)
+	assert.NoError(t, err)
+	assert.Len(t, slots, 2)
+	assert.Equal(t, day.Add(12*time.Hour+15*time.Minute), slots[0].Start, "The slot closest to the preferred time should rank first")
+
+	criteria.ProviderID = 0
+	_, err = appointments.FindAvailableSlots(ctx, admin, criteria)
+	assert.Error(t, err, "A provider or resource is required")
+}
+
+func TestAppointmentService_SuggestAlternativeTimes(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointments := &service.DefaultAppointmentService{Database: database}
+	admin := &models.User{ID: 1, Role: "admin"}
+
+	day := time.Date(2030, time.April, 2, 0, 0, 0, 0, time.UTC)
+	_, err = database.CreateAppointment(ctx, models.Appointment{CustomerName: "Alice", Time: day.Add(10 * time.Hour), Duration: 90, Status: "Scheduled", Resource: "Room C"})
+	assert.NoError(t, err)
+	_, err = database.CreateAppointment(ctx, models.Appointment{CustomerName: "Bob", Time: day.Add(12 * time.Hour), Duration: 60, Status: "Scheduled", Resource: "Room D", ProviderID: 701})
+	assert.NoError(t, err)
+
+	requested := models.Appointment{CustomerName: "Carol", Time: day.Add(10 * time.Hour), Duration: 60, Resource: "Room C", ProviderID: 701}
+	suggestions, err := appointments.SuggestAlternativeTimes(ctx, admin, requested, 2)
+	assert.NoError(t, err, "Suggesting alternative times should succeed")
+
+	var starts []string
+	for _, suggestion := range suggestions {
+		starts = append(starts, suggestion.Start.UTC().Format("15:04"))
+	}
+	assert.Equal(t, []string{"08:45", "09:00", "13:00", "13:15"}, starts, "Suggestions should avoid both resource and provider bookings on either side")
+}
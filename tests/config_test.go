@@ -0,0 +1,80 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSQLiteDatabase_Config(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.NewSQLiteDatabase(db.Config{
+		DSN:             "file:" + filepath.Join(t.TempDir(), "configured.db"),
+		MaxOpenConns:    3,
+		ConnMaxLifetime: time.Minute,
+		BusyTimeout:     2 * time.Second,
+	})
+	assert.NoError(t, err, "Opening a configured database should succeed")
+	defer database.Connection.Close()
+
+	assert.Equal(t, 3, database.Connection.Stats().MaxOpenConnections)
+
+	var busyTimeout int
+	assert.NoError(t, database.Connection.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout))
+	assert.Equal(t, 2000, busyTimeout, "The busy timeout should be passed to SQLite")
+
+	_, err = database.CreateAppointment(ctx, models.Appointment{CustomerName: "configured", Time: time.Now(), Duration: 30, Status: models.StatusConfirmed})
+	assert.NoError(t, err, "The schema should be migrated")
+}
+
+func TestNewSQLiteDatabase_WrapsConnection(t *testing.T) {
+	ctx := context.Background()
+	connection, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "wrapped.db"))
+	assert.NoError(t, err)
+	defer connection.Close()
+
+	database, err := db.NewSQLiteDatabase(db.Config{DB: connection, SkipMigrations: true})
+	assert.NoError(t, err)
+	assert.Same(t, connection, database.Connection, "An existing pool should be used as it is")
+
+	_, err = database.GetAllUsers(ctx, 10, 0)
+	assert.Error(t, err, "Migrations should be skipped when asked to")
+
+	database, err = db.NewSQLiteDatabase(db.Config{DB: connection})
+	assert.NoError(t, err)
+	_, err = database.GetAllUsers(ctx, 10, 0)
+	assert.NoError(t, err, "A wrapped connection should be migrated")
+}
+
+func TestDatabase_ContextCancellation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "context.db")
+	database, err := db.NewSQLiteDatabase(db.Config{DSN: "file:" + path})
+	assert.NoError(t, err)
+	defer database.Connection.Close()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = database.GetAllUsers(cancelled, 10, 0)
+	assert.Error(t, err, "Queries should not run with a cancelled context")
+
+	users := &service.DefaultUserService{Database: database}
+	_, err = users.RegisterUser(cancelled, "cancelled", "cancelled@example.com", "secret-password", "")
+	assert.Error(t, err, "Services should pass the context on")
+	_, err = database.GetUserByEmail(context.Background(), "cancelled@example.com")
+	assert.True(t, errors.Is(err, sql.ErrNoRows), "Nothing should be written with a cancelled context")
+
+	limited, err := db.NewSQLiteDatabase(db.Config{DSN: "file:" + path, QueryTimeout: time.Nanosecond})
+	assert.NoError(t, err)
+	defer limited.Connection.Close()
+	_, err = limited.GetAllUsers(context.Background(), 10, 0)
+	assert.Error(t, err, "QueryTimeout should bound every query")
+}
@@ -0,0 +1,388 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppointmentService_ResourceConflict(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointments := &service.DefaultAppointmentService{Database: database}
+	admin := &models.User{ID: 1, Role: "admin"}
+
+	conflictingAppointment := models.Appointment{
+		CustomerName: "Jane Doe",
+		Time:         time.Now().Add(2 * time.Hour),
+		Duration:     60,
+		Status:       "Scheduled",
+		Resource:     "Room B",
+	}
+	conflictingID, _ := appointments.CreateAppointment(ctx, admin, conflictingAppointment)
+
+	newAppointment := models.Appointment{
+		CustomerName: "John Smith",
+		Time:         conflictingAppointment.Time.Add(30 * time.Minute),
+		Duration:     60,
+		Status:       "Scheduled",
+		Resource:     "Room B",
+	}
+	_, err = appointments.CreateAppointment(ctx, admin, newAppointment)
+	assert.Error(t, err, "Creating a conflicting appointment should fail")
+
+	var conflict *models.ConflictError
+	assert.True(t, errors.As(err, &conflict), "The error should be a ConflictError")
+	assert.Equal(t, models.ConflictResource, conflict.Kind)
+	assert.Equal(t, []int{conflictingID}, conflict.AppointmentIDs)
+}
+
+func TestAppointmentService_ConflictDimensions(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointments := &service.DefaultAppointmentService{Database: database}
+	admin := &models.User{ID: 1, Role: "admin"}
+	start := time.Date(2030, time.June, 3, 9, 0, 0, 0, time.UTC)
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "John Smith", Time: start, Duration: 60, Status: "Scheduled", CustomerID: 801, ProviderID: 811})
+	assert.NoError(t, err)
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "John Smith", Time: start, Duration: 60, Status: "Scheduled", CustomerID: 802, ProviderID: 812})
+	assert.NoError(t, err, "Customers sharing a name should not block each other")
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Someone Else", Time: start.Add(30 * time.Minute), Duration: 60, Status: "Scheduled", CustomerID: 803, ProviderID: 811})
+	var conflict *models.ConflictError
+	assert.True(t, errors.As(err, &conflict), "A provider should not be double-booked")
+	assert.Equal(t, models.ConflictProvider, conflict.Kind)
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "John Smith", Time: start.Add(15 * time.Minute), Duration: 30, Status: "Scheduled", CustomerID: 801, ProviderID: 813})
+	assert.True(t, errors.As(err, &conflict), "A customer should not be double-booked")
+	assert.Equal(t, models.ConflictCustomer, conflict.Kind)
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Cancelled", Time: start.Add(2 * time.Hour), Duration: 60, Status: "Cancelled", ProviderID: 811})
+	assert.NoError(t, err)
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "After Cancel", Time: start.Add(2 * time.Hour), Duration: 60, Status: "Scheduled", ProviderID: 811})
+	assert.NoError(t, err, "Cancelled appointments should not cause conflicts")
+}
+
+func TestAppointmentService_ResourceCapacity(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	policy := service.DefaultConflictPolicy
+	policy.ResourceCapacities = map[string]int{"Group Room": 2}
+	appointments := &service.DefaultAppointmentService{Database: database, ConflictPolicy: &policy}
+	admin := &models.User{ID: 1, Role: "admin"}
+	start := time.Date(2030, time.June, 4, 9, 0, 0, 0, time.UTC)
+
+	for i, offset := range []time.Duration{0, 30 * time.Minute} {
+		_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Group", Time: start.Add(offset), Duration: 60, Status: "Scheduled", Resource: "Group Room", CustomerID: 820 + i})
+		assert.NoError(t, err, "The group room should accept two overlapping bookings")
+	}
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Group", Time: start.Add(15 * time.Minute), Duration: 30, Status: "Scheduled", Resource: "Group Room", CustomerID: 830})
+	var conflict *models.ConflictError
+	assert.True(t, errors.As(err, &conflict), "A third concurrent booking should exceed the capacity")
+	assert.Equal(t, models.ConflictResource, conflict.Kind)
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Group", Time: start.Add(60 * time.Minute), Duration: 30, Status: "Scheduled", Resource: "Group Room", CustomerID: 831})
+	assert.NoError(t, err, "Only one booking remains after the first one ends")
+}
+
+func TestAppointmentService_ConflictErrorCarriesSuggestions(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointments := &service.DefaultAppointmentService{Database: database}
+	admin := &models.User{ID: 1, Role: "admin"}
+
+	booked := models.Appointment{CustomerName: "Dana", Time: time.Date(2030, time.May, 7, 9, 0, 0, 0, time.UTC), Duration: 60, Status: "Scheduled", Resource: "Room Conflict"}
+	bookedID, err := appointments.CreateAppointment(ctx, admin, booked)
+	assert.NoError(t, err)
+
+	booked.CustomerName = "Eve"
+	_, err = appointments.CreateAppointment(ctx, admin, booked)
+
+	var conflict *models.ConflictError
+	assert.True(t, errors.As(err, &conflict), "The error should be a ConflictError")
+	assert.Equal(t, models.ConflictResource, conflict.Kind)
+	assert.Equal(t, []int{bookedID}, conflict.AppointmentIDs)
+	assert.NotEmpty(t, conflict.Suggestions, "Alternative times should be suggested")
+	for _, suggestion := range conflict.Suggestions {
+		assert.False(t, suggestion.Start.Before(booked.EndTime()) && suggestion.End.After(booked.Time), "Suggestions should not overlap the booking")
+	}
+}
+
+func TestAppointmentService_ConflictOnUpdateAndReactivation(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointments := &service.DefaultAppointmentService{Database: database}
+	admin := &models.User{ID: 1, Role: "admin"}
+	start := time.Date(2030, time.July, 1, 9, 0, 0, 0, time.UTC)
+
+	occupied := models.Appointment{CustomerName: "Occupied", Time: start, Duration: 60, Status: "Scheduled", ProviderID: 901}
+	_, err = appointments.CreateAppointment(ctx, admin, occupied)
+	assert.NoError(t, err)
+
+	moving := models.Appointment{CustomerName: "Moving", Time: start.Add(2 * time.Hour), Duration: 60, Status: "Scheduled", ProviderID: 901}
+	moving.ID, err = appointments.CreateAppointment(ctx, admin, moving)
+	assert.NoError(t, err)
+
+	moving.Time = start.Add(2*time.Hour + 30*time.Minute)
+	assert.NoError(t, appointments.UpdateAppointment(ctx, admin, moving), "Overlapping its own previous slot should be allowed")
+
+	moving.Time = start.Add(30 * time.Minute)
+	err = appointments.UpdateAppointment(ctx, admin, moving)
+	var conflict *models.ConflictError
+	assert.True(t, errors.As(err, &conflict), "Moving onto an occupied slot should fail")
+
+	cancelled := models.Appointment{CustomerName: "Cancelled", Time: start, Duration: 60, Status: "Cancelled", ProviderID: 901}
+	cancelled.ID, err = appointments.CreateAppointment(ctx, admin, cancelled)
+	assert.NoError(t, err)
+	err = appointments.ChangeAppointmentStatus(ctx, admin, cancelled.ID, models.StatusConfirmed, "")
+	assert.True(t, errors.As(err, &conflict), "Reactivating onto an occupied slot should fail")
+}
+
+func TestAppointmentService_ConflictOnRecurringOccurrences(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointments := &service.DefaultAppointmentService{Database: database}
+	admin := &models.User{ID: 1, Role: "admin"}
+	start := time.Date(2030, time.August, 5, 9, 0, 0, 0, time.UTC)
+
+	blocker := models.Appointment{CustomerName: "Blocker", Time: start.AddDate(0, 0, 14), Duration: 60, Status: "Scheduled", Resource: "Room Weekly"}
+	blockerID, err := appointments.CreateAppointment(ctx, admin, blocker)
+	assert.NoError(t, err)
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Weekly", Time: start, Duration: 60, RecurrenceRule: "FREQ=WEEKLY;COUNT=4", Status: "Scheduled", Resource: "Room Weekly"})
+	var conflict *models.ConflictError
+	assert.True(t, errors.As(err, &conflict), "The third occurrence should conflict")
+	assert.Equal(t, []int{blockerID}, conflict.AppointmentIDs)
+	assert.True(t, start.AddDate(0, 0, 14).Equal(conflict.Time), "The conflict should name the occurrence")
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Weekly", Time: start, Duration: 60, RecurrenceRule: "FREQ=WEEKLY;COUNT=2", Status: "Scheduled", Resource: "Room Weekly"})
+	assert.NoError(t, err, "A series ending before the booking should not conflict")
+}
+
+func TestDatabase_OverlapGuard(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.NewSQLiteDatabase(db.Config{DSN: "file:" + filepath.Join(t.TempDir(), "overlap.db")})
+	assert.NoError(t, err)
+	defer database.Connection.Close()
+
+	start := time.Date(2031, time.May, 5, 9, 0, 0, 0, time.UTC)
+	_, err = database.CreateAppointment(ctx, models.Appointment{CustomerName: "First", Time: start, Duration: 60, Status: models.StatusConfirmed, Resource: "Room G", ProviderID: 951})
+	assert.NoError(t, err)
+
+	var conflict *models.ConflictError
+	_, err = database.CreateAppointment(ctx, models.Appointment{CustomerName: "Second", Time: start.Add(30 * time.Minute), Duration: 60, Status: models.StatusConfirmed, ProviderID: 951})
+	assert.True(t, errors.As(err, &conflict), "The database should reject an overlapping provider booking")
+	assert.Equal(t, models.ConflictProvider, conflict.Kind)
+
+	_, err = database.CreateAppointment(ctx, models.Appointment{CustomerName: "Second", Time: start.Add(30 * time.Minute), Duration: 60, Status: models.StatusConfirmed, Resource: "Room G"})
+	assert.True(t, errors.As(err, &conflict), "The database should reject an overlapping resource booking")
+	assert.Equal(t, models.ConflictResource, conflict.Kind)
+
+	_, err = database.CreateAppointment(ctx, models.Appointment{CustomerName: "Shared", Time: start, Duration: 60, Status: models.StatusConfirmed, Resource: "Room G", SharedResource: true})
+	assert.NoError(t, err, "Shared resources should be left to the conflict policy")
+
+	laterID, err := database.CreateAppointment(ctx, models.Appointment{CustomerName: "Later", Time: start.Add(time.Hour), Duration: 60, Status: models.StatusConfirmed, Resource: "Room G", ProviderID: 951})
+	assert.NoError(t, err, "Back-to-back bookings should not overlap")
+
+	cancelledID, err := database.CreateAppointment(ctx, models.Appointment{CustomerName: "Cancelled", Time: start, Duration: 60, Status: models.StatusCancelled, Resource: "Room G"})
+	assert.NoError(t, err, "Cancelled appointments should not be guarded")
+
+	err = database.UpdateAppointment(ctx, models.Appointment{ID: laterID, CustomerName: "Later", Time: start.Add(30 * time.Minute), Duration: 60, Status: models.StatusConfirmed, Resource: "Room G", ProviderID: 951})
+	assert.True(t, errors.As(err, &conflict), "Moving onto an occupied slot should be rejected")
+
+	_, err = database.ChangeAppointmentStatus(ctx, models.StatusChange{AppointmentID: cancelledID, FromStatus: models.StatusCancelled, ToStatus: models.StatusConfirmed, ChangedAt: time.Now()})
+	assert.True(t, errors.As(err, &conflict), "Reactivating onto an occupied slot should be rejected")
+	assert.Equal(t, models.ConflictResource, conflict.Kind)
+}
+
+func TestAppointmentService_ReactivationFollowsPolicy(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.NewSQLiteDatabase(db.Config{DSN: "file:" + filepath.Join(t.TempDir(), "reactivated.db")})
+	assert.NoError(t, err)
+	defer database.Connection.Close()
+
+	exclusive := &service.DefaultAppointmentService{Database: database}
+	shared := &service.DefaultAppointmentService{Database: database, ConflictPolicy: &service.ConflictPolicy{CustomerCapacity: 1, ProviderCapacity: 1, ResourceCapacity: 2}}
+	admin := &models.User{ID: 1, Role: "admin"}
+	start := time.Date(2031, time.August, 4, 9, 0, 0, 0, time.UTC)
+
+	_, err = exclusive.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Staying", Time: start, Duration: 60, Resource: "Room S", CustomerID: 811})
+	assert.NoError(t, err)
+	movedID, err := exclusive.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Returning", Time: start.Add(2 * time.Hour), Duration: 60, Resource: "Room S", CustomerID: 812})
+	assert.NoError(t, err)
+	assert.NoError(t, exclusive.ChangeAppointmentStatus(ctx, admin, movedID, models.StatusCancelled, ""))
+	err = exclusive.UpdateAppointment(ctx, admin, models.Appointment{ID: movedID, CustomerName: "Returning", Time: start, Duration: 60, Resource: "Room S", CustomerID: 812})
+	assert.NoError(t, err, "Cancelled bookings can be moved onto an occupied slot")
+
+	err = shared.ChangeAppointmentStatus(ctx, admin, movedID, models.StatusConfirmed, "")
+	assert.NoError(t, err, "Once the room is shared, reactivating next to another booking should succeed")
+}
+
+// missedBookings hides every booking from the conflict checks run inside a
+// transaction, as if a concurrent booking had committed right after them, so
+// only the database guards stand in the way.
+type missedBookings struct {
+	db.Database
+}
+
+func (missed missedBookings) WithTx(ctx context.Context, fn func(tx db.Database) error) error {
+	return missed.Database.WithTx(ctx, func(tx db.Database) error {
+		return fn(hiddenBookings{tx})
+	})
+}
+
+type hiddenBookings struct {
+	db.Database
+}
+
+func (hidden hiddenBookings) GetOverlappingAppointments(ctx context.Context, filters map[string]interface{}, from, to time.Time) ([]models.Appointment, error) {
+	return nil, nil
+}
+
+func TestAppointmentService_ExplainsDatabaseConflict(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.NewSQLiteDatabase(db.Config{DSN: "file:" + filepath.Join(t.TempDir(), "explained.db")})
+	assert.NoError(t, err)
+	defer database.Connection.Close()
+
+	appointments := &service.DefaultAppointmentService{Database: missedBookings{database}}
+	admin := &models.User{ID: 1, Role: "admin"}
+	start := time.Date(2031, time.June, 2, 9, 0, 0, 0, time.UTC)
+
+	blockerID, err := appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Blocker", Time: start, Duration: 60, Resource: "Room E"})
+	assert.NoError(t, err)
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Late", Time: start.Add(30 * time.Minute), Duration: 60, Resource: "Room E"})
+	var conflict *models.ConflictError
+	assert.True(t, errors.As(err, &conflict), "The database guard should reject the booking")
+	assert.Equal(t, []int{blockerID}, conflict.AppointmentIDs, "The conflict should name the booking the guard collided with")
+	assert.NotEmpty(t, conflict.Suggestions, "The conflict should suggest other times")
+
+	cancelledID, err := appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Cancelled", Time: start.Add(2 * time.Hour), Duration: 60, Resource: "Room E"})
+	assert.NoError(t, err)
+	assert.NoError(t, appointments.ChangeAppointmentStatus(ctx, admin, cancelledID, models.StatusCancelled, ""))
+	err = appointments.UpdateAppointment(ctx, admin, models.Appointment{ID: cancelledID, CustomerName: "Cancelled", Time: start, Duration: 60, Resource: "Room E"})
+	assert.NoError(t, err, "Moving a cancelled booking should not be guarded")
+	err = appointments.ChangeAppointmentStatus(ctx, admin, cancelledID, models.StatusConfirmed, "")
+	assert.True(t, errors.As(err, &conflict), "Reactivating onto an occupied slot should be rejected")
+	assert.Equal(t, []int{blockerID}, conflict.AppointmentIDs)
+	assert.True(t, start.Equal(conflict.Time))
+}
+
+// failingConnector opens connections whose every statement fails with err,
+// standing in for a Postgres server that rejects the write.
+type failingConnector struct {
+	err error
+}
+
+func (connector failingConnector) Connect(context.Context) (driver.Conn, error) {
+	return failingConn{connector.err}, nil
+}
+
+func (connector failingConnector) Driver() driver.Driver {
+	return nil
+}
+
+type failingConn struct {
+	err error
+}
+
+func (conn failingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, conn.err
+}
+
+func (conn failingConn) Close() error {
+	return nil
+}
+
+func (conn failingConn) Begin() (driver.Tx, error) {
+	return nil, conn.err
+}
+
+func TestDatabase_PostgresOverlapGuard(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2031, time.May, 5, 9, 0, 0, 0, time.UTC)
+	appointment := models.Appointment{ID: 1, CustomerName: "Second", Time: start, Duration: 60, Status: models.StatusConfirmed, Resource: "Room G", ProviderID: 951}
+
+	open := func(err error) *db.PostgresDatabase {
+		database, openErr := db.NewPostgresDatabase(db.Config{DB: sql.OpenDB(failingConnector{err}), SkipMigrations: true})
+		assert.NoError(t, openErr)
+		t.Cleanup(func() { database.Connection.Close() })
+		return database
+	}
+
+	var conflict *models.ConflictError
+	_, err := open(&pq.Error{Code: "23P01", Constraint: "appointments_provider_overlap"}).CreateAppointment(ctx, appointment)
+	assert.True(t, errors.As(err, &conflict), "An exclusion violation should be reported as a conflict")
+	assert.Equal(t, models.ConflictProvider, conflict.Kind)
+	assert.True(t, start.Equal(conflict.Time))
+	assert.Empty(t, conflict.AppointmentIDs)
+
+	err = open(&pq.Error{Code: "23P01", Constraint: "appointments_resource_overlap"}).UpdateAppointment(ctx, appointment)
+	assert.True(t, errors.As(err, &conflict), "An exclusion violation should be reported as a conflict")
+	assert.Equal(t, models.ConflictResource, conflict.Kind)
+
+	_, err = open(&pq.Error{Code: "23P01", Constraint: "appointments_other_exclusion"}).CreateAppointment(ctx, appointment)
+	assert.False(t, errors.As(err, &conflict), "Other exclusion constraints should not be reported as conflicts")
+
+	_, err = open(&pq.Error{Code: "23505", Constraint: "appointments_provider_overlap"}).CreateAppointment(ctx, appointment)
+	assert.False(t, errors.As(err, &conflict), "Other violations should not be reported as conflicts")
+	var pqError *pq.Error
+	assert.True(t, errors.As(err, &pqError), "Other violations should keep the driver error")
+}
+
+func TestAppointmentService_ConflictWithMovedOccurrence(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointments := &service.DefaultAppointmentService{Database: database}
+	admin := &models.User{ID: 1, Role: "admin"}
+	start := time.Date(2030, time.September, 2, 9, 0, 0, 0, time.UTC)
+
+	seriesID, err := appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Weekly", Time: start, Duration: 60, RecurrenceRule: "FREQ=WEEKLY;COUNT=4", Status: "Scheduled", Resource: "Room Moved A"})
+	assert.NoError(t, err)
+	_, err = database.CreateOccurrenceException(ctx, models.OccurrenceException{AppointmentID: seriesID, Type: models.ExceptionOverride, OccurrenceTime: start.AddDate(0, 0, 7), Time: start.AddDate(0, 0, 7), Duration: 60, Resource: "Room Moved B"})
+	assert.NoError(t, err)
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Walk-in", Time: start.AddDate(0, 0, 7), Duration: 30, Status: "Scheduled", Resource: "Room Moved B"})
+	var conflict *models.ConflictError
+	assert.True(t, errors.As(err, &conflict), "An occurrence moved onto a resource should block it")
+	assert.Equal(t, []int{seriesID}, conflict.AppointmentIDs)
+
+	_, err = appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Walk-in", Time: start.AddDate(0, 0, 7), Duration: 30, Status: "Scheduled", Resource: "Room Moved A"})
+	assert.NoError(t, err, "The resource the occurrence moved away from should be free")
+}
@@ -0,0 +1,13 @@
+package db_test
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	os.Remove("appointments.db")
+	code := m.Run()
+	os.Remove("appointments.db")
+	os.Exit(code)
+}
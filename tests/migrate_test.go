@@ -0,0 +1,168 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozoli99/Kaida/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openMigrationDatabase(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	connection, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)")
+	assert.NoError(t, err)
+	t.Cleanup(func() { connection.Close() })
+	return connection
+}
+
+func TestMigrator_UpAndDown(t *testing.T) {
+	ctx := context.Background()
+	connection := openMigrationDatabase(t, filepath.Join(t.TempDir(), "migrations.db"))
+	migrations, err := db.LoadMigrations(db.DialectSQLite)
+	assert.NoError(t, err)
+	postgresMigrations, err := db.LoadMigrations(db.DialectPostgres)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), len(postgresMigrations), "Both dialects should have the same migrations")
+
+	migrator, err := db.NewMigrator(connection, db.DialectSQLite)
+	assert.NoError(t, err)
+
+	statuses, err := migrator.Status(ctx)
+	assert.NoError(t, err, "Status should work on a database that was never migrated")
+	assert.Len(t, statuses, len(migrations))
+	for _, status := range statuses {
+		assert.False(t, status.Applied, "Migration %d should be pending", status.Version)
+	}
+	var tables int
+	assert.NoError(t, connection.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&tables))
+	assert.Equal(t, 0, tables, "Status should not create any table")
+
+	applied, err := migrator.Up(ctx)
+	assert.NoError(t, err, "Migrating a fresh database should succeed")
+	assert.Equal(t, len(migrations), applied)
+
+	applied, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, applied, "Applied migrations should not run again")
+
+	lock, err := connection.Conn(ctx)
+	assert.NoError(t, err)
+	_, err = lock.ExecContext(ctx, "BEGIN IMMEDIATE")
+	assert.NoError(t, err)
+	statusCtx, cancel := context.WithTimeout(ctx, time.Second)
+	statuses, err = migrator.Status(statusCtx)
+	cancel()
+	_, rollbackErr := lock.ExecContext(ctx, "ROLLBACK")
+	assert.NoError(t, rollbackErr)
+	lock.Close()
+	assert.NoError(t, err, "Status should not wait for a running migration")
+	for _, status := range statuses {
+		assert.True(t, status.Applied, "Migration %d should be applied", status.Version)
+	}
+
+	reverted, err := migrator.Down(ctx, len(migrations))
+	assert.NoError(t, err, "Every migration should be reversible")
+	assert.Equal(t, len(migrations), reverted)
+	assert.NoError(t, connection.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')").Scan(&tables))
+	assert.Equal(t, 0, tables, "Reverting everything should drop every table")
+
+	applied, err = migrator.Up(ctx)
+	assert.NoError(t, err, "Migrating again after a full revert should succeed")
+	assert.Equal(t, len(migrations), applied)
+}
+
+func TestMigrator_UpgradesLegacyDatabase(t *testing.T) {
+	ctx := context.Background()
+	connection := openMigrationDatabase(t, filepath.Join(t.TempDir(), "legacy.db"))
+
+	// The schema created before migrations existed.
+	_, err := connection.Exec(`
+	CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT NOT NULL, email TEXT NOT NULL UNIQUE, password TEXT NOT NULL, role TEXT NOT NULL);
+	CREATE TABLE appointments (id INTEGER PRIMARY KEY AUTOINCREMENT, customer_name TEXT NOT NULL, time DATETIME NOT NULL, duration INTEGER NOT NULL, notes TEXT, recurrence_rule TEXT,
+		status TEXT DEFAULT 'Scheduled' CHECK(status IN ('Scheduled', 'Completed', 'Cancelled')), resource TEXT, customer_id INTEGER REFERENCES users(id), provider_id INTEGER REFERENCES users(id));
+	INSERT INTO users (username, email, password, role) VALUES ('legacy', 'legacy@example.com', 'hash', 'customer');
+	INSERT INTO appointments (customer_name, time, duration, status, customer_id) VALUES ('legacy', '2024-01-01T10:00:00Z', 30, 'Scheduled', 1);
+	INSERT INTO appointments (customer_name, time, duration, status, resource, provider_id) VALUES ('first', '2024-01-02T10:00:00Z', 60, 'Scheduled', 'Room L', 1);
+	INSERT INTO appointments (customer_name, time, duration, status, resource, provider_id) VALUES ('double booked', '2024-01-02T10:30:00Z', 60, 'Scheduled', 'Room L', 1);`)
+	assert.NoError(t, err)
+
+	migrator, err := db.NewMigrator(connection, db.DialectSQLite)
+	assert.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	assert.NoError(t, err, "Migrating a legacy database should succeed")
+
+	var site string
+	var failedLogins int
+	assert.NoError(t, connection.QueryRow("SELECT site, failed_logins FROM users WHERE email = 'legacy@example.com'").Scan(&site, &failedLogins), "New user columns should be added")
+
+	var status, timeZone string
+	assert.NoError(t, connection.QueryRow("SELECT status, time_zone FROM appointments WHERE customer_name = 'legacy'").Scan(&status, &timeZone), "Existing appointments should be kept")
+	assert.Equal(t, "Scheduled", status)
+
+	var kinds []string
+	rows, err := connection.Query("SELECT kind FROM legacy_appointment_overlaps JOIN appointments ON appointments.id = appointment_id WHERE customer_name = 'double booked' ORDER BY kind")
+	assert.NoError(t, err)
+	for rows.Next() {
+		var kind string
+		assert.NoError(t, rows.Scan(&kind))
+		kinds = append(kinds, kind)
+	}
+	rows.Close()
+	assert.Equal(t, []string{"provider", "resource"}, kinds, "Existing overlaps should be reported instead of failing the migration")
+
+	_, err = connection.Exec("UPDATE appointments SET status = 'CheckedIn'")
+	assert.NoError(t, err, "The status constraint should accept the new statuses")
+	_, err = connection.Exec("UPDATE appointments SET notes = 'Rescheduled' WHERE customer_name = 'first'")
+	assert.NoError(t, err, "Editing a booking with a legacy overlap should not trip the guards")
+	_, err = connection.Exec("UPDATE appointments SET status = 'Cancelled' WHERE customer_name = 'first'")
+	assert.NoError(t, err, "Cancelling a booking with a legacy overlap should succeed")
+}
+
+func TestMigrator_ChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	connection := openMigrationDatabase(t, filepath.Join(t.TempDir(), "checksum.db"))
+	migrator, err := db.NewMigrator(connection, db.DialectSQLite)
+	assert.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+
+	_, err = connection.Exec("UPDATE schema_migrations SET checksum = 'edited' WHERE version = 1")
+	assert.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	assert.True(t, errors.Is(err, db.ErrChecksumMismatch), "Edited migrations should be detected")
+}
+
+func TestMigrator_ConcurrentUp(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "concurrent.db")
+	migrations, err := db.LoadMigrations(db.DialectSQLite)
+	assert.NoError(t, err)
+
+	var wait sync.WaitGroup
+	results := make([]int, 4)
+	errs := make([]error, len(results))
+	for index := range results {
+		migrator, err := db.NewMigrator(openMigrationDatabase(t, path), db.DialectSQLite)
+		assert.NoError(t, err)
+		wait.Add(1)
+		go func(index int) {
+			defer wait.Done()
+			results[index], errs[index] = migrator.Up(ctx)
+		}(index)
+	}
+	wait.Wait()
+
+	total := 0
+	for index := range results {
+		assert.NoError(t, errs[index], "Concurrent migrations should wait for the lock")
+		total += results[index]
+	}
+	assert.Equal(t, len(migrations), total, "Every migration should be applied exactly once")
+}
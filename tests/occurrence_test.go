@@ -0,0 +1,182 @@
+package db_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppointment_ApplyExceptions(t *testing.T) {
+	start := time.Date(2025, time.March, 3, 9, 0, 0, 0, time.UTC)
+	appointment := models.Appointment{
+		CustomerName:   "Series",
+		Time:           start,
+		Duration:       60,
+		RecurrenceRule: "daily",
+		Resource:       "Room A",
+	}
+
+	occurrences := appointment.ApplyExceptions(appointment.CalculateFutureOccurences(3), []models.OccurrenceException{
+		{Type: models.ExceptionSkip, OccurrenceTime: start.AddDate(0, 0, 1)},
+		{Type: models.ExceptionOverride, OccurrenceTime: start.AddDate(0, 0, 2), Time: start.AddDate(0, 0, 2).Add(6 * time.Hour), Resource: "Room B"},
+		{Type: models.ExceptionAdd, OccurrenceTime: start.AddDate(0, 0, 10)},
+	})
+
+	assert.Len(t, occurrences, 3, "Skipped occurrences should be removed and extra dates added")
+	assert.Equal(t, start.AddDate(0, 0, 2).Add(6*time.Hour), occurrences[0].Time, "Overrides should move the occurrence")
+	assert.Equal(t, "Room B", occurrences[0].Resource, "Overrides should change the resource")
+	assert.Equal(t, start.AddDate(0, 0, 3), occurrences[1].Time)
+	assert.Equal(t, start.AddDate(0, 0, 10), occurrences[2].Time)
+}
+
+func TestSQLiteDatabase_OccurrenceExceptions(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointment := models.Appointment{
+		CustomerName:   "Weekly Series",
+		Time:           time.Now().Add(48 * time.Hour).Truncate(time.Second),
+		Duration:       30,
+		RecurrenceRule: "weekly",
+		Status:         "Scheduled",
+		Resource:       "Room X",
+	}
+	appointmentID, err := database.CreateAppointment(ctx, appointment)
+	assert.NoError(t, err, "Creating the series should succeed")
+
+	exceptionID, err := database.CreateOccurrenceException(ctx, models.OccurrenceException{
+		AppointmentID:  appointmentID,
+		Type:           models.ExceptionSkip,
+		OccurrenceTime: appointment.Time.AddDate(0, 0, 7),
+	})
+	assert.NoError(t, err, "Creating an exception should succeed")
+
+	exceptions, err := database.GetOccurrenceExceptions(ctx, appointmentID)
+	assert.NoError(t, err, "Listing exceptions should succeed")
+	assert.Len(t, exceptions, 1)
+	assert.True(t, exceptions[0].OccurrenceTime.Equal(appointment.Time.AddDate(0, 0, 7)), "Occurrence time should round-trip")
+
+	err = database.DeleteOccurrenceException(ctx, appointmentID, exceptionID)
+	assert.NoError(t, err, "Deleting the exception should succeed")
+
+	err = database.DeleteOccurrenceException(ctx, appointmentID, exceptionID)
+	assert.Error(t, err, "Deleting a missing exception should fail")
+}
+
+func TestSQLiteDatabase_RecurringBookings(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.NewSQLiteDatabase(db.Config{DSN: "file:" + filepath.Join(t.TempDir(), "series.db")})
+	assert.NoError(t, err)
+	defer database.Connection.Close()
+
+	start := time.Date(2031, time.July, 7, 9, 0, 0, 0, time.UTC)
+	ownID, err := database.CreateAppointment(ctx, models.Appointment{CustomerName: "Own", Time: start, Duration: 60, RecurrenceRule: "weekly", Status: models.StatusConfirmed, ProviderID: 701})
+	assert.NoError(t, err)
+	movedID, err := database.CreateAppointment(ctx, models.Appointment{CustomerName: "Moved", Time: start, Duration: 60, RecurrenceRule: "weekly", Status: models.StatusConfirmed, ProviderID: 702})
+	assert.NoError(t, err)
+	otherID, err := database.CreateAppointment(ctx, models.Appointment{CustomerName: "Other", Time: start, Duration: 60, RecurrenceRule: "weekly", Status: models.StatusConfirmed, ProviderID: 703})
+	assert.NoError(t, err)
+
+	_, err = database.CreateOccurrenceException(ctx, models.OccurrenceException{AppointmentID: movedID, Type: models.ExceptionOverride, OccurrenceTime: start.AddDate(0, 0, 7), ProviderID: 701})
+	assert.NoError(t, err)
+	_, err = database.CreateOccurrenceException(ctx, models.OccurrenceException{AppointmentID: otherID, Type: models.ExceptionSkip, OccurrenceTime: start.AddDate(0, 0, 7)})
+	assert.NoError(t, err)
+
+	seriesIDs := func(appointments []models.Appointment) []int {
+		var ids []int
+		for _, appointment := range appointments {
+			ids = append(ids, appointment.ID)
+		}
+		return ids
+	}
+	filters := map[string]interface{}{"provider_id": 701}
+	series, err := database.GetRecurringAppointments(ctx, filters, start.AddDate(0, 1, 0))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []int{ownID}, seriesIDs(series))
+	series, err = database.GetRecurringBookings(ctx, filters, start.AddDate(0, 1, 0))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []int{ownID, movedID}, seriesIDs(series), "Series moved to the provider by an override should be included")
+
+	exceptions, err := database.GetSeriesExceptions(ctx, []int{ownID, movedID, otherID})
+	assert.NoError(t, err)
+	assert.Empty(t, exceptions[ownID])
+	assert.Len(t, exceptions[movedID], 1)
+	assert.Len(t, exceptions[otherID], 1)
+	assert.Equal(t, models.ExceptionSkip, exceptions[otherID][0].Type)
+}
+
+func TestAppointment_OccurrencesBetween(t *testing.T) {
+	start := time.Date(2025, time.March, 3, 9, 0, 0, 0, time.UTC)
+	appointment := models.Appointment{
+		ID:             42,
+		CustomerName:   "Series",
+		Time:           start,
+		Duration:       60,
+		RecurrenceRule: "FREQ=WEEKLY;BYDAY=MO,TH",
+		TimeZone:       "Europe/Budapest",
+		Site:           "North",
+	}
+
+	from := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, time.March, 17, 0, 0, 0, 0, time.UTC)
+	occurrences := appointment.OccurrencesBetween(from, to, []models.OccurrenceException{
+		{Type: models.ExceptionOverride, OccurrenceTime: start.AddDate(0, 0, 14), Time: start.AddDate(0, 0, 12)},
+	})
+
+	assert.Len(t, occurrences, 3, "Window should contain two generated occurrences and one moved into it")
+	for _, occurrence := range occurrences {
+		assert.Equal(t, 42, occurrence.SeriesID, "Occurrences should reference their series")
+		assert.Equal(t, "Europe/Budapest", occurrence.TimeZone, "Occurrences should keep the time zone of the series")
+		assert.Equal(t, "North", occurrence.Site, "Occurrences should keep the site of the series")
+		assert.False(t, occurrence.IsRecurring(), "Occurrences should not repeat themselves")
+		assert.False(t, occurrence.Time.Before(from))
+		assert.True(t, occurrence.Time.Before(to))
+	}
+}
+
+func TestAppointmentService_ExpandOccurrences(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointmentService := &service.DefaultAppointmentService{Database: database}
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	ownID, err := database.CreateAppointment(ctx, models.Appointment{
+		CustomerName:   "Daily Own",
+		Time:           start,
+		Duration:       15,
+		RecurrenceRule: "daily",
+		Status:         "Scheduled",
+		Resource:       "Room Expand 1",
+		CustomerID:     901,
+	})
+	assert.NoError(t, err)
+	_, err = database.CreateAppointment(ctx, models.Appointment{
+		CustomerName:   "Daily Other",
+		Time:           start,
+		Duration:       15,
+		RecurrenceRule: "daily",
+		Status:         "Scheduled",
+		Resource:       "Room Expand 2",
+		CustomerID:     902,
+	})
+	assert.NoError(t, err)
+
+	customer := &models.User{ID: 901, Role: "customer"}
+	occurrences, err := appointmentService.ExpandOccurrences(ctx, customer, start, start.Add(72*time.Hour))
+	assert.NoError(t, err, "Expanding occurrences should succeed")
+	assert.Len(t, occurrences, 3, "Customers should only see their own series inside the window")
+	for _, occurrence := range occurrences {
+		assert.Equal(t, ownID, occurrence.SeriesID)
+	}
+}
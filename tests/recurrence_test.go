@@ -0,0 +1,118 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ozoli99/Kaida/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecurrenceRule_Shorthands(t *testing.T) {
+	start := time.Date(2025, time.January, 31, 9, 0, 0, 0, time.UTC)
+	appointment := models.Appointment{Time: start, RecurrenceRule: "weekly"}
+
+	occurrences := appointment.CalculateFutureOccurences(3)
+	assert.Equal(t, []time.Time{
+		start.AddDate(0, 0, 7),
+		start.AddDate(0, 0, 14),
+		start.AddDate(0, 0, 21),
+	}, occurrences, "Weekly shorthand should repeat every seven days")
+
+	appointment.RecurrenceRule = "None"
+	assert.Empty(t, appointment.CalculateFutureOccurences(3), "None should not recur")
+}
+
+func TestRecurrenceRule_SecondTuesdayOfMonth(t *testing.T) {
+	rule, err := models.ParseRecurrenceRule("RRULE:FREQ=MONTHLY;BYDAY=2TU;COUNT=3")
+	assert.NoError(t, err, "Parsing should succeed")
+
+	start := time.Date(2025, time.January, 14, 10, 30, 0, 0, time.UTC)
+	occurrences := rule.Occurrences(start, time.Time{}, 0)
+	assert.Equal(t, []time.Time{
+		time.Date(2025, time.January, 14, 10, 30, 0, 0, time.UTC),
+		time.Date(2025, time.February, 11, 10, 30, 0, 0, time.UTC),
+		time.Date(2025, time.March, 11, 10, 30, 0, 0, time.UTC),
+	}, occurrences, "COUNT should include the first occurrence")
+}
+
+func TestRecurrenceRule_LastWeekdayOfMonth(t *testing.T) {
+	rule, err := models.ParseRecurrenceRule("FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1")
+	assert.NoError(t, err, "Parsing should succeed")
+
+	start := time.Date(2025, time.May, 1, 8, 0, 0, 0, time.UTC)
+	occurrences := rule.Occurrences(start, time.Date(2025, time.September, 1, 0, 0, 0, 0, time.UTC), 0)
+	assert.Equal(t, []time.Time{
+		time.Date(2025, time.May, 30, 8, 0, 0, 0, time.UTC),
+		time.Date(2025, time.June, 30, 8, 0, 0, 0, time.UTC),
+		time.Date(2025, time.July, 31, 8, 0, 0, 0, time.UTC),
+		time.Date(2025, time.August, 29, 8, 0, 0, 0, time.UTC),
+	}, occurrences, "Expected the last weekday of each month")
+}
+
+func TestRecurrenceRule_WeeklyIntervalWithUntil(t *testing.T) {
+	rule, err := models.ParseRecurrenceRule("FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;UNTIL=20250120T235959Z;WKST=SU")
+	assert.NoError(t, err, "Parsing should succeed")
+
+	start := time.Date(2025, time.January, 6, 9, 0, 0, 0, time.UTC)
+	occurrences := rule.Occurrences(start, time.Time{}, 0)
+	assert.Equal(t, []time.Time{
+		time.Date(2025, time.January, 6, 9, 0, 0, 0, time.UTC),
+		time.Date(2025, time.January, 8, 9, 0, 0, 0, time.UTC),
+		time.Date(2025, time.January, 20, 9, 0, 0, 0, time.UTC),
+	}, occurrences, "Expected every other Monday and Wednesday until UNTIL")
+}
+
+func TestAppointment_ValidateRecurrenceRule(t *testing.T) {
+	appointment := models.Appointment{
+		CustomerName:   "John Doe",
+		Time:           time.Now(),
+		Duration:       30,
+		RecurrenceRule: "FREQ=HOURLY",
+	}
+	assert.Error(t, appointment.Validate(), "Unsupported frequencies should be rejected")
+
+	appointment.RecurrenceRule = "FREQ=DAILY;COUNT=3;UNTIL=20250101"
+	assert.Error(t, appointment.Validate(), "COUNT and UNTIL together should be rejected")
+
+	appointment.RecurrenceRule = "monthly"
+	assert.NoError(t, appointment.Validate(), "Shorthands should remain valid")
+}
+
+func TestRecurrenceRule_KeepsWallClockAcrossDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	appointment := models.Appointment{
+		CustomerName:   "DST",
+		Time:           time.Date(2025, time.March, 7, 14, 0, 0, 0, time.UTC),
+		Duration:       30,
+		RecurrenceRule: "daily",
+		TimeZone:       "America/New_York",
+	}
+	assert.NoError(t, appointment.Validate())
+
+	for _, occurrence := range appointment.CalculateFutureOccurences(4) {
+		local := occurrence.In(newYork)
+		assert.Equal(t, 9, local.Hour(), "Occurrences should stay at 09:00 local time")
+	}
+
+	occurrences := appointment.CalculateFutureOccurences(3)
+	assert.Equal(t, 14, occurrences[0].UTC().Hour(), "Before DST the series is at 14:00 UTC")
+	assert.Equal(t, 13, occurrences[2].UTC().Hour(), "After DST the series is at 13:00 UTC")
+
+	appointment.TimeZone = "Mars/Olympus_Mons"
+	assert.Error(t, appointment.Validate(), "Unknown zones should be rejected")
+}
+
+func TestRecurrenceRule_NeverMatching(t *testing.T) {
+	rule, err := models.ParseRecurrenceRule("FREQ=MONTHLY;BYMONTHDAY=31;BYSETPOS=2")
+	assert.NoError(t, err, "The rule is well-formed")
+
+	start := time.Date(2025, time.January, 31, 9, 0, 0, 0, time.UTC)
+	assert.Empty(t, rule.Occurrences(start, time.Time{}, 0), "Expansion should give up after a run of empty periods")
+
+	appointment := models.Appointment{CustomerName: "Never", Time: start, Duration: 30, RecurrenceRule: "FREQ=MONTHLY;BYMONTHDAY=31;BYSETPOS=2"}
+	assert.Error(t, appointment.Validate(), "A rule without occurrences should be rejected")
+}
@@ -0,0 +1,123 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppointmentService_StatusLifecycle(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointments := &service.DefaultAppointmentService{Database: database}
+	customer := &models.User{ID: 1001, Role: "customer"}
+	provider := &models.User{ID: 1011, Role: "provider"}
+
+	appointmentID, err := appointments.CreateAppointment(ctx, customer, models.Appointment{
+		CustomerName: "Lifecycle",
+		Time:         time.Date(2030, time.September, 2, 9, 0, 0, 0, time.UTC),
+		Duration:     30,
+		Status:       models.StatusRequested,
+		CustomerID:   customer.ID,
+		ProviderID:   provider.ID,
+	})
+	assert.NoError(t, err, "Customers should be able to request appointments")
+
+	err = appointments.ChangeAppointmentStatus(ctx, customer, appointmentID, models.StatusConfirmed, "")
+	assert.Error(t, err, "Customers should not confirm their own requests")
+
+	assert.NoError(t, appointments.ChangeAppointmentStatus(ctx, provider, appointmentID, models.StatusConfirmed, "Approved"))
+	assert.NoError(t, appointments.ChangeAppointmentStatus(ctx, provider, appointmentID, models.StatusCheckedIn, ""))
+
+	err = appointments.ChangeAppointmentStatus(ctx, &models.User{ID: 1, Role: "admin"}, appointmentID, models.StatusRequested, "")
+	assert.True(t, errors.Is(err, service.ErrInvalidStatusTransition), "Checked-in appointments cannot go back to requested")
+
+	assert.NoError(t, appointments.ChangeAppointmentStatus(ctx, provider, appointmentID, models.StatusCompleted, ""))
+	err = appointments.ChangeAppointmentStatus(ctx, provider, appointmentID, models.StatusCancelled, "")
+	assert.True(t, errors.Is(err, service.ErrInvalidStatusTransition), "Completed appointments are final")
+
+	history, err := appointments.GetStatusHistory(ctx, customer, appointmentID)
+	assert.NoError(t, err, "Customers should see the history of their appointments")
+	assert.Len(t, history, 3)
+	assert.Equal(t, models.StatusRequested, history[0].FromStatus)
+	assert.Equal(t, models.StatusConfirmed, history[0].ToStatus)
+	assert.Equal(t, provider.ID, history[0].ActorID)
+	assert.Equal(t, "Approved", history[0].Reason)
+	assert.Equal(t, models.StatusCompleted, history[2].ToStatus)
+}
+
+func TestAppointmentService_LegacyScheduledStatus(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointments := &service.DefaultAppointmentService{Database: database}
+	admin := &models.User{ID: 1, Role: "admin"}
+
+	appointmentID, err := appointments.CreateAppointment(ctx, admin, models.Appointment{
+		CustomerName: "Legacy",
+		Time:         time.Date(2030, time.September, 3, 9, 0, 0, 0, time.UTC),
+		Duration:     30,
+		Status:       models.StatusScheduled,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, appointments.ChangeAppointmentStatus(ctx, admin, appointmentID, models.StatusNoShow, ""), "Scheduled should behave like Confirmed")
+
+	history, err := appointments.GetStatusHistory(ctx, admin, appointmentID)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, models.StatusConfirmed, history[0].FromStatus)
+	assert.Equal(t, "admin", history[0].ActorRole)
+
+	err = appointments.ChangeAppointmentStatus(ctx, admin, appointmentID, "Postponed", "")
+	assert.Error(t, err, "Unknown statuses should be rejected")
+}
+
+func TestAppointmentService_StatusChangeAuthorization(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	appointments := &service.DefaultAppointmentService{Database: database}
+	owner := &models.User{ID: 1101, Role: "customer"}
+	stranger := &models.User{ID: 1102, Role: "customer"}
+	provider := &models.User{ID: 1111, Role: "provider"}
+	otherProvider := &models.User{ID: 1112, Role: "provider"}
+
+	appointmentID, err := appointments.CreateAppointment(ctx, owner, models.Appointment{
+		CustomerName: "Owner",
+		Time:         time.Date(2030, time.September, 4, 9, 0, 0, 0, time.UTC),
+		Duration:     30,
+		CustomerID:   owner.ID,
+		ProviderID:   provider.ID,
+	})
+	assert.NoError(t, err)
+
+	err = appointments.ChangeAppointmentStatus(ctx, stranger, appointmentID, models.StatusCancelled, "")
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Customers cannot cancel other customers' appointments")
+
+	err = appointments.ChangeAppointmentStatus(ctx, owner, appointmentID, models.StatusCompleted, "")
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Customers cannot complete appointments")
+
+	err = appointments.ChangeAppointmentStatus(ctx, otherProvider, appointmentID, models.StatusNoShow, "")
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Providers can only change their own appointments")
+
+	assert.NoError(t, appointments.ChangeAppointmentStatus(ctx, provider, appointmentID, models.StatusNoShow, "Did not arrive"))
+
+	err = appointments.ChangeAppointmentStatus(ctx, owner, 999999, models.StatusCancelled, "")
+	assert.True(t, errors.Is(err, sql.ErrNoRows), "Missing appointments should be reported as not found")
+}
@@ -0,0 +1,200 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabase_WithTx(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.NewSQLiteDatabase(db.Config{DSN: "file:" + filepath.Join(t.TempDir(), "tx.db")})
+	assert.NoError(t, err)
+	defer database.Connection.Close()
+
+	appointment := models.Appointment{CustomerName: "Rolled Back", Time: time.Now(), Duration: 30, Status: models.StatusConfirmed}
+	failure := errors.New("abort")
+	var createdID int
+	err = database.WithTx(ctx, func(tx db.Database) error {
+		createdID, err = tx.CreateAppointment(ctx, appointment)
+		assert.NoError(t, err)
+		return failure
+	})
+	assert.Equal(t, failure, err, "WithTx should return the error of fn")
+	_, err = database.GetAppointmentByID(ctx, createdID)
+	assert.Error(t, err, "A failed transaction should be rolled back")
+
+	err = database.WithTx(ctx, func(tx db.Database) error {
+		createdID, err = tx.CreateAppointment(ctx, appointment)
+		if err != nil {
+			return err
+		}
+		return tx.WithTx(ctx, func(nested db.Database) error {
+			_, err := nested.ChangeAppointmentStatus(ctx, models.StatusChange{AppointmentID: createdID, FromStatus: models.StatusConfirmed, ToStatus: models.StatusCancelled, ChangedAt: time.Now()})
+			return err
+		})
+	})
+	assert.NoError(t, err, "Nested transactions should join the outer one")
+	stored, err := database.GetAppointmentByID(ctx, createdID)
+	assert.NoError(t, err, "A successful transaction should be committed")
+	assert.Equal(t, models.StatusCancelled, stored.Status)
+}
+
+// slowReads widens the gap between the reads a decision is based on and the
+// write that follows them, so unsynchronised requests would reliably overlap.
+type slowReads struct {
+	db.Database
+}
+
+func (slow slowReads) GetAppointmentByID(ctx context.Context, appointmentID int) (models.Appointment, error) {
+	appointment, err := slow.Database.GetAppointmentByID(ctx, appointmentID)
+	time.Sleep(5 * time.Millisecond)
+	return appointment, err
+}
+
+func (slow slowReads) GetOverlappingAppointments(ctx context.Context, filters map[string]interface{}, from, to time.Time) ([]models.Appointment, error) {
+	appointments, err := slow.Database.GetOverlappingAppointments(ctx, filters, from, to)
+	time.Sleep(5 * time.Millisecond)
+	return appointments, err
+}
+
+func (slow slowReads) WithTx(ctx context.Context, fn func(tx db.Database) error) error {
+	return slow.Database.WithTx(ctx, func(tx db.Database) error {
+		return fn(slowReads{tx})
+	})
+}
+
+func TestAppointmentService_ConcurrentBookings(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.NewSQLiteDatabase(db.Config{DSN: "file:" + filepath.Join(t.TempDir(), "bookings.db")})
+	assert.NoError(t, err)
+	defer database.Connection.Close()
+
+	appointments := &service.DefaultAppointmentService{Database: slowReads{database}}
+	admin := &models.User{ID: 1, Role: models.RoleAdmin}
+	at := time.Date(2031, time.March, 4, 9, 0, 0, 0, time.UTC)
+
+	const attempts = 20
+	start := make(chan struct{})
+	var wait sync.WaitGroup
+	var mutex sync.Mutex
+	booked, conflicts := 0, 0
+	for index := 0; index < attempts; index++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			<-start
+			_, err := appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Racer", Time: at, Duration: 60, Resource: "Room R"})
+			var conflict *models.ConflictError
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			switch {
+				case err == nil:
+					booked++
+				case errors.As(err, &conflict):
+					conflicts++
+				default:
+					t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	close(start)
+	wait.Wait()
+
+	assert.Equal(t, 1, booked, "Only one of the concurrent bookings should succeed")
+	assert.Equal(t, attempts-1, conflicts, "Every other booking should be a conflict")
+
+	stored, err := database.GetOverlappingAppointments(ctx, map[string]interface{}{"resource": "Room R"}, at, at.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, stored, 1, "The resource should not be double-booked")
+}
+
+func TestAppointmentService_ConcurrentStatusChanges(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.NewSQLiteDatabase(db.Config{DSN: "file:" + filepath.Join(t.TempDir(), "status.db")})
+	assert.NoError(t, err)
+	defer database.Connection.Close()
+
+	appointments := &service.DefaultAppointmentService{Database: slowReads{database}}
+	admin := &models.User{ID: 1, Role: models.RoleAdmin}
+	appointmentID, err := appointments.CreateAppointment(ctx, admin, models.Appointment{CustomerName: "Contested", Time: time.Date(2031, time.April, 1, 9, 0, 0, 0, time.UTC), Duration: 30})
+	assert.NoError(t, err)
+
+	const attempts = 10
+	start := make(chan struct{})
+	var wait sync.WaitGroup
+	var mutex sync.Mutex
+	changed, rejected := 0, 0
+	for index := 0; index < attempts; index++ {
+		status := models.StatusCompleted
+		if index%2 == 1 {
+			status = models.StatusCancelled
+		}
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			<-start
+			err := appointments.ChangeAppointmentStatus(ctx, admin, appointmentID, status, "")
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			switch {
+				case err == nil:
+					changed++
+				case errors.Is(err, service.ErrInvalidStatusTransition):
+					rejected++
+				default:
+					t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	close(start)
+	wait.Wait()
+
+	assert.Equal(t, 1, changed, "Only one transition should leave the confirmed status")
+	assert.Equal(t, attempts-1, rejected, "The others should see the new status")
+
+	history, err := database.GetStatusHistory(ctx, appointmentID)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1, "Only the winning transition should be recorded")
+}
+
+func TestAppointmentService_ConflictOnSingleConnection(t *testing.T) {
+	database, err := db.NewSQLiteDatabase(db.Config{
+		DSN:          "file:" + filepath.Join(t.TempDir(), "single.db"),
+		MaxOpenConns: 1,
+	})
+	assert.NoError(t, err)
+	defer database.Connection.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	availability := &service.DefaultAvailabilityService{Database: database}
+	appointments := &service.DefaultAppointmentService{Database: database, Availability: availability}
+	admin := &models.User{ID: 1, Role: "admin"}
+
+	day := time.Now().UTC().AddDate(0, 0, 7)
+	_, err = availability.CreateWorkingHours(ctx, admin, models.WorkingHours{ProviderID: 602, Weekday: day.Weekday(), StartTime: "09:00", EndTime: "17:00"})
+	assert.NoError(t, err)
+
+	booking := models.Appointment{CustomerName: "Single", Time: time.Date(day.Year(), day.Month(), day.Day(), 10, 0, 0, 0, time.UTC), Duration: 60, ProviderID: 602}
+	_, err = appointments.CreateAppointment(ctx, admin, booking)
+	assert.NoError(t, err)
+
+	_, err = appointments.CreateAppointment(ctx, admin, booking)
+	var conflict *models.ConflictError
+	assert.True(t, errors.As(err, &conflict), "A conflict should be reported instead of waiting for the only connection: %v", err)
+	if conflict != nil {
+		assert.NotEmpty(t, conflict.Suggestions, "Suggestions should be searched once the transaction is over")
+	}
+}
@@ -0,0 +1,327 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ozoli99/Kaida/db"
+	"github.com/ozoli99/Kaida/mail"
+	"github.com/ozoli99/Kaida/models"
+	"github.com/ozoli99/Kaida/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_RoleAssignment(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	users := &service.DefaultUserService{Database: database}
+	admin := &models.User{ID: 1, Role: models.RoleAdmin}
+
+	customer, err := users.RegisterUser(ctx, "roles-customer", "roles-customer@example.com", "secret-password", "")
+	assert.NoError(t, err, "Registering should succeed")
+	assert.Equal(t, models.RoleCustomer, customer.Role, "Self-registration should always create customers")
+
+	_, err = users.CreateUser(ctx, customer, models.User{Username: "sneaky", Email: "sneaky@example.com", Role: models.RoleAdmin}, "secret-password")
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Customers cannot create admins")
+
+	_, err = users.CreateUser(ctx, admin, models.User{Username: "wizard", Email: "wizard@example.com", Role: "wizard"}, "secret-password")
+	assert.Error(t, err, "Unknown roles should be rejected")
+
+	provider, err := users.CreateUser(ctx, admin, models.User{Username: "roles-provider", Email: "roles-provider@example.com", Role: models.RoleProvider}, "secret-password")
+	assert.NoError(t, err, "Admins should create providers")
+
+	err = users.ChangeRole(ctx, customer, customer.ID, models.RoleAdmin, "")
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Users cannot promote themselves")
+	err = users.ChangeRole(ctx, provider, customer.ID, models.RoleProvider, "")
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Only admins assign roles")
+	assert.Error(t, users.ChangeRole(ctx, admin, customer.ID, "superuser", ""), "Unknown roles should be rejected")
+
+	assert.NoError(t, users.ChangeRole(ctx, admin, customer.ID, models.RoleReceptionist, "Hired at the front desk"))
+	promoted, err := database.GetUserByID(ctx, customer.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleReceptionist, promoted.Role)
+
+	auditor := &models.User{ID: 2, Role: models.RoleAuditor}
+	changes, err := users.GetRoleChanges(ctx, auditor, customer.ID)
+	assert.NoError(t, err, "Auditors should read role changes")
+	assert.Len(t, changes, 1)
+	assert.Equal(t, models.RoleCustomer, changes[0].FromRole)
+	assert.Equal(t, models.RoleReceptionist, changes[0].ToRole)
+	assert.Equal(t, admin.ID, changes[0].ActorID)
+	assert.Equal(t, "Hired at the front desk", changes[0].Reason)
+
+	changes, err = users.GetRoleChanges(ctx, admin, provider.ID)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1, "Creating a privileged user should be audited")
+	assert.Equal(t, models.RoleProvider, changes[0].ToRole)
+
+	_, err = users.GetRoleChanges(ctx, provider, 0)
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Providers cannot read the audit log")
+}
+
+func TestUserService_Profiles(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	users := &service.DefaultUserService{Database: database}
+	tokens := &service.DefaultTokenService{Database: database, Key: testTokenKey}
+	admin := &models.User{ID: 1, Role: models.RoleAdmin}
+
+	member, err := users.RegisterUser(ctx, "profile", "profile@example.com", "secret-password", "")
+	assert.NoError(t, err)
+	other, err := users.RegisterUser(ctx, "profile-other", "profile-other@example.com", "secret-password", "")
+	assert.NoError(t, err)
+
+	_, err = users.GetUsers(ctx, member, 10, 0)
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Only admins list users")
+	listed, err := users.GetUsers(ctx, admin, 100, 0)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, listed)
+
+	_, err = users.GetUser(ctx, member, other.ID)
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Users cannot read other profiles")
+
+	profile, err := users.GetUser(ctx, member, member.ID)
+	assert.NoError(t, err, "Users should read their own profile")
+	profile.Username = "renamed"
+	profile.TimeZone = "Europe/Budapest"
+	updated, err := users.UpdateUser(ctx, member, *profile)
+	assert.NoError(t, err, "Users should update their own profile")
+	assert.Equal(t, "renamed", updated.Username)
+	assert.Equal(t, models.RoleCustomer, updated.Role, "Profile updates cannot change the role")
+
+	profile.Site = "downtown"
+	_, err = users.UpdateUser(ctx, member, *profile)
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Users cannot move themselves to another site")
+
+	pair, err := tokens.IssueTokens(ctx, member)
+	assert.NoError(t, err)
+	assert.Error(t, users.ChangePassword(ctx, member, member.ID, "wrong-password", "new-password"), "The current password must match")
+	err = users.ChangePassword(ctx, member, other.ID, "secret-password", "new-password")
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Users can only change their own password")
+	assert.NoError(t, users.ChangePassword(ctx, member, member.ID, "secret-password", "new-password"))
+	_, err = users.AuthenticateUser(ctx, "profile@example.com", "new-password")
+	assert.NoError(t, err, "The new password should work")
+	_, _, err = tokens.Authenticate(ctx, pair.AccessToken)
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Changing the password should end every session")
+
+	err = users.DeleteUser(ctx, member, other.ID)
+	assert.True(t, errors.Is(err, service.ErrUnauthorized), "Only admins delete users")
+	assert.NoError(t, users.DeleteUser(ctx, admin, other.ID))
+	_, err = users.GetUser(ctx, admin, other.ID)
+	assert.Error(t, err, "Deleted users should be gone")
+}
+
+func TestUserService_PasswordResetAndVerification(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	mailer := &mail.MemoryMailer{}
+	users := &service.DefaultUserService{Database: database, Mailer: mailer}
+
+	user, err := users.RegisterUser(ctx, "recover", "recover@example.com", "secret-password", "")
+	assert.NoError(t, err)
+	assert.False(t, user.EmailVerified)
+
+	messages := mailer.Messages("recover@example.com")
+	assert.Len(t, messages, 1, "Registering should send a verification mail")
+	verificationToken := mailedToken(messages[0])
+
+	assert.NoError(t, users.VerifyEmail(ctx, verificationToken), "Verifying should succeed")
+	verified, err := database.GetUserByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.True(t, verified.EmailVerified)
+	err = users.VerifyEmail(ctx, verificationToken)
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Verification tokens are single-use")
+
+	assert.NoError(t, users.RequestPasswordReset(ctx, "nobody@example.com"), "Unknown addresses should not be revealed")
+	assert.Empty(t, mailer.Messages("nobody@example.com"))
+
+	assert.NoError(t, users.RequestPasswordReset(ctx, "recover@example.com"))
+	assert.NoError(t, users.RequestPasswordReset(ctx, "recover@example.com"))
+	messages = mailer.Messages("recover@example.com")
+	assert.Len(t, messages, 3)
+	staleToken, resetToken := mailedToken(messages[1]), mailedToken(messages[2])
+
+	err = users.ResetPassword(ctx, staleToken, "another-password")
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Only the latest reset token should work")
+	assert.NoError(t, users.ResetPassword(ctx, resetToken, "another-password"), "Resetting should succeed")
+	_, err = users.AuthenticateUser(ctx, "recover@example.com", "another-password")
+	assert.NoError(t, err, "The new password should work")
+	err = users.ResetPassword(ctx, resetToken, "third-password")
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Reset tokens are single-use")
+
+	expiring := &service.DefaultUserService{Database: database, Mailer: mailer, PasswordResetTTL: time.Nanosecond}
+	assert.NoError(t, expiring.RequestPasswordReset(ctx, "recover@example.com"))
+	messages = mailer.Messages("recover@example.com")
+	time.Sleep(10 * time.Millisecond)
+	err = users.ResetPassword(ctx, mailedToken(messages[len(messages)-1]), "third-password")
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Expired reset tokens should be rejected")
+
+	switcher, err := users.RegisterUser(ctx, "switcher", "switcher@example.com", "secret-password", "")
+	assert.NoError(t, err)
+	staleVerification := mailedToken(mailer.Messages("switcher@example.com")[0])
+	switcher.Email = "someone-else@example.com"
+	_, err = users.UpdateUser(ctx, switcher, *switcher)
+	assert.NoError(t, err)
+	err = users.VerifyEmail(ctx, staleVerification)
+	assert.True(t, errors.Is(err, service.ErrInvalidToken), "Changing the email should invalidate pending verifications")
+}
+
+func TestUserService_PasswordPolicy(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# common passwords\nPassword123!\nletmein\n"), 0o644))
+	breached, err := service.LoadBreachedPasswords(path)
+	assert.NoError(t, err, "Loading the breached password list should succeed")
+	assert.Len(t, breached, 2)
+
+	users := &service.DefaultUserService{Database: database, PasswordPolicy: &service.PasswordPolicy{
+		MinLength:    10,
+		RequireUpper: true,
+		RequireDigit: true,
+		Breached:     breached,
+	}}
+
+	for _, password := range []string{"", "Short1", "nouppercase1", "NoDigitsHere", "password123!"} {
+		_, err = users.RegisterUser(ctx, "policy", "policy@example.com", password, "")
+		assert.True(t, errors.Is(err, service.ErrWeakPassword), "%q should be rejected", password)
+	}
+
+	user, err := users.RegisterUser(ctx, "policy", "policy@example.com", "Correct-Horse-42", "")
+	assert.NoError(t, err, "A password that follows the policy should be accepted")
+
+	err = users.ChangePassword(ctx, user, user.ID, "Correct-Horse-42", "letmein")
+	assert.True(t, errors.Is(err, service.ErrWeakPassword), "Changed passwords should follow the policy too")
+}
+
+func TestUserService_Lockout(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	users := &service.DefaultUserService{Database: database, LockoutPolicy: &service.LockoutPolicy{
+		MaxAttempts: 2,
+		BaseDelay:   time.Minute,
+		MaxDelay:    3 * time.Minute,
+	}}
+	user, err := users.RegisterUser(ctx, "lockout", "lockout@example.com", "secret-password", "")
+	assert.NoError(t, err)
+
+	_, err = users.AuthenticateUser(ctx, "lockout@example.com", "wrong-password")
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, service.ErrAccountLocked), "A single failure should not lock the account")
+
+	_, err = users.AuthenticateUser(ctx, "lockout@example.com", "wrong-password")
+	assert.Error(t, err)
+	_, err = users.AuthenticateUser(ctx, "lockout@example.com", "secret-password")
+	var locked *service.LockedError
+	assert.True(t, errors.As(err, &locked), "The account should be locked after too many failures")
+	assert.WithinDuration(t, time.Now().Add(time.Minute), locked.Until, 5*time.Second)
+
+	delays := []time.Duration{2 * time.Minute, 3 * time.Minute}
+	for _, delay := range delays {
+		assert.NoError(t, database.LockUser(ctx, user.ID, time.Now().Add(-time.Second)))
+		_, err = users.AuthenticateUser(ctx, "lockout@example.com", "wrong-password")
+		assert.Error(t, err)
+		stored, err := database.GetUserByID(ctx, user.ID)
+		assert.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(delay), stored.LockedUntil, 5*time.Second, "The lock should back off exponentially up to the maximum")
+	}
+
+	assert.NoError(t, database.LockUser(ctx, user.ID, time.Now().Add(-time.Second)))
+	_, err = users.AuthenticateUser(ctx, "lockout@example.com", "secret-password")
+	assert.NoError(t, err, "Logging in should succeed once the lock has expired")
+	stored, err := database.GetUserByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stored.FailedLogins, "A successful login should reset the failure count")
+	assert.True(t, stored.LockedUntil.IsZero())
+
+	err = users.ChangePassword(ctx, user, user.ID, "wrong-password", "brand-new-password")
+	assert.Error(t, err)
+	err = users.ChangePassword(ctx, user, user.ID, "wrong-password", "brand-new-password")
+	assert.Error(t, err)
+	err = users.ChangePassword(ctx, user, user.ID, "secret-password", "brand-new-password")
+	assert.True(t, errors.As(err, &locked), "Failed password changes should count towards the lockout")
+
+	_, err = users.AuthenticateUser(ctx, "nobody@example.com", "secret-password")
+	assert.EqualError(t, err, "invalid credentials", "Unknown accounts should fail like a wrong password")
+
+	uncapped := &service.DefaultUserService{Database: database, LockoutPolicy: &service.LockoutPolicy{
+		MaxAttempts: 1,
+		BaseDelay:   time.Hour,
+	}}
+	for i := 0; i < 80; i++ {
+		_, err = database.RecordFailedLogin(ctx, user.ID)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, database.LockUser(ctx, user.ID, time.Now().Add(-time.Second)))
+	_, err = uncapped.AuthenticateUser(ctx, "lockout@example.com", "wrong-password")
+	assert.Error(t, err)
+	stored, err = database.GetUserByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), stored.LockedUntil, 5*time.Second, "Without a maximum the delay should still be capped")
+
+	mailer := &mail.MemoryMailer{}
+	recovering := &service.DefaultUserService{Database: database, Mailer: mailer}
+	assert.NoError(t, recovering.RequestPasswordReset(ctx, "lockout@example.com"))
+	messages := mailer.Messages("lockout@example.com")
+	assert.NoError(t, recovering.ResetPassword(ctx, mailedToken(messages[len(messages)-1]), "recovered-password"))
+	stored, err = database.GetUserByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stored.FailedLogins, "Resetting the password should clear the failure count")
+	assert.True(t, stored.LockedUntil.IsZero(), "Resetting the password should lift the lock")
+	_, err = users.AuthenticateUser(ctx, "lockout@example.com", "recovered-password")
+	assert.NoError(t, err, "The new password should work right away")
+}
+
+func TestUserService_BcryptCostUpgrade(t *testing.T) {
+	ctx := context.Background()
+	database := &db.SQLiteDatabase{}
+	err := database.InitializeDatabase()
+	assert.NoError(t, err, "Database initialization should succeed")
+
+	cheap := &service.DefaultUserService{Database: database, BcryptCost: bcrypt.MinCost}
+	user, err := cheap.RegisterUser(ctx, "upgrade", "upgrade@example.com", "secret-password", "")
+	assert.NoError(t, err)
+
+	users := &service.DefaultUserService{Database: database, BcryptCost: bcrypt.MinCost + 1}
+	_, err = users.AuthenticateUser(ctx, "upgrade@example.com", "secret-password")
+	assert.NoError(t, err)
+
+	stored, err := database.GetUserByID(ctx, user.ID)
+	assert.NoError(t, err)
+	cost, err := bcrypt.Cost([]byte(stored.Password))
+	assert.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost+1, cost, "The hash should be upgraded to the configured cost")
+
+	_, err = cheap.AuthenticateUser(ctx, "upgrade@example.com", "secret-password")
+	assert.NoError(t, err, "The upgraded hash should still verify")
+}
+
+// mailedToken extracts the token from a message body of the form
+// "...: <token>\n...".
+func mailedToken(message mail.Message) string {
+	line := strings.SplitN(message.Body, "\n", 2)[0]
+	return line[strings.LastIndex(line, " ")+1:]
+}